@@ -0,0 +1,185 @@
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/hash"
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/manifest"
+)
+
+type (
+	// Contents describes what Build puts into a bundle. At least one of Update and Config must
+	// be set.
+	Contents struct {
+		Update *Artifact
+		Config *Artifact
+	}
+
+	// Artifact is a payload together with its manifest. An empty manifest hash is set to the
+	// SHA-256 hash of the payload, a given one must match it.
+	Artifact struct {
+		Manifest manifest.Manifest
+		// Path is the file containing the payload.
+		Path string
+		// ContentType selects the codec of a config payload. Defaults to the media type of the
+		// file extension.
+		ContentType string
+	}
+
+	// source is a file to be written into the archive.
+	source struct {
+		File
+		data []byte
+		path string
+	}
+)
+
+// Build writes a bundle with the contents to w and signs its index with key.
+func Build(w io.Writer, key ed25519.PrivateKey, contents Contents) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return errors.New("invalid signing key")
+	}
+	if contents.Update == nil && contents.Config == nil {
+		return errors.New("bundle must contain an update or a config")
+	}
+
+	var sources []source
+	for _, artifact := range []struct {
+		*Artifact
+		dir          string
+		manifestRole Role
+		payloadRole  Role
+	}{
+		{contents.Update, "update", RoleUpdateManifest, RoleUpdate},
+		{contents.Config, "config", RoleConfigManifest, RoleConfig},
+	} {
+		if artifact.Artifact == nil {
+			continue
+		}
+
+		payload, err := newFileSource(artifact.dir+"/"+filepath.Base(artifact.Path), artifact.payloadRole, artifact.Path)
+		if err != nil {
+			return err
+		}
+		payload.ContentType = artifact.ContentType
+		if payload.ContentType == "" {
+			payload.ContentType = commonHttp.ContentTypeByName(artifact.Path)
+		}
+
+		m := artifact.Manifest
+		if m.Version == "" {
+			return fmt.Errorf("%s manifest has no version", artifact.dir)
+		}
+		if m.Hash == "" {
+			m.Hash = payload.Hash
+		} else if err := verifyFile(m.Hash, artifact.Path); err != nil {
+			return fmt.Errorf("%s payload does not match its manifest: %w", artifact.dir, err)
+		}
+
+		manifestData, err := encodeManifest(m)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s manifest: %w", artifact.dir, err)
+		}
+
+		sources = append(sources, newDataSource(artifact.dir+"/manifest.json", artifact.manifestRole, manifestData), payload)
+	}
+
+	index := Index{FormatVersion: FormatVersion, CreatedAt: time.Now().UTC()}
+	for _, s := range sources {
+		index.Files = append(index.Files, s.File)
+	}
+	indexData, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	signature := hex.EncodeToString(ed25519.Sign(key, indexData))
+
+	writer := tar.NewWriter(w)
+	for _, s := range append([]source{
+		newDataSource(indexName, "", indexData),
+		newDataSource(signatureName, "", []byte(signature)),
+	}, sources...) {
+		if err := s.write(writer, index.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func newDataSource(name string, role Role, data []byte) source {
+	sum := sha256.Sum256(data)
+	return source{
+		File: File{Name: name, Role: role, Size: int64(len(data)), Hash: "sha256:" + hex.EncodeToString(sum[:]), ContentType: "application/json"},
+		data: data,
+	}
+}
+
+func newFileSource(name string, role Role, path string) (source, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	sum := sha256.New()
+	size, err := io.Copy(sum, file)
+	if err != nil {
+		return source{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return source{
+		File: File{Name: name, Role: role, Size: size, Hash: "sha256:" + hex.EncodeToString(sum.Sum(nil))},
+		path: path,
+	}, nil
+}
+
+// write adds the source to the archive. Files are read again and must not change while the
+// bundle is built.
+func (s source) write(writer *tar.Writer, modTime time.Time) error {
+	header := &tar.Header{Name: s.Name, Mode: 0o644, Size: s.Size, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := writer.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.Name, err)
+	}
+
+	if s.path == "" {
+		_, err := writer.Write(s.data)
+		return err
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(writer, file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", s.Name, err)
+	}
+	return nil
+}
+
+func verifyFile(hashString, path string) error {
+	verifier, _, err := hash.NewVerifierFromHashString(hashString)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return verifier.Verify(file)
+}
@@ -0,0 +1,352 @@
+// Package bundle builds and reads offline update bundles. A bundle is a tar archive starting
+// with a signed index, followed by the manifests and payloads of an update and a config. Sites
+// without connectivity import bundles through the updater and config services, which apply
+// them with the same verification as online updates.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/manifest"
+)
+
+type (
+	// Index lists the files of a bundle. It is signed, so that the hashes of the files
+	// authenticate the whole bundle.
+	Index struct {
+		FormatVersion int       `json:"formatVersion"`
+		CreatedAt     time.Time `json:"createdAt"`
+		Files         []File    `json:"files"`
+	}
+
+	File struct {
+		Name        string `json:"name"`
+		Role        Role   `json:"role"`
+		Size        int64  `json:"size"`
+		Hash        string `json:"hash"`
+		ContentType string `json:"contentType,omitempty"`
+	}
+
+	Role string
+
+	// Bundle is an opened bundle whose signature and files have been verified.
+	Bundle struct {
+		file           *os.File
+		index          Index
+		entries        map[string]entry
+		updateManifest *manifest.Manifest
+		configManifest *manifest.Manifest
+	}
+
+	entry struct {
+		File
+		offset int64
+	}
+)
+
+const (
+	FormatVersion = 1
+
+	RoleUpdateManifest Role = "update_manifest"
+	RoleUpdate         Role = "update"
+	RoleConfigManifest Role = "config_manifest"
+	RoleConfig         Role = "config"
+
+	indexName     = "index.json"
+	signatureName = "index.sig"
+
+	// maxMetadataSize limits the size of the index, signature and manifests read into memory.
+	maxMetadataSize = 1 << 20
+)
+
+var (
+	ErrInvalidSignature = errors.New("bundle signature is invalid")
+	ErrNoTrustedKeys    = errors.New("no trusted bundle keys configured")
+)
+
+// Open verifies the bundle at path against the trusted keys. The signature of the index must
+// be valid for one of the keys and every file must match its hash in the index.
+func Open(path string, keys ...ed25519.PublicKey) (*Bundle, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoTrustedKeys
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+
+	b, err := read(file, keys)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// Verify verifies the bundle at path without keeping it open.
+func Verify(path string, keys ...ed25519.PublicKey) error {
+	b, err := Open(path, keys...)
+	if err != nil {
+		return err
+	}
+	return b.Close()
+}
+
+// Inspect returns the index of the bundle at path without verifying its signature or files.
+func Inspect(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	indexData, _, err := readHeader(tar.NewReader(file))
+	if err != nil {
+		return nil, err
+	}
+	return decodeIndex(indexData)
+}
+
+// read verifies the bundle while remembering the offset of every file within the archive, so
+// that payloads are served from the archive without extracting them.
+func read(file *os.File, keys []ed25519.PublicKey) (*Bundle, error) {
+	reader := tar.NewReader(file)
+
+	indexData, signature, err := readHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !verifySignature(indexData, signature, keys) {
+		return nil, ErrInvalidSignature
+	}
+
+	index, err := decodeIndex(indexData)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string]File, len(index.Files))
+	for _, f := range index.Files {
+		if _, ok := expected[f.Name]; ok {
+			return nil, fmt.Errorf("index lists %s twice", f.Name)
+		}
+		expected[f.Name] = f
+	}
+
+	b := &Bundle{file: file, index: *index, entries: make(map[string]entry, len(index.Files))}
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+
+		f, ok := expected[header.Name]
+		if !ok {
+			return nil, fmt.Errorf("bundle contains unlisted file %s", header.Name)
+		}
+		if _, ok := b.entries[header.Name]; ok {
+			return nil, fmt.Errorf("bundle contains %s twice", header.Name)
+		}
+		if header.Typeflag != tar.TypeReg || header.Size != f.Size {
+			return nil, fmt.Errorf("file %s does not match the index", header.Name)
+		}
+
+		offset, err := file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+
+		hash := sha256.New()
+		if _, err := io.Copy(hash, reader); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+		if "sha256:"+hex.EncodeToString(hash.Sum(nil)) != f.Hash {
+			return nil, fmt.Errorf("file %s does not match its hash", header.Name)
+		}
+
+		b.entries[header.Name] = entry{File: f, offset: offset}
+	}
+
+	if len(b.entries) != len(expected) {
+		return nil, errors.New("bundle is missing files listed in the index")
+	}
+
+	if b.updateManifest, err = b.readManifest(RoleUpdateManifest, RoleUpdate); err != nil {
+		return nil, err
+	}
+	if b.configManifest, err = b.readManifest(RoleConfigManifest, RoleConfig); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// readHeader reads the index and its signature, which must be the first files of the archive.
+func readHeader(reader *tar.Reader) ([]byte, []byte, error) {
+	var data [2][]byte
+	for i, name := range []string{indexName, signatureName} {
+		header, err := reader.Next()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read bundle: %w", err)
+		}
+		if header.Name != name || header.Size > maxMetadataSize {
+			return nil, nil, fmt.Errorf("bundle does not start with %s", name)
+		}
+		if data[i], err = io.ReadAll(reader); err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+	return data[0], data[1], nil
+}
+
+func decodeIndex(data []byte) (*Index, error) {
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+	if index.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported bundle format version %d", index.FormatVersion)
+	}
+	roles := make(map[Role]bool, len(index.Files))
+	for _, f := range index.Files {
+		if !validName(f.Name) {
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+		switch f.Role {
+		case RoleUpdateManifest, RoleUpdate, RoleConfigManifest, RoleConfig:
+		default:
+			return nil, fmt.Errorf("file %s has unknown role %q", f.Name, f.Role)
+		}
+		if roles[f.Role] {
+			return nil, fmt.Errorf("index lists role %s twice", f.Role)
+		}
+		roles[f.Role] = true
+	}
+	return &index, nil
+}
+
+func verifySignature(data, signature []byte, keys []ed25519.PublicKey) bool {
+	decoded, err := hex.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return false
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, data, decoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// readManifest decodes the manifest of the role. A bundle without the role returns nil.
+func (b *Bundle) readManifest(role Role, payloadRole Role) (*manifest.Manifest, error) {
+	e, ok := b.entryOf(role)
+	if !ok {
+		return nil, nil
+	}
+	if e.Size > maxMetadataSize {
+		return nil, fmt.Errorf("manifest %s is too large", e.Name)
+	}
+	if _, ok := b.entryOf(payloadRole); !ok {
+		return nil, fmt.Errorf("bundle contains a %s without %s", role, payloadRole)
+	}
+
+	var m manifest.Manifest
+	if err := json.NewDecoder(io.NewSectionReader(b.file, e.offset, e.Size)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", e.Name, err)
+	}
+	return &m, nil
+}
+
+func (b *Bundle) entryOf(role Role) (entry, bool) {
+	for _, e := range b.entries {
+		if e.Role == role {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// Index returns the verified index of the bundle.
+func (b *Bundle) Index() Index {
+	return b.index
+}
+
+// UpdateManifest returns the manifest of the update, or nil if the bundle contains none.
+func (b *Bundle) UpdateManifest() *manifest.Manifest {
+	return b.updateManifest
+}
+
+// ConfigManifest returns the manifest of the config, or nil if the bundle contains none.
+func (b *Bundle) ConfigManifest() *manifest.Manifest {
+	return b.configManifest
+}
+
+// Fetch returns the payload described by the manifest, which makes a Bundle usable as
+// updater.UpdateRequester.
+func (b *Bundle) Fetch(ctx context.Context, m *manifest.Manifest) (io.ReadCloser, error) {
+	f, err := b.PayloadOf(m)
+	if err != nil {
+		return nil, err
+	}
+	e := b.entries[f.Name]
+	return io.NopCloser(io.NewSectionReader(b.file, e.offset, e.Size)), nil
+}
+
+// PayloadOf returns the file of the payload described by the manifest.
+func (b *Bundle) PayloadOf(m *manifest.Manifest) (File, error) {
+	var role Role
+	switch {
+	case sameVersion(m, b.updateManifest):
+		role = RoleUpdate
+	case sameVersion(m, b.configManifest):
+		role = RoleConfig
+	default:
+		return File{}, fmt.Errorf("bundle contains no payload of version %s", m.Version)
+	}
+
+	e, _ := b.entryOf(role)
+	return e.File, nil
+}
+
+func sameVersion(m, other *manifest.Manifest) bool {
+	return other != nil && m.Version == other.Version && m.Hash == other.Hash
+}
+
+// Close closes the archive. Readers returned by Fetch must not be used afterwards.
+func (b *Bundle) Close() error {
+	return b.file.Close()
+}
+
+// validName accepts clean relative paths, so that names cannot escape an extraction directory.
+func validName(name string) bool {
+	return name != "" && name != indexName && name != signatureName && !strings.HasPrefix(name, "/") &&
+		path.Clean(name) == name && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// encodeManifest returns the JSON encoding of the manifest stored in the bundle.
+func encodeManifest(m manifest.Manifest) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,185 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/bundle"
+	"github.com/dtomschitz/headless-go-client/manifest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildBundle writes a bundle with an update and a config into a temporary directory.
+func buildBundle(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	binaryPath := filepath.Join(dir, "client-1.2.0")
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(binaryPath, []byte("binary"), 0o600))
+	require.NoError(t, os.WriteFile(configPath, []byte("logLevel: debug\n"), 0o600))
+
+	path := filepath.Join(dir, "site.bundle")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	require.NoError(t, bundle.Build(file, key, bundle.Contents{
+		Update: &bundle.Artifact{Manifest: manifest.Manifest{Version: "1.2.0", URL: "https://updates.example.com/client-1.2.0"}, Path: binaryPath},
+		Config: &bundle.Artifact{Manifest: manifest.Manifest{Version: "v7"}, Path: configPath},
+	}))
+	return path
+}
+
+func TestBundle_BuildAndOpen(t *testing.T) {
+	// given
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := buildBundle(t, private)
+
+	// when
+	b, err := bundle.Open(path, public)
+	require.NoError(t, err)
+	defer b.Close()
+
+	// then
+	update := b.UpdateManifest()
+	require.NotNil(t, update)
+	assert.Equal(t, "1.2.0", update.Version)
+	assert.Equal(t, "https://updates.example.com/client-1.2.0", update.URL)
+
+	reader, err := b.Fetch(context.Background(), update)
+	require.NoError(t, err)
+	binary, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", string(binary))
+	assert.NoError(t, update.Verify(binary))
+
+	config := b.ConfigManifest()
+	require.NotNil(t, config)
+	file, err := b.PayloadOf(config)
+	require.NoError(t, err)
+	assert.Equal(t, bundle.RoleConfig, file.Role)
+	assert.Equal(t, "application/yaml", file.ContentType)
+
+	_, err = b.Fetch(context.Background(), &manifest.Manifest{Version: "1.3.0"})
+	assert.Error(t, err)
+}
+
+func TestBundle_RejectsUntrustedKey(t *testing.T) {
+	// given
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := buildBundle(t, private)
+
+	// when
+	err = bundle.Verify(path, other)
+	noKeysErr := bundle.Verify(path)
+
+	// then
+	assert.ErrorIs(t, err, bundle.ErrInvalidSignature)
+	assert.ErrorIs(t, noKeysErr, bundle.ErrNoTrustedKeys)
+}
+
+func TestBundle_RejectsTamperedFile(t *testing.T) {
+	// given
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := buildBundle(t, private)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tampered := bytes.Replace(data, []byte("binary"), []byte("BINARY"), 1)
+	require.NotEqual(t, data, tampered)
+	require.NoError(t, os.WriteFile(path, tampered, 0o600))
+
+	// when
+	err = bundle.Verify(path, public)
+
+	// then
+	assert.ErrorContains(t, err, "does not match its hash")
+}
+
+func TestBundle_RejectsUnlistedFile(t *testing.T) {
+	// given
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := buildBundle(t, private)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The archive is rewritten with an additional file, keeping the signed index.
+	var buf bytes.Buffer
+	reader := tar.NewReader(bytes.NewReader(data))
+	writer := tar.NewWriter(&buf)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, writer.WriteHeader(header))
+		_, err = io.Copy(writer, reader)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "update/extra", Mode: 0o644, Size: 5, Typeflag: tar.TypeReg}))
+	_, err = writer.Write([]byte("extra"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	// when
+	err = bundle.Verify(path, public)
+
+	// then
+	assert.ErrorContains(t, err, "unlisted file update/extra")
+}
+
+func TestBundle_Inspect(t *testing.T) {
+	// given
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := buildBundle(t, private)
+
+	// when
+	index, err := bundle.Inspect(path)
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, bundle.FormatVersion, index.FormatVersion)
+	require.Len(t, index.Files, 4)
+
+	var names []string
+	for _, file := range index.Files {
+		names = append(names, file.Name)
+	}
+	assert.Equal(t, []string{"update/manifest.json", "update/client-1.2.0", "config/manifest.json", "config/config.yaml"}, names)
+}
+
+func TestBuild_RejectsMismatchingHash(t *testing.T) {
+	// given
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "client")
+	require.NoError(t, os.WriteFile(path, []byte("binary"), 0o600))
+
+	// when
+	err = bundle.Build(io.Discard, private, bundle.Contents{
+		Update: &bundle.Artifact{Manifest: manifest.Manifest{Version: "1.2.0", Hash: "sha256:0000"}, Path: path},
+	})
+
+	// then
+	assert.ErrorContains(t, err, "does not match its manifest")
+}
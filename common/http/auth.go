@@ -0,0 +1,185 @@
+package http_client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+)
+
+type (
+	// HMACCredentials identify a device towards the backend. The secret is shared between the
+	// device and the backend and never sent over the wire.
+	HMACCredentials struct {
+		DeviceId string
+		Secret   []byte
+	}
+
+	// HMACTransport signs every request with the device secret. The signature covers the
+	// method, the request URI, the device id, a timestamp, a random nonce and the SHA-256 hash
+	// of the body, so that the backend can reject forged, modified and replayed requests.
+	HMACTransport struct {
+		Base        http.RoundTripper
+		Credentials HMACCredentials
+		// CredentialsFunc takes precedence over Credentials and is called for every request, so
+		// that rotated credentials are used without recreating the client.
+		CredentialsFunc func() HMACCredentials
+		now             func() time.Time
+	}
+
+	// certificateLoader loads a client certificate from disk and reloads it once the files
+	// changed, so that rotated certificates are picked up without a restart.
+	certificateLoader struct {
+		certFile string
+		keyFile  string
+
+		mu          sync.Mutex
+		certificate *tls.Certificate
+		modTime     time.Time
+	}
+)
+
+const (
+	TimestampHeader   = "x-auth-timestamp"
+	NonceHeader       = "x-auth-nonce"
+	ContentHashHeader = "x-content-sha256"
+	SignatureHeader   = "x-auth-signature"
+)
+
+func NewHMACTransport(base http.RoundTripper, credentials HMACCredentials) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &HMACTransport{Base: base, Credentials: credentials, now: time.Now}
+}
+
+func (t *HMACTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	credentials := t.Credentials
+	if t.CredentialsFunc != nil {
+		credentials = t.CredentialsFunc()
+	}
+	if credentials.DeviceId == "" || len(credentials.Secret) == 0 {
+		return nil, errors.New("hmac credentials require a device id and a secret")
+	}
+
+	clonedReq := req.Clone(req.Context())
+
+	body, err := readBody(clonedReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body for signing: %w", err)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to create nonce: %w", err)
+	}
+
+	bodyHash := sha256.Sum256(body)
+	clonedReq.Header.Set(string(commonCtx.DeviceIdKey), credentials.DeviceId)
+	clonedReq.Header.Set(TimestampHeader, strconv.FormatInt(t.now().Unix(), 10))
+	clonedReq.Header.Set(NonceHeader, hex.EncodeToString(nonce))
+	clonedReq.Header.Set(ContentHashHeader, hex.EncodeToString(bodyHash[:]))
+	clonedReq.Header.Set(SignatureHeader, Sign(credentials.Secret, clonedReq))
+
+	return t.Base.RoundTrip(clonedReq)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the canonical form of a request carrying the
+// device id, timestamp, nonce and content hash headers.
+func Sign(secret []byte, req *http.Request) string {
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.RequestURI(),
+		req.Header.Get(string(commonCtx.DeviceIdKey)),
+		req.Header.Get(TimestampHeader),
+		req.Header.Get(NonceHeader),
+		req.Header.Get(ContentHashHeader),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(canonical))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads the body of the request and replaces it with an in-memory copy. GetBody is
+// preferred so that a request sent before can be signed again.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	source := req.Body
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		source = body
+	}
+	defer source.Close()
+
+	body, err := io.ReadAll(source)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.ContentLength = int64(len(body))
+	return body, nil
+}
+
+func newCertificateLoader(certFile, keyFile string) *certificateLoader {
+	return &certificateLoader{certFile: certFile, keyFile: keyFile}
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (l *certificateLoader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	modTime, err := latestModTime(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat client certificate: %w", err)
+	}
+
+	if l.certificate == nil || modTime.After(l.modTime) {
+		certificate, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		l.certificate, l.modTime = &certificate, modTime
+	}
+
+	return l.certificate, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,136 @@
+package http_client_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMACTransport_SignsRequests(t *testing.T) {
+	// given
+	secret := []byte("device-secret")
+
+	var mu sync.Mutex
+	var nonces []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		hash := sha256.Sum256(body)
+
+		assert.Equal(t, "device-1", r.Header.Get("x-device-id"))
+		assert.Equal(t, hex.EncodeToString(hash[:]), r.Header.Get(commonHttp.ContentHashHeader))
+		assert.Equal(t, commonHttp.Sign(secret, r), r.Header.Get(commonHttp.SignatureHeader))
+		assert.Equal(t, "payload", string(body))
+
+		mu.Lock()
+		nonces = append(nonces, r.Header.Get(commonHttp.NonceHeader))
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	client := commonHttp.NewClient(commonHttp.WithHMAC(commonHttp.HMACCredentials{DeviceId: "device-1", Secret: secret}))
+
+	// when
+	for i := 0; i < 2; i++ {
+		resp, err := client.Post(server.URL+"/api/v1/events?batch=1", "text/plain", bytes.NewBufferString("payload"))
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// then
+	require.Len(t, nonces, 2)
+	assert.NotEqual(t, nonces[0], nonces[1], "expected a fresh nonce per request")
+}
+
+func TestHMACTransport_RejectsMissingCredentials(t *testing.T) {
+	client := &http.Client{Transport: commonHttp.NewHMACTransport(nil, commonHttp.HMACCredentials{}), Timeout: time.Second}
+
+	_, err := client.Get("http://localhost")
+
+	assert.ErrorContains(t, err, "hmac credentials")
+}
+
+// writeCertificate writes a self-signed client certificate with the common name to the files.
+func writeCertificate(certFile, keyFile, commonName string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: commonName}}, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600)
+}
+
+func TestWithClientCertificate_ReloadsRotatedCertificate(t *testing.T) {
+	// given
+	var mu sync.Mutex
+	var commonNames []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		commonNames = append(commonNames, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	require.NoError(t, writeCertificate(certFile, keyFile, "device-1"))
+
+	client := commonHttp.NewClient(commonHttp.WithRootCAs(caFile), commonHttp.WithClientCertificate(certFile, keyFile))
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// when
+	require.NoError(t, writeCertificate(certFile, keyFile, "device-2"))
+	rotatedAt := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, rotatedAt, rotatedAt))
+	resp, err = client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"device-1", "device-2"}, commonNames)
+}
@@ -0,0 +1,317 @@
+package http_client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/metrics"
+)
+
+type (
+	CircuitState string
+
+	// CircuitBreakerConfig controls when the circuit of a host opens and how it recovers.
+	CircuitBreakerConfig struct {
+		// Window is the period over which the failure rate is computed. Defaults to 30 seconds.
+		Window time.Duration
+		// MinRequests is the number of requests within the window before the circuit may open.
+		// Defaults to 10.
+		MinRequests int
+		// FailureRate opens the circuit when reached. Defaults to 0.5.
+		FailureRate float64
+		// Cooldown is the time the circuit stays open before probe requests are let through.
+		// Defaults to 30 seconds.
+		Cooldown time.Duration
+		// HalfOpenRequests is the number of successful probes needed to close the circuit.
+		// Defaults to 1.
+		HalfOpenRequests int
+		// IsFailure classifies the outcome of a request. Defaults to transport errors and 5xx
+		// responses except 501.
+		IsFailure func(resp *http.Response, err error) bool
+	}
+
+	// CircuitTransition describes a state change of the circuit of a host.
+	CircuitTransition struct {
+		Host        string
+		From        CircuitState
+		To          CircuitState
+		FailureRate float64
+		Time        time.Time
+	}
+
+	// CircuitBreakers keeps one circuit per host. A single instance is shared by all clients of
+	// a process, so that the services stop calling an unavailable backend together.
+	CircuitBreakers struct {
+		config CircuitBreakerConfig
+		now    func() time.Time
+
+		mu        sync.Mutex
+		circuits  map[string]*circuit
+		listeners map[int]func(CircuitTransition)
+		nextId    int
+		// transitions collects the transitions made while mu is held. The listeners are notified
+		// once mu is released, so that they may use the breakers.
+		transitions []CircuitTransition
+	}
+
+	// CircuitBreakerTransport rejects requests to hosts whose circuit is open with
+	// ErrCircuitOpen.
+	CircuitBreakerTransport struct {
+		Base     http.RoundTripper
+		Breakers *CircuitBreakers
+	}
+
+	circuit struct {
+		state       CircuitState
+		windowStart time.Time
+		requests    int
+		failures    int
+		openedAt    time.Time
+		probes      int
+		successes   int
+	}
+)
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// DefaultCircuitBreakers is used by every client created by NewClient unless configured
+	// otherwise.
+	DefaultCircuitBreakers = NewCircuitBreakers(CircuitBreakerConfig{})
+)
+
+func NewCircuitBreakers(config CircuitBreakerConfig) *CircuitBreakers {
+	if config.Window <= 0 {
+		config.Window = 30 * time.Second
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.FailureRate <= 0 || config.FailureRate > 1 {
+		config.FailureRate = 0.5
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 30 * time.Second
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = 1
+	}
+	if config.IsFailure == nil {
+		config.IsFailure = isCircuitFailure
+	}
+
+	return &CircuitBreakers{
+		config:    config,
+		now:       time.Now,
+		circuits:  make(map[string]*circuit),
+		listeners: make(map[int]func(CircuitTransition)),
+	}
+}
+
+func NewCircuitBreakerTransport(base http.RoundTripper, breakers *CircuitBreakers) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if breakers == nil {
+		breakers = DefaultCircuitBreakers
+	}
+	return &CircuitBreakerTransport{Base: base, Breakers: breakers}
+}
+
+func (t *CircuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	probe, err := t.Breakers.allow(host)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+
+	// Cancelled requests say nothing about the health of the host.
+	if err != nil && req.Context().Err() != nil {
+		t.Breakers.release(host, probe)
+		return resp, err
+	}
+
+	t.Breakers.record(host, probe, t.Breakers.config.IsFailure(resp, err))
+	return resp, err
+}
+
+// Subscribe calls fn on every state transition until the returned function is called. fn must
+// not block.
+func (b *CircuitBreakers) Subscribe(fn func(CircuitTransition)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextId
+	b.nextId++
+	b.listeners[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.listeners, id)
+	}
+}
+
+// State returns the state of the circuit of the host.
+func (b *CircuitBreakers) State(host string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && b.now().Sub(c.openedAt) >= b.config.Cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// allow reports whether a request to the host may be sent and whether it is a probe of a
+// half-open circuit.
+func (b *CircuitBreakers) allow(host string) (bool, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	c := b.circuit(host)
+	now := b.now()
+
+	if c.state == CircuitOpen {
+		if now.Sub(c.openedAt) < b.config.Cooldown {
+			return false, fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+		}
+		b.transition(host, c, CircuitHalfOpen, now)
+		c.probes, c.successes = 0, 0
+	}
+
+	if c.state == CircuitHalfOpen {
+		if c.probes >= b.config.HalfOpenRequests {
+			return false, fmt.Errorf("%w for %s", ErrCircuitOpen, host)
+		}
+		c.probes++
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (b *CircuitBreakers) record(host string, probe bool, failed bool) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	c := b.circuit(host)
+	now := b.now()
+
+	if probe {
+		if c.state != CircuitHalfOpen {
+			return
+		}
+		if failed {
+			c.openedAt = now
+			b.transition(host, c, CircuitOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= b.config.HalfOpenRequests {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+			b.transition(host, c, CircuitClosed, now)
+		}
+		return
+	}
+
+	if c.state != CircuitClosed {
+		return
+	}
+	if now.Sub(c.windowStart) >= b.config.Window {
+		c.windowStart, c.requests, c.failures = now, 0, 0
+	}
+	c.requests++
+	if failed {
+		c.failures++
+	}
+
+	if c.requests >= b.config.MinRequests && c.failureRate() >= b.config.FailureRate {
+		c.openedAt = now
+		b.transition(host, c, CircuitOpen, now)
+	}
+}
+
+// release returns the probe slot of a request that ended without a result.
+func (b *CircuitBreakers) release(host string, probe bool) {
+	if !probe {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c := b.circuit(host); c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+func (b *CircuitBreakers) circuit(host string) *circuit {
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{state: CircuitClosed, windowStart: b.now()}
+		b.circuits[host] = c
+	}
+	return c
+}
+
+// transition changes the state of the circuit and queues the transition for the listeners. It
+// must be called with b.mu held.
+func (b *CircuitBreakers) transition(host string, c *circuit, to CircuitState, now time.Time) {
+	transition := CircuitTransition{Host: host, From: c.state, To: to, FailureRate: c.failureRate(), Time: now}
+	c.state = to
+
+	metrics.DefaultRegistry.Counter("http_client_circuit_transitions_total", "Number of circuit breaker state transitions.",
+		metrics.Labels{"host": host, "to": string(to)}).Inc()
+
+	b.transitions = append(b.transitions, transition)
+}
+
+// unlock releases b.mu and notifies the listeners of the transitions made while it was held.
+func (b *CircuitBreakers) unlock() {
+	transitions := b.transitions
+	b.transitions = nil
+
+	var listeners []func(CircuitTransition)
+	if len(transitions) > 0 {
+		for _, listener := range b.listeners {
+			listeners = append(listeners, listener)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, transition := range transitions {
+		for _, listener := range listeners {
+			listener(transition)
+		}
+	}
+}
+
+func (c *circuit) failureRate() float64 {
+	if c.requests == 0 {
+		return 0
+	}
+	return float64(c.failures) / float64(c.requests)
+}
+
+func isCircuitFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented
+}
@@ -0,0 +1,153 @@
+package http_client_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyServer answers with 502 until it is healthy and counts the requests it receives.
+type flakyServer struct {
+	healthy  atomic.Bool
+	requests atomic.Int32
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	if !s.healthy.Load() {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("opens and recovers", func(t *testing.T) {
+		// given
+		flaky := &flakyServer{}
+		server := httptest.NewServer(flaky)
+		defer server.Close()
+		host := server.Listener.Addr().String()
+
+		breakers := commonHttp.NewCircuitBreakers(commonHttp.CircuitBreakerConfig{MinRequests: 4, Cooldown: 100 * time.Millisecond})
+		var transitions []commonHttp.CircuitTransition
+		unsubscribe := breakers.Subscribe(func(transition commonHttp.CircuitTransition) {
+			transitions = append(transitions, transition)
+		})
+		defer unsubscribe()
+
+		client := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers), commonHttp.WithRetry(0, time.Millisecond))
+
+		// when
+		for i := 0; i < 4; i++ {
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		_, rejectedErr := client.Get(server.URL)
+
+		require.Eventually(t, func() bool {
+			return breakers.State(host) == commonHttp.CircuitHalfOpen
+		}, time.Second, 10*time.Millisecond)
+		flaky.healthy.Store(true)
+		resp, probeErr := client.Get(server.URL)
+
+		// then
+		assert.True(t, errors.Is(rejectedErr, commonHttp.ErrCircuitOpen))
+		require.NoError(t, probeErr)
+		resp.Body.Close()
+		assert.Equal(t, int32(5), flaky.requests.Load(), "expected the open circuit to reject the request")
+		assert.Equal(t, commonHttp.CircuitClosed, breakers.State(host))
+
+		require.Len(t, transitions, 3)
+		assert.Equal(t, commonHttp.CircuitOpen, transitions[0].To)
+		assert.Equal(t, 1.0, transitions[0].FailureRate)
+		assert.Equal(t, commonHttp.CircuitHalfOpen, transitions[1].To)
+		assert.Equal(t, commonHttp.CircuitClosed, transitions[2].To)
+	})
+
+	t.Run("reopens on failed probe", func(t *testing.T) {
+		// given
+		flaky := &flakyServer{}
+		server := httptest.NewServer(flaky)
+		defer server.Close()
+		host := server.Listener.Addr().String()
+
+		breakers := commonHttp.NewCircuitBreakers(commonHttp.CircuitBreakerConfig{MinRequests: 2, Cooldown: 50 * time.Millisecond})
+		client := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers), commonHttp.WithRetry(0, time.Millisecond))
+
+		for i := 0; i < 2; i++ {
+			resp, err := client.Get(server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+		require.Eventually(t, func() bool {
+			return breakers.State(host) == commonHttp.CircuitHalfOpen
+		}, time.Second, 10*time.Millisecond)
+
+		// when
+		resp, err := client.Get(server.URL)
+
+		// then
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, commonHttp.CircuitOpen, breakers.State(host))
+		assert.Equal(t, int32(3), flaky.requests.Load())
+	})
+
+	t.Run("shared across clients", func(t *testing.T) {
+		// given
+		flaky := &flakyServer{}
+		server := httptest.NewServer(flaky)
+		defer server.Close()
+
+		breakers := commonHttp.NewCircuitBreakers(commonHttp.CircuitBreakerConfig{MinRequests: 3})
+		first := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers), commonHttp.WithRetry(0, time.Millisecond))
+		second := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers))
+
+		for i := 0; i < 3; i++ {
+			resp, err := first.Get(server.URL)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		// when
+		_, err := second.Get(server.URL)
+
+		// then
+		assert.ErrorIs(t, err, commonHttp.ErrCircuitOpen)
+		assert.Equal(t, int32(3), flaky.requests.Load(), "expected the open circuit not to be retried")
+	})
+
+	t.Run("listeners may use the breakers", func(t *testing.T) {
+		// given
+		flaky := &flakyServer{}
+		server := httptest.NewServer(flaky)
+		defer server.Close()
+		host := server.Listener.Addr().String()
+
+		breakers := commonHttp.NewCircuitBreakers(commonHttp.CircuitBreakerConfig{MinRequests: 1})
+		var states []commonHttp.CircuitState
+		unsubscribe := breakers.Subscribe(func(transition commonHttp.CircuitTransition) {
+			states = append(states, breakers.State(transition.Host))
+		})
+		defer unsubscribe()
+
+		client := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers), commonHttp.WithRetry(0, time.Millisecond))
+
+		// when
+		resp, err := client.Get(server.URL)
+
+		// then
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, []commonHttp.CircuitState{commonHttp.CircuitOpen}, states)
+		assert.Equal(t, commonHttp.CircuitOpen, breakers.State(host))
+	})
+}
@@ -1,33 +1,93 @@
 package http_client
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 )
 
 type config struct {
-	retryCount   int
-	retryBackoff time.Duration
-	timeout      time.Duration
+	retryPolicy RetryPolicy
+	retryHook   RetryHook
+	timeout     time.Duration
+
+	certFile string
+	keyFile  string
+	hmac     func() HMACCredentials
+
+	proxy         string
+	rootCAFiles   []string
+	pins          map[string][]string
+	minTLSVersion uint16
+	pool          *PoolConfig
+
+	middlewares []TransportMiddleware
+	breakers    *CircuitBreakers
+	schemes     *SchemeRegistry
 }
 
 // NewClient returns a *http.Client with retry and context header injection configured.
+// The options set by SetDefaultOptions are applied first. Requests are authenticated with a
+// client certificate and signed with HMAC if configured.
+// Transport middlewares wrap the authenticated transport and are wrapped by the context header
+// and retry transports, so every retry passes all middlewares again. Every attempt passes the
+// circuit breaker of its host, which is shared by all clients unless configured otherwise.
+// URLs with schemes other than http and https are served by the transports of the scheme
+// registry and bypass this chain. Redirects are only followed to http and https URLs.
 func NewClient(opts ...Option) *http.Client {
-	config := &config{
-		timeout:      60 * time.Second,
-		retryCount:   3,
-		retryBackoff: 500 * time.Millisecond,
+	config := newConfig(opts)
+
+	transport := newBaseTransport(config)
+	if config.hmac != nil {
+		transport = &HMACTransport{Base: transport, CredentialsFunc: config.hmac, now: time.Now}
 	}
 
-	for _, o := range opts {
-		o(config)
+	for i := len(config.middlewares) - 1; i >= 0; i-- {
+		transport = config.middlewares[i](transport)
 	}
 
-	ctxTransport := NewContextHeaderTransport(http.DefaultTransport)
-	retryTransport := NewRetryTransport(ctxTransport, config.retryCount, config.retryBackoff)
+	transport = NewContextHeaderTransport(transport)
+	if config.breakers != nil {
+		transport = NewCircuitBreakerTransport(transport, config.breakers)
+	}
+	transport = NewRetryTransportWithPolicy(transport, config.retryPolicyWithHook())
+	if config.schemes != nil {
+		transport = NewSchemeTransport(transport, config.schemes)
+	}
 
 	return &http.Client{
-		Transport: retryTransport,
-		Timeout:   config.timeout,
+		Transport:     transport,
+		Timeout:       config.timeout,
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// checkRedirect follows at most 10 redirects like the default policy of http.Client, and only
+// to http and https URLs, so that servers cannot redirect the client to registered schemes
+// such as local files.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if scheme := strings.ToLower(req.URL.Scheme); scheme != "http" && scheme != "https" {
+		return fmt.Errorf("redirect to url scheme %q is not allowed", req.URL.Scheme)
+	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// retryPolicyWithHook returns the retry policy calling both its own hook and the one set by
+// WithRetryHook.
+func (c *config) retryPolicyWithHook() RetryPolicy {
+	policy := c.retryPolicy
+	if policyHook, hook := policy.Hook, c.retryHook; hook != nil {
+		policy.Hook = func(attempt RetryAttempt) {
+			if policyHook != nil {
+				policyHook(attempt)
+			}
+			hook(attempt)
+		}
 	}
+	return policy
 }
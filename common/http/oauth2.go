@@ -0,0 +1,271 @@
+package http_client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+)
+
+type (
+	// Token is an OAuth2 access token.
+	Token struct {
+		AccessToken string
+		TokenType   string
+		// ExpiresAt is zero for tokens that do not expire.
+		ExpiresAt time.Time
+	}
+
+	// TokenSource provides access tokens for the BearerTransport.
+	TokenSource interface {
+		// Token returns a valid token, fetching a new one if necessary.
+		Token(ctx context.Context) (*Token, error)
+		// Invalidate discards the token, e.g. because the server rejected it.
+		Invalidate(token *Token)
+	}
+
+	ClientCredentialsConfig struct {
+		TokenURL     string
+		ClientID     string
+		ClientSecret string
+		Scopes       []string
+		// EndpointParams are additional parameters of the token request, e.g. audience.
+		EndpointParams url.Values
+		// AuthInParams sends the client credentials as form parameters instead of HTTP basic
+		// authentication.
+		AuthInParams bool
+		// RefreshBefore is the time before expiry in which a token is refreshed in the
+		// background. Defaults to one minute.
+		RefreshBefore time.Duration
+		// Client fetches the tokens. Defaults to a client using NewTransport with a timeout of
+		// 30 seconds.
+		Client *http.Client
+	}
+
+	// ClientCredentialsSource fetches tokens with the OAuth2 client credentials grant and caches
+	// them until shortly before they expire.
+	ClientCredentialsSource struct {
+		config ClientCredentialsConfig
+
+		mu         sync.Mutex
+		token      *Token
+		refreshing bool
+		// fetching is closed once the current synchronous fetch finished.
+		fetching chan struct{}
+	}
+
+	// BearerTransport authorizes requests with tokens of its TokenSource. A request rejected
+	// with 401 is retried once with a fresh token.
+	BearerTransport struct {
+		Base   http.RoundTripper
+		Source TokenSource
+	}
+
+	tokenResponse struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+)
+
+var _ TokenSource = &ClientCredentialsSource{}
+
+func NewClientCredentialsSource(config ClientCredentialsConfig) *ClientCredentialsSource {
+	if config.RefreshBefore <= 0 {
+		config.RefreshBefore = time.Minute
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Transport: NewTransport(), Timeout: 30 * time.Second}
+	}
+	return &ClientCredentialsSource{config: config}
+}
+
+// Token returns the cached token while it is valid. Within the refresh window the cached token
+// is returned and a new one is fetched in the background.
+func (s *ClientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+
+		if token := s.token; token != nil && (token.ExpiresAt.IsZero() || now.Before(token.ExpiresAt)) {
+			if !token.ExpiresAt.IsZero() && now.After(token.ExpiresAt.Add(-s.config.RefreshBefore)) && !s.refreshing {
+				s.refreshing = true
+				recovery.Go("ClientCredentialsSource", s.refresh)
+			}
+			s.mu.Unlock()
+			return token, nil
+		}
+
+		if fetching := s.fetching; fetching != nil {
+			s.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-fetching:
+				continue
+			}
+		}
+
+		fetching := make(chan struct{})
+		s.fetching = fetching
+		s.mu.Unlock()
+
+		token, err := s.fetch(ctx)
+
+		s.mu.Lock()
+		if err == nil {
+			s.token = token
+		}
+		s.fetching = nil
+		close(fetching)
+		s.mu.Unlock()
+
+		return token, err
+	}
+}
+
+func (s *ClientCredentialsSource) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Client.Timeout+time.Second)
+	defer cancel()
+
+	token, err := s.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshing = false
+	if err == nil {
+		s.token = token
+	}
+}
+
+// Invalidate discards the token if it is still the cached one.
+func (s *ClientCredentialsSource) Invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+func (s *ClientCredentialsSource) fetch(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	for key, values := range s.config.EndpointParams {
+		form[key] = values
+	}
+	if len(s.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(s.config.Scopes, " "))
+	}
+	if s.config.AuthInParams {
+		form.Set("client_id", s.config.ClientID)
+		form.Set("client_secret", s.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !s.config.AuthInParams {
+		req.SetBasicAuth(url.QueryEscape(s.config.ClientID), url.QueryEscape(s.config.ClientSecret))
+	}
+
+	requestedAt := time.Now()
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResp.Error != "" {
+		if tokenResp.Error != "" {
+			return nil, fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response contains no access token")
+	}
+
+	token := &Token{AccessToken: tokenResp.AccessToken, TokenType: tokenResp.TokenType}
+	if tokenResp.ExpiresIn > 0 {
+		token.ExpiresAt = requestedAt.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+func NewBearerTransport(base http.RoundTripper, source TokenSource) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &BearerTransport{Base: base, Source: source}
+}
+
+func (t *BearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Source.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.Base.RoundTrip(authorize(req, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// A body that cannot be rewound has been consumed by the first attempt.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+
+	t.Source.Invalidate(token)
+	fresh, err := t.Source.Token(req.Context())
+	if err != nil {
+		return resp, nil
+	}
+
+	retry := authorize(req, fresh)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return t.Base.RoundTrip(retry)
+}
+
+func authorize(req *http.Request, token *Token) *http.Request {
+	clonedReq := req.Clone(req.Context())
+
+	tokenType := token.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	clonedReq.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+	return clonedReq
+}
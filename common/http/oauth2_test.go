@@ -0,0 +1,202 @@
+package http_client_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tokenServer issues numbered tokens to the client "client" with the secret "secret".
+type tokenServer struct {
+	*httptest.Server
+	expiresIn int
+
+	mu     sync.Mutex
+	issued int
+}
+
+func (s *tokenServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	clientId, clientSecret, ok := r.BasicAuth()
+	if !ok || clientId != "client" || clientSecret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "events:write config:read" {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	s.issued++
+	token := fmt.Sprintf("token-%d", s.issued)
+	s.mu.Unlock()
+
+	json.NewEncoder(w).Encode(map[string]any{"access_token": token, "token_type": "bearer", "expires_in": s.expiresIn})
+}
+
+func (s *tokenServer) issuedTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.issued
+}
+
+func (s *tokenServer) config() commonHttp.ClientCredentialsConfig {
+	return commonHttp.ClientCredentialsConfig{
+		TokenURL:     s.URL,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Scopes:       []string{"events:write", "config:read"},
+	}
+}
+
+func TestBearerTransport_CachesToken(t *testing.T) {
+	// given
+	tokens := &tokenServer{expiresIn: 3600}
+	tokens.Server = httptest.NewServer(tokens)
+	defer tokens.Close()
+
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+
+	client := commonHttp.NewClient(commonHttp.WithOAuth2ClientCredentials(tokens.config()))
+
+	// when
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// then
+	assert.Equal(t, 1, tokens.issuedTokens())
+	assert.Equal(t, []string{"Bearer token-1", "Bearer token-1", "Bearer token-1"}, authorizations)
+}
+
+func TestBearerTransport_RetriesUnauthorizedOnce(t *testing.T) {
+	// given
+	tokens := &tokenServer{expiresIn: 3600}
+	tokens.Server = httptest.NewServer(tokens)
+	defer tokens.Close()
+
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client := commonHttp.NewClient(commonHttp.WithOAuth2ClientCredentials(tokens.config()))
+
+	// when
+	resp, err := client.Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, tokens.issuedTokens())
+	assert.Equal(t, []string{"payload", "payload"}, bodies)
+}
+
+func TestBearerTransport_ReturnsPersistentUnauthorized(t *testing.T) {
+	// given
+	tokens := &tokenServer{expiresIn: 3600}
+	tokens.Server = httptest.NewServer(tokens)
+	defer tokens.Close()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client := commonHttp.NewClient(commonHttp.WithOAuth2ClientCredentials(tokens.config()))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 2, requests)
+}
+
+func TestClientCredentialsSource_RefreshesInBackground(t *testing.T) {
+	// given
+	tokens := &tokenServer{expiresIn: 60}
+	tokens.Server = httptest.NewServer(tokens)
+	defer tokens.Close()
+
+	// Every token is within the refresh window as soon as it has been issued.
+	config := tokens.config()
+	config.RefreshBefore = time.Minute
+	source := commonHttp.NewClientCredentialsSource(config)
+
+	first, err := source.Token(t.Context())
+	require.NoError(t, err)
+
+	// when
+	cached, err := source.Token(t.Context())
+
+	// then
+	require.NoError(t, err)
+	assert.Same(t, first, cached, "expected the cached token while it is still valid")
+	require.Eventually(t, func() bool { return tokens.issuedTokens() == 2 }, time.Second, 10*time.Millisecond)
+
+	refreshed, err := source.Token(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, "token-2", refreshed.AccessToken)
+}
+
+func TestWithTransportMiddleware_WrapsInOrder(t *testing.T) {
+	// given
+	var order []string
+	middleware := func(name string) commonHttp.TransportMiddleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(r)
+			})
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := commonHttp.NewClient(commonHttp.WithTransportMiddleware(middleware("first"), middleware("second")))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{"first", "second"}, order)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,193 @@
+package http_client
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type (
+	// ObjectStoreConfig configures access to an S3 compatible object store.
+	ObjectStoreConfig struct {
+		// Endpoint is the base url of the store, e.g. "https://s3.eu-central-1.amazonaws.com"
+		// or "http://minio:9000". Buckets are addressed path-style.
+		Endpoint        string
+		Region          string
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string
+		// Client sends the signed requests. Defaults to a client using NewTransport.
+		Client *http.Client
+	}
+
+	// ObjectStoreTransport serves URLs like "s3://bucket/key" from an S3 compatible object store.
+	// Requests are signed with AWS signature version 4.
+	ObjectStoreTransport struct {
+		config   ObjectStoreConfig
+		endpoint *url.URL
+		now      func() time.Time
+	}
+)
+
+const (
+	amzDateFormat = "20060102T150405Z"
+	// emptyPayloadHash is the SHA-256 hash of an empty body, which GET and HEAD requests have.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+func NewObjectStoreTransport(config ObjectStoreConfig) (*ObjectStoreTransport, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid object store endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Transport: NewTransport(), Timeout: 5 * time.Minute}
+	}
+
+	return &ObjectStoreTransport{config: config, endpoint: endpoint, now: time.Now}, nil
+}
+
+func (t *ObjectStoreTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	closeBody(req)
+
+	if req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return newResponse(req, http.StatusMethodNotAllowed, nil, 0, nil), nil
+	}
+	bucket, key := req.URL.Host, strings.TrimPrefix(req.URL.Path, "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("object url %q must contain bucket and key", req.URL.Redacted())
+	}
+
+	// The path is escaped as the signature requires, so that the store computes the same
+	// canonical request from the path it receives.
+	segments := strings.Split(bucket+"/"+key, "/")
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = awsEscape(segment)
+	}
+	objectURL := *t.endpoint
+	objectURL.Path = strings.TrimSuffix(t.endpoint.Path, "/") + "/" + bucket + "/" + key
+	objectURL.RawPath = strings.TrimSuffix(t.endpoint.EscapedPath(), "/") + "/" + strings.Join(escaped, "/")
+	objectURL.RawQuery = req.URL.RawQuery
+
+	objectReq, err := http.NewRequestWithContext(req.Context(), req.Method, objectURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"Range", "If-None-Match", "If-Modified-Since"} {
+		if value := req.Header.Get(name); value != "" {
+			objectReq.Header.Set(name, value)
+		}
+	}
+
+	if err := t.sign(objectReq); err != nil {
+		return nil, err
+	}
+
+	resp, err := t.config.Client.Do(objectReq)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// sign adds the headers of AWS signature version 4. Credentials are optional, requests to
+// public buckets are sent unsigned.
+func (t *ObjectStoreTransport) sign(req *http.Request) error {
+	if t.config.AccessKeyID == "" {
+		return nil
+	}
+	if t.config.SecretAccessKey == "" {
+		return errors.New("object store secret access key is missing")
+	}
+
+	now := t.now().UTC()
+	amzDate := now.Format(amzDateFormat)
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", emptyPayloadHash)
+	if t.config.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", t.config.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	scope := date + "/" + t.config.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+t.config.SecretAccessKey), date)
+	key = hmacSHA256(key, t.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		t.config.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, awsEscape(key)+"="+awsEscape(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsEscape percent-encodes everything except unreserved characters, as required by the
+// signature.
+func awsEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -1,51 +1,230 @@
 package http_client
 
 import (
+	"errors"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
+
+	"github.com/dtomschitz/headless-go-client/metrics"
 )
 
-type RetryTransport struct {
-	base         http.RoundTripper
-	retryCount   int
-	retryBackoff time.Duration
+type (
+	// RetryPolicy controls which requests the RetryTransport retries and how long it waits in
+	// between.
+	RetryPolicy struct {
+		// MaxRetries is the number of retries after the first attempt. Unlike the other fields it
+		// is used as given, so that zero disables retries. Negative values select the default.
+		MaxRetries int
+		// BaseBackoff is the upper bound of the delay before the first retry. It doubles with
+		// every further retry, the actual delay is chosen at random below it (full jitter).
+		BaseBackoff time.Duration
+		// MaxBackoff caps the upper bound of the delay.
+		MaxBackoff time.Duration
+		// RetryableStatusCodes are the response codes which are retried.
+		RetryableStatusCodes []int
+		// MaxRetryAfter is the longest Retry-After the transport waits for. Responses asking for
+		// a longer delay are returned to the caller.
+		MaxRetryAfter time.Duration
+		// RetryNonIdempotent retries requests with non-idempotent methods on retryable responses.
+		// Such requests are always retried on transport errors.
+		RetryNonIdempotent bool
+		// Hook is called after every attempt.
+		Hook RetryHook
+	}
+
+	// RetryAttempt describes a finished attempt of the RetryTransport.
+	RetryAttempt struct {
+		Request *http.Request
+		// Attempt starts at 1 for the first attempt.
+		Attempt  int
+		Response *http.Response
+		Err      error
+		// Retry reports whether the request is retried after Delay.
+		Retry bool
+		Delay time.Duration
+	}
+
+	RetryHook func(attempt RetryAttempt)
+
+	RetryTransport struct {
+		base   http.RoundTripper
+		policy RetryPolicy
+	}
+)
+
+// IdempotencyKeyHeader marks requests with non-idempotent methods as safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:  3,
+	BaseBackoff: 500 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+	RetryableStatusCodes: []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+	MaxRetryAfter: 30 * time.Second,
 }
 
 func NewRetryTransport(base http.RoundTripper, retryCount int, retryBackoff time.Duration) http.RoundTripper {
+	policy := DefaultRetryPolicy
+	policy.MaxRetries = retryCount
+	policy.BaseBackoff = retryBackoff
+	return NewRetryTransportWithPolicy(base, policy)
+}
+
+// NewRetryTransportWithPolicy returns a RetryTransport using the policy. Unset fields of the
+// policy except MaxRetries fall back to DefaultRetryPolicy. To change single fields, start
+// from a copy of DefaultRetryPolicy.
+func NewRetryTransportWithPolicy(base http.RoundTripper, policy RetryPolicy) http.RoundTripper {
 	if base == nil {
 		base = http.DefaultTransport
 	}
-	if retryCount < 0 {
-		retryCount = 3
+	if policy.MaxRetries < 0 {
+		policy.MaxRetries = DefaultRetryPolicy.MaxRetries
+	}
+	if policy.BaseBackoff <= 0 {
+		policy.BaseBackoff = DefaultRetryPolicy.BaseBackoff
 	}
-	if retryBackoff <= 0 {
-		retryBackoff = 500 * time.Millisecond
+	if policy.MaxBackoff < policy.BaseBackoff {
+		policy.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, policy.BaseBackoff)
+	}
+	if policy.RetryableStatusCodes == nil {
+		policy.RetryableStatusCodes = DefaultRetryPolicy.RetryableStatusCodes
+	}
+	if policy.MaxRetryAfter <= 0 {
+		policy.MaxRetryAfter = DefaultRetryPolicy.MaxRetryAfter
 	}
 
 	return &RetryTransport{
-		base:         base,
-		retryCount:   retryCount,
-		retryBackoff: retryBackoff,
+		base:   base,
+		policy: policy,
 	}
 }
 
 func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	clonedReq := req.Clone(req.Context())
+	ctx := req.Context()
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
 
-	var lastErr error
-	for attempt := 0; attempt <= t.retryCount; attempt++ {
-		resp, err := t.base.RoundTrip(clonedReq)
-		if err == nil {
-			return resp, nil
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.Clone(ctx)
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
 		}
-		lastErr = err
 
+		resp, err := t.base.RoundTrip(attemptReq)
+
+		delay, retry := t.shouldRetry(req, resp, err, attempt)
+		retry = retry && rewindable
+		if deadline, ok := ctx.Deadline(); retry && ok && time.Until(deadline) < delay {
+			retry = false
+		}
+
+		if t.policy.Hook != nil {
+			t.policy.Hook(RetryAttempt{Request: req, Attempt: attempt, Response: resp, Err: err, Retry: retry, Delay: delay})
+		}
+		if !retry {
+			return resp, err
+		}
+		metrics.DefaultRegistry.Counter("http_client_retries_total", "Number of retried HTTP requests.", metrics.Labels{"host": req.URL.Host}).Inc()
+
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
 		select {
-		case <-clonedReq.Context().Done():
-			return nil, clonedReq.Context().Err()
-		case <-time.After(t.retryBackoff):
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
 		}
 	}
+}
+
+// shouldRetry decides whether the attempt is retried and how long to wait before. A Retry-After
+// header of the response takes precedence over the backoff of the policy.
+func (t *RetryTransport) shouldRetry(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt > t.policy.MaxRetries {
+		return 0, false
+	}
+	if err != nil {
+		return t.backoff(attempt), req.Context().Err() == nil && !errors.Is(err, ErrCircuitOpen)
+	}
+
+	if !slices.Contains(t.policy.RetryableStatusCodes, resp.StatusCode) {
+		return 0, false
+	}
+	if !t.policy.RetryNonIdempotent && !isIdempotent(req) {
+		return 0, false
+	}
+
+	if retryAfter, ok := ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return retryAfter, retryAfter <= t.policy.MaxRetryAfter
+	}
+	return t.backoff(attempt), true
+}
+
+func (t *RetryTransport) backoff(retry int) time.Duration {
+	return Backoff(t.policy.BaseBackoff, t.policy.MaxBackoff, retry)
+}
+
+// Backoff returns the delay before the given retry, starting at 1, using exponential backoff
+// with full jitter. The upper bound starts at base, doubles with every retry and is capped at
+// maxDelay.
+func Backoff(base, maxDelay time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 1; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int64N(int64(delay) + 1))
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// ParseRetryAfter parses a Retry-After header given in seconds or as HTTP date. Dates in the
+// past result in a delay of zero.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
 
-	return nil, lastErr
+	return 0, false
 }
@@ -0,0 +1,248 @@
+package http_client_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = commonHttp.RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+// statusServer answers with the given statuses in order and with 200 afterwards. It records the
+// bodies of all requests.
+type statusServer struct {
+	*httptest.Server
+	statuses []int
+
+	mu     sync.Mutex
+	bodies []string
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	s.mu.Lock()
+	s.bodies = append(s.bodies, string(body))
+	status := http.StatusOK
+	if len(s.bodies) <= len(s.statuses) {
+		status = s.statuses[len(s.bodies)-1]
+	}
+	s.mu.Unlock()
+
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "1")
+	}
+	w.WriteHeader(status)
+}
+
+func (s *statusServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.bodies...)
+}
+
+func TestRetryTransport_RetriesRetryableStatus(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusServiceUnavailable, http.StatusBadGateway}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+
+	var attempts []commonHttp.RetryAttempt
+	client := commonHttp.NewClient(commonHttp.WithRetryPolicy(testRetryPolicy), commonHttp.WithRetryHook(func(attempt commonHttp.RetryAttempt) {
+		attempts = append(attempts, attempt)
+	}))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, server.received(), 3)
+
+	require.Len(t, attempts, 3)
+	assert.Equal(t, http.StatusServiceUnavailable, attempts[0].Response.StatusCode)
+	assert.True(t, attempts[0].Retry)
+	assert.Equal(t, 3, attempts[2].Attempt)
+	assert.False(t, attempts[2].Retry)
+}
+
+func TestRetryTransport_ReturnsLastResponseWhenExhausted(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	client := commonHttp.NewClient(commonHttp.WithRetryPolicy(testRetryPolicy))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Len(t, server.received(), 3)
+}
+
+func TestRetryTransport_HonoursRetryAfter(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusTooManyRequests}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	client := commonHttp.NewClient(commonHttp.WithRetryPolicy(testRetryPolicy))
+
+	// when
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, server.received(), 2)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+}
+
+func TestRetryTransport_ReturnsRetryAfterAboveMaximum(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusTooManyRequests}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	policy := testRetryPolicy
+	policy.MaxRetryAfter = 500 * time.Millisecond
+	client := commonHttp.NewClient(commonHttp.WithRetryPolicy(policy))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Len(t, server.received(), 1)
+}
+
+func TestRetryTransport_RetriesNonIdempotentOnlyWithKey(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	client := commonHttp.NewClient(commonHttp.WithRetryPolicy(testRetryPolicy))
+
+	// when
+	resp, err := client.Post(server.URL, "text/plain", bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewBufferString("payload"))
+	require.NoError(t, err)
+	req.Header.Set(commonHttp.IdempotencyKeyHeader, "batch-1")
+	keyedResp, err := client.Do(req)
+	require.NoError(t, err)
+	keyedResp.Body.Close()
+
+	// then
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, http.StatusOK, keyedResp.StatusCode)
+	assert.Equal(t, []string{"payload", "payload", "payload"}, server.received())
+}
+
+func TestRetryTransport_RewindsBodyAfterTransportError(t *testing.T) {
+	// given
+	var bodies []string
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			return nil, errors.New("connection reset")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: r}, nil
+	})
+	client := &http.Client{Transport: commonHttp.NewRetryTransportWithPolicy(base, testRetryPolicy)}
+
+	// when
+	resp, err := client.Post("http://backend/api/v1/events", "application/json", bytes.NewBufferString(`[{"id":"1"}]`))
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, []string{`[{"id":"1"}]`, `[{"id":"1"}]`}, bodies)
+}
+
+func TestRetryTransport_DoesNotRetryUnrewindableBody(t *testing.T) {
+	// given
+	attempts := 0
+	base := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, errors.New("connection reset")
+	})
+	transport := commonHttp.NewRetryTransportWithPolicy(base, testRetryPolicy)
+
+	req, err := http.NewRequest(http.MethodPost, "http://backend", io.NopCloser(bytes.NewBufferString("payload")))
+	require.NoError(t, err)
+
+	// when
+	_, err = transport.RoundTrip(req)
+
+	// then
+	assert.Error(t, err)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWithRetryHook_IsKeptByWithRetryPolicy(t *testing.T) {
+	// given
+	server := &statusServer{statuses: []int{http.StatusServiceUnavailable}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+
+	var hookAttempts, policyAttempts int
+	policy := testRetryPolicy
+	policy.Hook = func(commonHttp.RetryAttempt) { policyAttempts++ }
+	client := commonHttp.NewClient(commonHttp.WithRetryHook(func(commonHttp.RetryAttempt) { hookAttempts++ }), commonHttp.WithRetryPolicy(policy))
+
+	// when
+	resp, err := client.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 2, hookAttempts)
+	assert.Equal(t, 2, policyAttempts)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "3", expected: 3 * time.Second, ok: true},
+		{value: "-1", ok: false},
+		{value: now.Add(time.Minute).Format(http.TimeFormat), expected: time.Minute, ok: true},
+		{value: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0, ok: true},
+		{value: "soon", ok: false},
+	} {
+		t.Run(test.value, func(t *testing.T) {
+			// when
+			delay, ok := commonHttp.ParseRetryAfter(test.value, now)
+
+			// then
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, delay)
+		})
+	}
+}
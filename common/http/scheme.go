@@ -0,0 +1,325 @@
+package http_client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type (
+	// SchemeRegistry maps URL schemes other than http and https to the transports serving them,
+	// so that manifests and artifacts can be fetched from sources such as mounted drives or
+	// object stores by the same clients.
+	SchemeRegistry struct {
+		mu         sync.RWMutex
+		transports map[string]http.RoundTripper
+	}
+
+	// SchemeTransport sends http and https requests through HTTP and dispatches all other
+	// requests to the transport registered for their scheme.
+	SchemeTransport struct {
+		HTTP     http.RoundTripper
+		Registry *SchemeRegistry
+	}
+
+	// DirectoryTransport serves files below Root, e.g. a mirror of the update server on a USB
+	// stick. The host and path of the URL are resolved relative to Root.
+	DirectoryTransport struct {
+		Root string
+	}
+
+	fileTransport struct{}
+
+	dataTransport struct{}
+)
+
+// DefaultSchemeRegistry is used by every client created by NewClient unless configured
+// otherwise. It is empty until schemes are registered, e.g. with
+// RegisterScheme("file", NewFileTransport()).
+var DefaultSchemeRegistry = NewSchemeRegistry()
+
+// NewSchemeRegistry returns an empty registry. Local files and data URLs are only served once
+// NewFileTransport and NewDataTransport have been registered, so that URLs of manifests
+// cannot point the client to local files unless this is wanted.
+func NewSchemeRegistry() *SchemeRegistry {
+	return &SchemeRegistry{transports: make(map[string]http.RoundTripper)}
+}
+
+// NewFileTransport returns a transport serving file URLs of the local host, e.g.
+// file:///media/usb/manifest.json. Use NewDirectoryTransport to confine access to a directory.
+func NewFileTransport() http.RoundTripper {
+	return &fileTransport{}
+}
+
+// NewDataTransport returns a transport decoding RFC 2397 data URLs.
+func NewDataTransport() http.RoundTripper {
+	return &dataTransport{}
+}
+
+// RegisterScheme registers the transport for the scheme in DefaultSchemeRegistry.
+func RegisterScheme(scheme string, transport http.RoundTripper) error {
+	return DefaultSchemeRegistry.Register(scheme, transport)
+}
+
+// Register sets the transport of the scheme, replacing a previous one. The http and https
+// schemes cannot be registered.
+func (r *SchemeRegistry) Register(scheme string, transport http.RoundTripper) error {
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || scheme == "http" || scheme == "https" {
+		return fmt.Errorf("scheme %q cannot be registered", scheme)
+	}
+	if transport == nil {
+		return errors.New("transport cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.transports[scheme] = transport
+	return nil
+}
+
+// Transport returns the transport registered for the scheme.
+func (r *SchemeRegistry) Transport(scheme string) (http.RoundTripper, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transport, ok := r.transports[strings.ToLower(scheme)]
+	return transport, ok
+}
+
+func NewSchemeTransport(httpTransport http.RoundTripper, registry *SchemeRegistry) http.RoundTripper {
+	if httpTransport == nil {
+		httpTransport = http.DefaultTransport
+	}
+	if registry == nil {
+		registry = DefaultSchemeRegistry
+	}
+	return &SchemeTransport{HTTP: httpTransport, Registry: registry}
+}
+
+func (t *SchemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch scheme := strings.ToLower(req.URL.Scheme); scheme {
+	case "http", "https":
+		return t.HTTP.RoundTrip(req)
+	default:
+		transport, ok := t.Registry.Transport(scheme)
+		if !ok {
+			closeBody(req)
+			return nil, fmt.Errorf("unsupported url scheme %q", scheme)
+		}
+		return transport.RoundTrip(req)
+	}
+}
+
+// NewDirectoryTransport returns a transport serving the files below root.
+func NewDirectoryTransport(root string) *DirectoryTransport {
+	return &DirectoryTransport{Root: root}
+}
+
+func (t *DirectoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Cleaning the rooted path removes ".." elements, so that files outside of Root cannot be
+	// served.
+	name := path.Clean("/" + path.Join(req.URL.Host, req.URL.Path))
+	return serveFile(req, filepath.Join(t.Root, filepath.FromSlash(name)))
+}
+
+func (t *fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host := req.URL.Host; host != "" && host != "localhost" {
+		closeBody(req)
+		return nil, fmt.Errorf("file url with remote host %q is not supported", host)
+	}
+	return serveFile(req, filepath.FromSlash(req.URL.Path))
+}
+
+// serveFile answers GET and HEAD requests with the content of the file. A single byte range
+// is served as partial content, so that downloads can be resumed.
+func serveFile(req *http.Request, name string) (*http.Response, error) {
+	closeBody(req)
+
+	if req.Method != "" && req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return newResponse(req, http.StatusMethodNotAllowed, nil, 0, nil), nil
+	}
+
+	file, err := os.Open(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return newResponse(req, http.StatusNotFound, nil, 0, nil), nil
+	}
+	if errors.Is(err, os.ErrPermission) {
+		return newResponse(req, http.StatusForbidden, nil, 0, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return newResponse(req, http.StatusNotFound, nil, 0, nil), nil
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", ContentTypeByName(name))
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+
+	size := info.Size()
+	status, start, length := http.StatusOK, int64(0), size
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		var ok bool
+		if start, length, ok = parseRange(rangeHeader, size); !ok {
+			file.Close()
+			header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			return newResponse(req, http.StatusRequestedRangeNotSatisfiable, header, 0, nil), nil
+		}
+		status = http.StatusPartialContent
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	}
+
+	if req.Method == http.MethodHead {
+		file.Close()
+		return newResponse(req, status, header, length, nil), nil
+	}
+
+	body := struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, start, length), file}
+	return newResponse(req, status, header, length, body), nil
+}
+
+// parseRange parses a single range of a Range header, e.g. "bytes=0-99", "bytes=100-" or
+// "bytes=-100". It returns the start and length of the range within the content.
+func parseRange(value string, size int64) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(value, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		suffix = min(suffix, size)
+		return size - suffix, suffix, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		end = min(end, size-1)
+	}
+	return start, end - start + 1, true
+}
+
+// RoundTrip decodes RFC 2397 data URLs, e.g. "data:application/json;base64,e30=".
+func (t *dataTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	closeBody(req)
+
+	raw := req.URL.Opaque
+	if raw == "" {
+		raw = strings.TrimPrefix(req.URL.String(), "data:")
+	}
+	mediaType, encoded, ok := strings.Cut(raw, ",")
+	if !ok {
+		return nil, errors.New("data url contains no data")
+	}
+
+	data, err := url.PathUnescape(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data url: %w", err)
+	}
+
+	content := []byte(data)
+	if base, isBase64 := strings.CutSuffix(mediaType, ";base64"); isBase64 {
+		mediaType = base
+		if content, err = base64.StdEncoding.DecodeString(data); err != nil {
+			return nil, fmt.Errorf("invalid base64 data url: %w", err)
+		}
+	}
+	if mediaType == "" || strings.HasPrefix(mediaType, ";") {
+		mediaType = "text/plain" + mediaType
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+
+	var body io.ReadCloser
+	if req.Method != http.MethodHead {
+		body = io.NopCloser(bytes.NewReader(content))
+	}
+	return newResponse(req, http.StatusOK, header, int64(len(content)), body), nil
+}
+
+func newResponse(req *http.Request, status int, header http.Header, length int64, body io.ReadCloser) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	if body == nil {
+		body = http.NoBody
+	}
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+		Request:       req,
+	}
+}
+
+// ContentTypeByName returns the media type of the file extension, so that config codecs are
+// selected for local files as for HTTP responses.
+func ContentTypeByName(name string) string {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		return "application/json"
+	case ".yaml", ".yml":
+		return "application/yaml"
+	case ".toml":
+		return "application/toml"
+	case ".env":
+		return "text/x-dotenv"
+	default:
+		if contentType := mime.TypeByExtension(ext); contentType != "" {
+			return contentType
+		}
+		return "application/octet-stream"
+	}
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,227 @@
+package http_client_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, client *http.Client, url string, header ...string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestSchemeTransport_ServesFileURLs(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("port: 8080\n"), 0o600))
+	registry := commonHttp.NewSchemeRegistry()
+	require.NoError(t, registry.Register("file", commonHttp.NewFileTransport()))
+	client := commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry))
+
+	// when
+	resp, body := get(t, client, "file://"+filepath.ToSlash(path))
+	rangeResp, rangeBody := get(t, client, "file://"+filepath.ToSlash(path), "Range", "bytes=6-")
+	missing, _ := get(t, client, "file://"+filepath.ToSlash(filepath.Join(dir, "missing.json")))
+
+	// then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/yaml", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "port: 8080\n", body)
+
+	assert.Equal(t, http.StatusPartialContent, rangeResp.StatusCode)
+	assert.Equal(t, "bytes 6-10/11", rangeResp.Header.Get("Content-Range"))
+	assert.Equal(t, "8080\n", rangeBody)
+
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+}
+
+func TestSchemeTransport_ServesDataURLs(t *testing.T) {
+	// given
+	registry := commonHttp.NewSchemeRegistry()
+	require.NoError(t, registry.Register("data", commonHttp.NewDataTransport()))
+	client := commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry))
+
+	// when
+	resp, body := get(t, client, "data:application/json;base64,eyJwb3J0Ijo4MDgwfQ==")
+	plainResp, plainBody := get(t, client, "data:,hello%20world")
+
+	// then
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `{"port":8080}`, body)
+	assert.Equal(t, "text/plain", plainResp.Header.Get("Content-Type"))
+	assert.Equal(t, "hello world", plainBody)
+}
+
+func TestDirectoryTransport_ConfinesToRoot(t *testing.T) {
+	// given
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "updates"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "updates", "client-1.2.0"), []byte("binary"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(root), "secret"), []byte("secret"), 0o600))
+
+	registry := commonHttp.NewSchemeRegistry()
+	require.NoError(t, registry.Register("usb", commonHttp.NewDirectoryTransport(root)))
+	client := commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry))
+
+	// when
+	resp, body := get(t, client, "usb://updates/client-1.2.0")
+	escaped, _ := get(t, client, "usb:///../secret")
+
+	// then
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "binary", body)
+	assert.Equal(t, http.StatusNotFound, escaped.StatusCode)
+}
+
+func TestSchemeTransport_RejectsUnknownScheme(t *testing.T) {
+	// given
+	client := commonHttp.NewClient()
+
+	// when
+	_, err := client.Get("ftp://mirror/update")
+	_, fileErr := client.Get("file:///etc/hostname")
+	_, dataErr := client.Get("data:,hello")
+
+	// then
+	assert.ErrorContains(t, err, `unsupported url scheme "ftp"`)
+	assert.ErrorContains(t, fileErr, `unsupported url scheme "file"`, "expected file urls to be opt-in")
+	assert.ErrorContains(t, dataErr, `unsupported url scheme "data"`, "expected data urls to be opt-in")
+	assert.Error(t, commonHttp.NewSchemeRegistry().Register("https", commonHttp.NewDirectoryTransport("/")))
+}
+
+func TestNewClient_DoesNotFollowRedirectsToOtherSchemes(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "hostname")
+	require.NoError(t, os.WriteFile(path, []byte("device"), 0o600))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/local" {
+			http.Redirect(w, r, "file://"+filepath.ToSlash(path), http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, "/local", http.StatusFound)
+	}))
+	defer server.Close()
+
+	registry := commonHttp.NewSchemeRegistry()
+	require.NoError(t, registry.Register("file", commonHttp.NewFileTransport()))
+	client := commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry))
+
+	// when
+	_, err := client.Get(server.URL + "/manifest.json")
+
+	// then
+	assert.ErrorContains(t, err, `redirect to url scheme "file" is not allowed`)
+}
+
+func TestObjectStoreTransport_SignsRequests(t *testing.T) {
+	// given
+	var requests []*http.Request
+	store := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if !verifySigV4(t, r, "secret") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path != "/updates/client/1.2.0.bin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-3/6")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("bina"))
+	}))
+	defer store.Close()
+
+	transport, err := commonHttp.NewObjectStoreTransport(commonHttp.ObjectStoreConfig{
+		Endpoint:        store.URL,
+		Region:          "eu-central-1",
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+	registry := commonHttp.NewSchemeRegistry()
+	require.NoError(t, registry.Register("s3", transport))
+	client := commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry))
+
+	// when
+	resp, body := get(t, client, "s3://updates/client/1.2.0.bin", "Range", "bytes=0-3")
+
+	// then
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "bina", body)
+	require.Len(t, requests, 1)
+	assert.Contains(t, requests[0].Header.Get("Authorization"), "Credential=access/")
+	assert.Contains(t, requests[0].Header.Get("Authorization"), "/eu-central-1/s3/aws4_request")
+	assert.Contains(t, requests[0].Header.Get("Authorization"), "SignedHeaders=host;range;x-amz-content-sha256;x-amz-date")
+}
+
+// verifySigV4 recomputes the signature of a request without query parameters, as a stand-in
+// for an S3 compatible store would.
+func verifySigV4(t *testing.T, r *http.Request, secret string) bool {
+	t.Helper()
+
+	authorization := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+	fields := map[string]string{}
+	for _, field := range strings.Split(authorization, ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		fields[name] = value
+	}
+	scope := strings.SplitN(fields["Credential"], "/", 2)[1]
+	scopeParts := strings.Split(scope, "/")
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	sort.Strings(signedHeaders)
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + value + "\n")
+	}
+
+	canonical := strings.Join([]string{r.Method, r.URL.EscapedPath(), "", canonicalHeaders.String(), strings.Join(signedHeaders, ";"), r.Header.Get("x-amz-content-sha256")}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + r.Header.Get("x-amz-date") + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + secret)
+	for _, part := range append(scopeParts[:3], "aws4_request") {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("x-amz-date"))
+	return err == nil && time.Since(date) < time.Minute && hex.EncodeToString(mac.Sum(nil)) == fields["Signature"]
+}
@@ -0,0 +1,206 @@
+package http_client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// PoolConfig tunes the connection pool of the transport. Zero values keep the defaults of
+	// http.DefaultTransport.
+	PoolConfig struct {
+		MaxIdleConns        int
+		MaxIdleConnsPerHost int
+		MaxConnsPerHost     int
+		IdleConnTimeout     time.Duration
+	}
+
+	// errorTransport fails every request with the error of an invalid configuration.
+	errorTransport struct {
+		err error
+	}
+)
+
+var (
+	defaultOptionsMu sync.RWMutex
+	defaultOptions   []Option
+)
+
+// SetDefaultOptions sets options applied to every client created afterwards by NewClient and
+// NewTransport before their own options, e.g. the proxy and CA bundle of a site. This includes
+// the clients the services of this library create for themselves.
+func SetDefaultOptions(opts ...Option) {
+	defaultOptionsMu.Lock()
+	defer defaultOptionsMu.Unlock()
+	defaultOptions = append([]Option(nil), opts...)
+}
+
+func newConfig(opts []Option) *config {
+	config := &config{
+		timeout:     60 * time.Second,
+		retryPolicy: DefaultRetryPolicy,
+		breakers:    DefaultCircuitBreakers,
+		schemes:     DefaultSchemeRegistry,
+	}
+
+	defaultOptionsMu.RLock()
+	for _, o := range defaultOptions {
+		o(config)
+	}
+	defaultOptionsMu.RUnlock()
+
+	for _, o := range opts {
+		o(config)
+	}
+	return config
+}
+
+// NewTransport returns the network transport NewClient builds on, configured with the proxy,
+// TLS and connection pool options. Authentication, retries and circuit breaking are not part
+// of it, which makes it suitable for clients fetching credentials, e.g. the token client of a
+// ClientCredentialsSource.
+func NewTransport(opts ...Option) http.RoundTripper {
+	return newBaseTransport(newConfig(opts))
+}
+
+// newBaseTransport returns http.DefaultTransport unless the config requires a dedicated one.
+// Invalid configurations result in a transport failing every request.
+func newBaseTransport(c *config) http.RoundTripper {
+	if c.proxy == "" && len(c.rootCAFiles) == 0 && len(c.pins) == 0 && c.minTLSVersion == 0 && c.pool == nil && c.certFile == "" {
+		return http.DefaultTransport
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.proxy != "" {
+		proxyURL, err := url.Parse(c.proxy)
+		if err != nil {
+			return &errorTransport{err: fmt.Errorf("invalid proxy url: %w", err)}
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+			transport.Proxy = http.ProxyURL(proxyURL)
+		default:
+			return &errorTransport{err: fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)}
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.minTLSVersion != 0 {
+		tlsConfig.MinVersion = c.minTLSVersion
+	}
+	if len(c.rootCAFiles) > 0 {
+		rootCAs, err := loadRootCAs(c.rootCAFiles)
+		if err != nil {
+			return &errorTransport{err: err}
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if len(c.pins) > 0 {
+		tlsConfig.VerifyConnection = verifyPins(c.pins)
+	}
+	if c.certFile != "" {
+		tlsConfig.GetClientCertificate = newCertificateLoader(c.certFile, c.keyFile).GetClientCertificate
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if pool := c.pool; pool != nil {
+		if pool.MaxIdleConns > 0 {
+			transport.MaxIdleConns = pool.MaxIdleConns
+		}
+		if pool.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = pool.MaxIdleConnsPerHost
+		}
+		if pool.MaxConnsPerHost > 0 {
+			transport.MaxConnsPerHost = pool.MaxConnsPerHost
+		}
+		if pool.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = pool.IdleConnTimeout
+		}
+	}
+
+	return transport
+}
+
+// loadRootCAs returns the system roots extended by the certificates of the PEM files.
+func loadRootCAs(files []string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("CA bundle %s contains no certificates", file)
+		}
+	}
+	return pool, nil
+}
+
+// verifyPins accepts a connection to a pinned host only if one of the certificates of its
+// verified chains carries a pinned public key. Certificates the server sent but that are not
+// part of a verified chain are ignored, as anyone can send them. Hosts without pins are not
+// restricted.
+func verifyPins(pins map[string][]string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		hostPins := pinsOf(pins, state)
+		if len(hostPins) == 0 {
+			return nil
+		}
+
+		for _, chain := range state.VerifiedChains {
+			for _, certificate := range chain {
+				pin := SPKIPin(certificate)
+				for _, expected := range hostPins {
+					if pin == strings.TrimPrefix(expected, "sha256/") {
+						return nil
+					}
+				}
+			}
+		}
+		return errors.New("certificate chain of " + state.ServerName + " matches no pinned public key")
+	}
+}
+
+// pinsOf returns the pins of the host of the connection. TLS does not carry IP addresses as
+// server name, for them the IP addresses of the verified leaf certificate are used instead.
+func pinsOf(pins map[string][]string, state tls.ConnectionState) []string {
+	if state.ServerName != "" {
+		return pins[strings.ToLower(state.ServerName)]
+	}
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+
+	var hostPins []string
+	for _, ip := range state.PeerCertificates[0].IPAddresses {
+		hostPins = append(hostPins, pins[ip.String()]...)
+	}
+	return hostPins
+}
+
+// SPKIPin returns the base64 encoded SHA-256 hash of the public key of the certificate, as
+// expected by WithPinnedPublicKeys.
+func SPKIPin(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func (t *errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	closeBody(req)
+	return nil, t.err
+}
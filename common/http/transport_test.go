@@ -0,0 +1,155 @@
+package http_client_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRootCAs_TrustsPrivateCA(t *testing.T) {
+	// given
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	// when
+	_, untrustedErr := commonHttp.NewClient(commonHttp.WithRetry(0, time.Millisecond)).Get(server.URL)
+	resp, err := commonHttp.NewClient(commonHttp.WithRootCAs(caFile)).Get(server.URL)
+
+	// then
+	assert.ErrorContains(t, untrustedErr, "certificate")
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestWithRootCAs_FailsRequestsOnInvalidBundle(t *testing.T) {
+	// given
+	client := commonHttp.NewClient(commonHttp.WithRootCAs(filepath.Join(t.TempDir(), "missing.pem")), commonHttp.WithRetry(0, time.Millisecond))
+
+	// when
+	_, err := client.Get("https://localhost")
+
+	// then
+	assert.ErrorContains(t, err, "failed to read CA bundle")
+}
+
+func TestWithPinnedPublicKeys_VerifiesPin(t *testing.T) {
+	// given
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	pin := commonHttp.SPKIPin(server.Certificate())
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	pinned := commonHttp.NewClient(commonHttp.WithRootCAs(caFile), commonHttp.WithPinnedPublicKeys("127.0.0.1", "sha256/"+pin))
+	mismatched := commonHttp.NewClient(commonHttp.WithRootCAs(caFile), commonHttp.WithPinnedPublicKeys("127.0.0.1", otherPin), commonHttp.WithRetry(0, time.Millisecond))
+	otherHost := commonHttp.NewClient(commonHttp.WithRootCAs(caFile), commonHttp.WithPinnedPublicKeys("backend.example.com", otherPin))
+
+	// when
+	resp, err := pinned.Get(server.URL)
+	_, mismatchErr := mismatched.Get(server.URL)
+	otherResp, otherErr := otherHost.Get(server.URL)
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.ErrorContains(t, mismatchErr, "no pinned public key")
+	require.NoError(t, otherErr)
+	otherResp.Body.Close()
+}
+
+func TestWithPinnedPublicKeys_IgnoresCertificatesOutsideVerifiedChain(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	require.NoError(t, writeCertificate(filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.key"), "attacker"))
+	other, err := tls.LoadX509KeyPair(filepath.Join(dir, "other.pem"), filepath.Join(dir, "other.key"))
+	require.NoError(t, err)
+	otherCertificate, err := x509.ParseCertificate(other.Certificate[0])
+	require.NoError(t, err)
+
+	// The server sends the unrelated certificate along with its own chain.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.StartTLS()
+	defer server.Close()
+	server.TLS.Certificates[0].Certificate = append(server.TLS.Certificates[0].Certificate, other.Certificate[0])
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	client := commonHttp.NewClient(commonHttp.WithRootCAs(caFile), commonHttp.WithPinnedPublicKeys("127.0.0.1", commonHttp.SPKIPin(otherCertificate)), commonHttp.WithRetry(0, time.Millisecond))
+
+	// when
+	_, err = client.Get(server.URL)
+
+	// then
+	assert.ErrorContains(t, err, "no pinned public key")
+}
+
+func TestWithProxy_SendsCredentials(t *testing.T) {
+	// given
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String()+" "+r.Header.Get("Proxy-Authorization"))
+	}))
+	defer proxy.Close()
+
+	proxyURL := "http://user:secret@" + proxy.Listener.Addr().String()
+	client := commonHttp.NewClient(commonHttp.WithProxy(proxyURL))
+
+	// when
+	resp, err := client.Get("http://backend.internal/manifest.json")
+
+	// then
+	require.NoError(t, err)
+	resp.Body.Close()
+	expectedAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	assert.Equal(t, []string{"http://backend.internal/manifest.json " + expectedAuth}, proxied)
+}
+
+func TestWithProxy_RejectsUnsupportedScheme(t *testing.T) {
+	// given
+	client := commonHttp.NewClient(commonHttp.WithProxy("ftp://proxy:21"), commonHttp.WithRetry(0, time.Millisecond))
+
+	// when
+	_, err := client.Get("http://backend.internal")
+
+	// then
+	assert.ErrorContains(t, err, "unsupported proxy scheme")
+}
+
+func TestSetDefaultOptions_AppliesToEveryClient(t *testing.T) {
+	// given
+	requests := 0
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer proxy.Close()
+
+	commonHttp.SetDefaultOptions(commonHttp.WithProxy(proxy.URL))
+	defer commonHttp.SetDefaultOptions()
+
+	// when
+	resp, err := commonHttp.NewClient().Get("http://backend.internal")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	tokenResp, err := (&http.Client{Transport: commonHttp.NewTransport()}).Get("http://auth.internal/token")
+	require.NoError(t, err)
+	tokenResp.Body.Close()
+
+	// then
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,123 @@
+package jsonpatch_test
+
+import (
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/common/jsonpatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{name: "replace value", doc: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add value", doc: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "remove value", doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "replace array", doc: `{"a":["b"]}`, patch: `{"a":["c"]}`, want: `{"a":["c"]}`},
+		{name: "nested", doc: `{"a":{"b":"c","d":"e"}}`, patch: `{"a":{"b":null,"f":"g"}}`, want: `{"a":{"d":"e","f":"g"}}`},
+		{name: "replace non object", doc: `{"a":"b"}`, patch: `{"a":{"b":"c"}}`, want: `{"a":{"b":"c"}}`},
+		{name: "empty document", doc: ``, patch: `{"a":{"b":null}}`, want: `{"a":{}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			result, err := jsonpatch.MergePatch([]byte(tt.doc), []byte(tt.patch))
+
+			// then
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(result))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		patch   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "add object member",
+			doc:   `{"foo":"bar"}`,
+			patch: `[{"op":"add","path":"/baz","value":"qux"}]`,
+			want:  `{"foo":"bar","baz":"qux"}`,
+		},
+		{
+			name:  "add array element",
+			doc:   `{"foo":["bar","baz"]}`,
+			patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			want:  `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			name:  "append array element",
+			doc:   `{"foo":["bar"]}`,
+			patch: `[{"op":"add","path":"/foo/-","value":"baz"}]`,
+			want:  `{"foo":["bar","baz"]}`,
+		},
+		{
+			name:  "remove and replace",
+			doc:   `{"baz":"qux","foo":"bar"}`,
+			patch: `[{"op":"remove","path":"/baz"},{"op":"replace","path":"/foo","value":"boo"}]`,
+			want:  `{"foo":"boo"}`,
+		},
+		{
+			name:  "move and copy",
+			doc:   `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"},{"op":"copy","from":"/qux","path":"/copy"}]`,
+			want:  `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"},"copy":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			name:  "escaped pointer",
+			doc:   `{"a/b":1,"m~n":2}`,
+			patch: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`,
+			want:  `{"a/b":3}`,
+		},
+		{
+			name:  "successful test",
+			doc:   `{"foo":{"bar":[1,2]}}`,
+			patch: `[{"op":"test","path":"/foo/bar","value":[1,2]}]`,
+			want:  `{"foo":{"bar":[1,2]}}`,
+		},
+		{
+			name:    "failed test",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"test","path":"/foo","value":"baz"}]`,
+			wantErr: jsonpatch.ErrTestFailed,
+		},
+		{
+			name:    "replace missing",
+			doc:     `{"foo":"bar"}`,
+			patch:   `[{"op":"replace","path":"/baz","value":"qux"}]`,
+			wantErr: jsonpatch.ErrPathNotFound,
+		},
+		{
+			name:    "remove missing array index",
+			doc:     `{"foo":[1]}`,
+			patch:   `[{"op":"remove","path":"/foo/1"}]`,
+			wantErr: jsonpatch.ErrPathNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			result, err := jsonpatch.Apply([]byte(tt.doc), []byte(tt.patch))
+
+			// then
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(result))
+		})
+	}
+}
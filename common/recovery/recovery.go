@@ -0,0 +1,42 @@
+package recovery
+
+import (
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// Handler is called with the name of the panicking goroutine, the recovered value and its stack.
+type Handler func(goroutine string, recovered any, stack []byte)
+
+var handler atomic.Pointer[Handler]
+
+// SetHandler installs the handler called by Recover. A nil handler removes it.
+func SetHandler(h Handler) {
+	if h == nil {
+		handler.Store(nil)
+		return
+	}
+	handler.Store(&h)
+}
+
+// Recover must be deferred at the top of a goroutine. A panic is passed to the installed
+// handler and then re-raised, so the process still terminates as it would without Recover.
+func Recover(goroutine string) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+
+	if h := handler.Load(); h != nil {
+		(*h)(goroutine, recovered, debug.Stack())
+	}
+	panic(recovered)
+}
+
+// Go runs fn in a new goroutine guarded by Recover.
+func Go(goroutine string, fn func()) {
+	go func() {
+		defer Recover(goroutine)
+		fn()
+	}()
+}
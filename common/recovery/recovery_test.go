@@ -0,0 +1,82 @@
+package recovery_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	t.Run("passes panics to the handler and re-raises them", func(t *testing.T) {
+		// given
+		var goroutine string
+		var handled any
+		var stack []byte
+		recovery.SetHandler(func(g string, recovered any, s []byte) {
+			goroutine, handled, stack = g, recovered, s
+		})
+		defer recovery.SetHandler(nil)
+
+		// when
+		var reraised any
+		func() {
+			defer func() { reraised = recover() }()
+			defer recovery.Recover("worker")
+			panic("boom")
+		}()
+
+		// then
+		assert.Equal(t, "worker", goroutine)
+		assert.Equal(t, "boom", handled)
+		assert.Contains(t, string(stack), "recovery_test")
+		assert.Equal(t, "boom", reraised)
+	})
+
+	t.Run("re-raises panics without handler", func(t *testing.T) {
+		// when
+		var reraised any
+		func() {
+			defer func() { reraised = recover() }()
+			defer recovery.Recover("worker")
+			panic("boom")
+		}()
+
+		// then
+		assert.Equal(t, "boom", reraised)
+	})
+
+	t.Run("ignores goroutines without panic", func(t *testing.T) {
+		// given
+		called := false
+		recovery.SetHandler(func(string, any, []byte) { called = true })
+		defer recovery.SetHandler(nil)
+
+		// when
+		func() {
+			defer recovery.Recover("worker")
+		}()
+
+		// then
+		assert.False(t, called)
+	})
+}
+
+func TestGo(t *testing.T) {
+	// given
+	done := make(chan string, 1)
+
+	// when
+	recovery.Go("worker", func() { done <- "ran" })
+
+	// then
+	select {
+	case result := <-done:
+		require.Equal(t, "ran", result)
+	case <-time.After(time.Second):
+		t.Fatal("function was not run")
+	}
+}
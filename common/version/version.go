@@ -0,0 +1,46 @@
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Compare compares two dot separated versions numerically and returns -1, 0 or 1. A leading
+// "v" and any pre-release or build suffix are ignored. Missing and non-numeric segments are
+// treated as zero.
+func Compare(a, b string) int {
+	as, bs := segments(a), segments(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func segments(version string) []int {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	var segments []int
+	for _, part := range strings.Split(version, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			n = 0
+		}
+		segments = append(segments, n)
+	}
+	return segments
+}
@@ -0,0 +1,32 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/common/version"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{a: "1.2.3", b: "1.2.3", expected: 0},
+		{a: "v1.2.3", b: "1.2.3", expected: 0},
+		{a: "1.2", b: "1.2.0", expected: 0},
+		{a: "1.10.0", b: "1.9.0", expected: 1},
+		{a: "1.2.3", b: "1.3.0", expected: -1},
+		{a: "2.0.0-rc.1", b: "2.0.0", expected: 0},
+		{a: "dev", b: "0.0.1", expected: -1},
+	} {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			// when
+			result := version.Compare(test.a, test.b)
+
+			// then
+			assert.Equal(t, test.expected, result)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/dtomschitz/headless-go-client/bundle"
+	"github.com/dtomschitz/headless-go-client/common/version"
+	"github.com/dtomschitz/headless-go-client/event"
+)
+
+// ImportBundle applies the config contained in the offline bundle at path. The bundle must be
+// signed by one of the keys configured with WithBundleKeys. The config is verified, validated
+// and stored like one fetched from the remote server. Bundles without a config or with the
+// current remote version are ignored. Bundles with an older version are rejected unless
+// downgrades are allowed with WithAllowDowngrade, so that an old signed bundle cannot silently
+// roll the config back.
+func (cs *ConfigService) ImportBundle(ctx context.Context, path string) error {
+	cs.logger.Info("importing config from bundle", "path", path)
+	cs.events.Push(event.NewEvent(ctx, RefreshConfigEvent, event.WithPayload(RefreshPayload{Source: "bundle"})))
+
+	if err := cs.importBundle(ctx, path); err != nil {
+		cs.events.Push(event.NewEventFromError(ctx, RefreshConfigEvent, err, event.WithPayload(RefreshPayload{Source: "bundle"})))
+		return fmt.Errorf("failed to import bundle: %w", err)
+	}
+
+	cs.logger.Info("config imported successfully")
+	cs.events.Push(event.NewEvent(ctx, ConfigRefreshedEvent, event.WithPayload(RefreshPayload{Source: "bundle"})))
+	return nil
+}
+
+func (cs *ConfigService) importBundle(ctx context.Context, path string) error {
+	b, err := bundle.Open(path, cs.bundleKeys...)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	bundled := b.ConfigManifest()
+	if bundled == nil {
+		return errors.New("bundle contains no config")
+	}
+
+	cs.mu.RLock()
+	remote := cs.remote
+	cs.mu.RUnlock()
+	if remote != nil && bundled.Version == remote.Version && bundled.Hash == remote.Hash {
+		cs.logger.Info("config is up to date", "version", bundled.Version)
+		return nil
+	}
+	if remote != nil && version.Compare(bundled.Version, remote.Version) < 0 && !cs.allowDowngrade {
+		return fmt.Errorf("bundle version %s is older than the current version %s", bundled.Version, remote.Version)
+	}
+
+	// The payload is read from the bundle regardless of the URL in the manifest, patches are not
+	// part of bundles.
+	manifest := *bundled
+	manifest.Patch = nil
+
+	return cs.apply(ctx, &manifest, func(ctx context.Context, url string) ([]byte, Codec, error) {
+		file, err := b.PayloadOf(&manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		reader, err := b.Fetch(ctx, &manifest)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer reader.Close()
+
+		config, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		return config, CodecForContentType(file.ContentType), nil
+	})
+}
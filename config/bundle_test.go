@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/bundle"
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigServiceImportsBundle(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/json", []byte(`{"logLevel": "info"}`))
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(configPath, []byte("logLevel: debug\n"), 0644))
+
+	bundlePath := filepath.Join(dir, "site.bundle")
+	file, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Build(file, private, bundle.Contents{
+		Config: &bundle.Artifact{Manifest: manifest.Manifest{Version: "v2"}, Path: configPath},
+	}))
+	require.NoError(t, file.Close())
+
+	ctx := context.Background()
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithBundleKeys(public),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	// when
+	err = service.ImportBundle(ctx, bundlePath)
+
+	// then
+	require.NoError(t, err)
+	current := service.Current()
+	require.Equal(t, "v2", current.Version)
+	logLevel, err := current.GetString("logLevel")
+	require.NoError(t, err)
+	require.Equal(t, "debug", logLevel)
+}
+
+func TestConfigServiceRejectsUntrustedBundle(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/json", []byte(`{"logLevel": "info"}`))
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"logLevel": "debug"}`), 0644))
+
+	bundlePath := filepath.Join(dir, "site.bundle")
+	file, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Build(file, private, bundle.Contents{
+		Config: &bundle.Artifact{Manifest: manifest.Manifest{Version: "v2"}, Path: configPath},
+	}))
+	require.NoError(t, file.Close())
+
+	ctx := context.Background()
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithBundleKeys(public),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	// when
+	err = service.ImportBundle(ctx, bundlePath)
+
+	// then
+	require.ErrorIs(t, err, bundle.ErrInvalidSignature)
+	require.Equal(t, "v1", service.Current().Version)
+}
+
+func TestConfigServiceRejectsBundleDowngrade(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v2", "application/json", []byte(`{"logLevel": "info"}`))
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"logLevel": "debug"}`), 0644))
+
+	bundlePath := filepath.Join(dir, "site.bundle")
+	file, err := os.Create(bundlePath)
+	require.NoError(t, err)
+	require.NoError(t, bundle.Build(file, private, bundle.Contents{
+		Config: &bundle.Artifact{Manifest: manifest.Manifest{Version: "v1"}, Path: configPath},
+	}))
+	require.NoError(t, file.Close())
+
+	ctx := context.Background()
+	strict, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithBundleKeys(public),
+	)
+	require.NoError(t, err)
+	defer strict.Close(ctx)
+	permissive, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithBundleKeys(public),
+		WithAllowDowngrade(),
+	)
+	require.NoError(t, err)
+	defer permissive.Close(ctx)
+
+	// when
+	strictErr := strict.ImportBundle(ctx, bundlePath)
+	permissiveErr := permissive.ImportBundle(ctx, bundlePath)
+
+	// then
+	require.ErrorContains(t, strictErr, "older than the current version v2")
+	require.Equal(t, "v2", strict.Current().Version)
+	require.NoError(t, permissiveErr)
+	require.Equal(t, "v1", permissive.Current().Version)
+}
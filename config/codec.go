@@ -0,0 +1,283 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Codec encodes and decodes config documents in a specific format. Values are converted
+	// through their JSON representation so that the json struct tags of Config apply to
+	// every format.
+	Codec interface {
+		Name() string
+		Marshal(v interface{}) ([]byte, error)
+		Unmarshal(data []byte, v interface{}) error
+	}
+
+	JSONCodec   struct{}
+	YAMLCodec   struct{}
+	TOMLCodec   struct{}
+	DotenvCodec struct{}
+)
+
+var (
+	_ Codec = JSONCodec{}
+	_ Codec = YAMLCodec{}
+	_ Codec = TOMLCodec{}
+	_ Codec = DotenvCodec{}
+)
+
+// dotenvSeparator joins the keys of nested objects in dotenv files, e.g. "properties__port".
+const dotenvSeparator = "__"
+
+// CodecForPath returns the codec matching the file extension of path. JSON is used for
+// unknown extensions.
+func CodecForPath(path string) Codec {
+	base := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(base, ".yaml"), strings.HasSuffix(base, ".yml"):
+		return YAMLCodec{}
+	case strings.HasSuffix(base, ".toml"):
+		return TOMLCodec{}
+	case base == ".env", strings.HasSuffix(base, ".env"):
+		return DotenvCodec{}
+	default:
+		return JSONCodec{}
+	}
+}
+
+// CodecForContentType returns the codec matching the media type of a Content-Type header.
+// JSON is used for empty or unknown content types.
+func CodecForContentType(contentType string) Codec {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return JSONCodec{}
+	}
+
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return YAMLCodec{}
+	case "application/toml", "text/toml":
+		return TOMLCodec{}
+	case "text/x-dotenv", "application/x-dotenv":
+		return DotenvCodec{}
+	default:
+		return JSONCodec{}
+	}
+}
+
+func (JSONCodec) Name() string { return "json" }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (YAMLCodec) Name() string { return "yaml" }
+
+func (YAMLCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(generic)
+}
+
+func (YAMLCodec) Unmarshal(data []byte, v interface{}) error {
+	var generic interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	return fromGeneric(generic, v)
+}
+
+func (TOMLCodec) Name() string { return "toml" }
+
+func (TOMLCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	return toml.Marshal(generic)
+}
+
+func (TOMLCodec) Unmarshal(data []byte, v interface{}) error {
+	var generic map[string]interface{}
+	if err := toml.Unmarshal(data, &generic); err != nil {
+		return err
+	}
+	return fromGeneric(generic, v)
+}
+
+func (DotenvCodec) Name() string { return "dotenv" }
+
+// Marshal flattens v into KEY=VALUE lines. Nested objects are joined with "__", all
+// values are written as quoted strings.
+func (DotenvCodec) Marshal(v interface{}) ([]byte, error) {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+
+	object, ok := generic.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("dotenv can only encode objects, got %T", generic)
+	}
+
+	flat := make(map[string]string)
+	if err := flattenDotenv("", object, flat); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s=%s\n", k, strconv.Quote(flat[k]))
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal parses KEY=VALUE lines. Blank lines, comments and an optional "export" prefix
+// are ignored. Keys containing "__" are expanded into nested objects. Values are kept
+// as strings.
+func (DotenvCodec) Unmarshal(data []byte, v interface{}) error {
+	generic := make(map[string]interface{})
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: missing '='", lineNumber)
+		}
+
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return fmt.Errorf("line %d: empty key", lineNumber)
+		}
+
+		value, err := parseDotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		if err := setNested(generic, strings.Split(key, dotenvSeparator), value); err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return fromGeneric(generic, v)
+}
+
+func parseDotenvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		return strconv.Unquote(value)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+		return value[1 : len(value)-1], nil
+	default:
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		return value, nil
+	}
+}
+
+func flattenDotenv(prefix string, object map[string]interface{}, flat map[string]string) error {
+	for k, v := range object {
+		key := k
+		if prefix != "" {
+			key = prefix + dotenvSeparator + k
+		}
+
+		switch value := v.(type) {
+		case map[string]interface{}:
+			if err := flattenDotenv(key, value, flat); err != nil {
+				return err
+			}
+		case []interface{}:
+			return fmt.Errorf("dotenv cannot encode array value of key %s", key)
+		case nil:
+			flat[key] = ""
+		case string:
+			flat[key] = value
+		default:
+			flat[key] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
+
+func setNested(object map[string]interface{}, path []string, value string) error {
+	for i, segment := range path[:len(path)-1] {
+		next, ok := object[segment]
+		if !ok {
+			child := make(map[string]interface{})
+			object[segment] = child
+			object = child
+			continue
+		}
+
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("key %s is both a value and an object", strings.Join(path[:i+1], dotenvSeparator))
+		}
+		object = child
+	}
+
+	object[path[len(path)-1]] = value
+	return nil
+}
+
+// toGeneric converts v into maps, slices and primitives using its JSON representation.
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// fromGeneric stores a decoded generic document into v using its JSON representation.
+func fromGeneric(generic interface{}, v interface{}) error {
+	data, err := json.Marshal(generic)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecDetection(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		want        string
+	}{
+		{name: "json", path: "config.json", contentType: "application/json; charset=utf-8", want: "json"},
+		{name: "yaml", path: "config.yaml", contentType: "application/yaml", want: "yaml"},
+		{name: "yml", path: "/etc/client/CONFIG.YML", contentType: "text/x-yaml", want: "yaml"},
+		{name: "toml", path: "config.toml", contentType: "application/toml", want: "toml"},
+		{name: "dotenv", path: "client.env", contentType: "text/x-dotenv", want: "dotenv"},
+		{name: "plain dotenv", path: ".env", contentType: "application/x-dotenv", want: "dotenv"},
+		{name: "unknown", path: "config", contentType: "", want: "json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, CodecForPath(tt.path).Name())
+			require.Equal(t, tt.want, CodecForContentType(tt.contentType).Name())
+		})
+	}
+}
+
+func TestFileStorageCodecs(t *testing.T) {
+	config := &Config{
+		Version: "v1.0.0",
+		Hash:    "sha256:abc",
+		Properties: Properties{
+			"appName": "TestApp",
+			"port":    "8080",
+			"database": map[string]interface{}{
+				"host": "localhost",
+			},
+		},
+	}
+
+	for _, file := range []string{"config.json", "config.yaml", "config.toml", "config.env"} {
+		t.Run(file, func(t *testing.T) {
+			// given
+			storage := NewFileStorage(filepath.Join(t.TempDir(), file))
+			ctx := context.Background()
+
+			// when
+			require.NoError(t, storage.Save(ctx, config))
+			loaded, err := storage.Get(ctx)
+
+			// then
+			require.NoError(t, err)
+			require.Equal(t, config, loaded)
+		})
+	}
+}
+
+func TestFileStorageReadsHandWrittenFiles(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+	}{
+		{
+			file: "config.yaml",
+			content: `version: v2
+properties:
+  logLevel: debug
+  retries: 3
+`,
+		},
+		{
+			file: "config.toml",
+			content: `version = "v2"
+
+[properties]
+logLevel = "debug"
+retries = 3
+`,
+		},
+		{
+			file: "config.env",
+			content: `# local overrides
+version=v2
+export properties__logLevel="debug"
+properties__retries='3'
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			// given
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0644))
+
+			// when
+			loaded, err := NewFileStorage(path).Get(context.Background())
+
+			// then
+			require.NoError(t, err)
+			require.Equal(t, "v2", loaded.Version)
+
+			logLevel, err := loaded.GetString("logLevel")
+			require.NoError(t, err)
+			require.Equal(t, "debug", logLevel)
+
+			retries, err := loaded.GetInt("retries")
+			require.NoError(t, err)
+			require.Equal(t, 3, retries)
+		})
+	}
+}
+
+func TestDotenvCodecInvalidInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing equals", content: "KEY"},
+		{name: "empty key", content: "=value"},
+		{name: "unterminated quote", content: `KEY="value`},
+		{name: "value and object", content: "a=1\na__b=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var properties Properties
+			require.Error(t, DotenvCodec{}.Unmarshal([]byte(tt.content), &properties))
+		})
+	}
+}
+
+func TestWithCodecOverridesDetection(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "config")
+
+	// when
+	storage := NewFileStorage(path, WithCodec(YAMLCodec{}))
+
+	// then
+	require.Equal(t, "yaml", storage.codec.Name())
+}
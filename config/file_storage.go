@@ -2,20 +2,39 @@ package config
 
 import (
 	"context"
-	"encoding/json"
 	"os"
 	"sync"
 )
 
-type FileStorage struct {
-	path string
-	mu   sync.RWMutex
-}
+type (
+	FileStorage struct {
+		path  string
+		codec Codec
+		mu    sync.RWMutex
+	}
+
+	FileStorageOption func(*FileStorage)
+)
 
 var _ ConfigStorage = &FileStorage{}
 
-func NewFileStorage(path string) *FileStorage {
-	return &FileStorage{path: path}
+// WithCodec overrides the codec that is otherwise detected from the file extension.
+func WithCodec(codec Codec) FileStorageOption {
+	return func(fs *FileStorage) {
+		if codec != nil {
+			fs.codec = codec
+		}
+	}
+}
+
+// NewFileStorage returns a FileStorage for the given path. The file format is detected from
+// the extension (.json, .yaml, .yml, .toml, .env) and defaults to JSON.
+func NewFileStorage(path string, opts ...FileStorageOption) *FileStorage {
+	fs := &FileStorage{path: path, codec: CodecForPath(path)}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
 }
 
 func (fs *FileStorage) Get(ctx context.Context) (*Config, error) {
@@ -31,7 +50,7 @@ func (fs *FileStorage) Get(ctx context.Context) (*Config, error) {
 	}
 
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := fs.codec.Unmarshal(data, &config); err != nil {
 		return nil, err
 	}
 
@@ -42,7 +61,7 @@ func (fs *FileStorage) Save(ctx context.Context, config *Config) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	data, err := json.Marshal(config)
+	data, err := fs.codec.Marshal(config)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type (
+	// fileWatcher signals on Changes whenever the watched file was created, written, renamed
+	// or removed. Signals are coalesced, a receiver is only guaranteed to see that at least one
+	// change happened since the last receive.
+	fileWatcher interface {
+		Changes() <-chan struct{}
+		Close() error
+	}
+
+	pollingFileWatcher struct {
+		path     string
+		interval time.Duration
+		last     fileState
+		changes  chan struct{}
+		closed   chan struct{}
+		done     chan struct{}
+		once     sync.Once
+	}
+
+	fileState struct {
+		exists  bool
+		size    int64
+		modTime time.Time
+	}
+)
+
+// newFileWatcher watches the given file using the native mechanism of the platform and falls
+// back to polling with the given interval if that is not available or stops working.
+func newFileWatcher(path string, pollInterval time.Duration, logger logger.Logger) fileWatcher {
+	if watcher, err := newNativeFileWatcher(path, pollInterval, logger); err == nil {
+		return watcher
+	}
+	return newPollingFileWatcher(path, pollInterval)
+}
+
+func newPollingFileWatcher(path string, interval time.Duration) *pollingFileWatcher {
+	w := &pollingFileWatcher{
+		path:     path,
+		interval: interval,
+		last:     statFile(path),
+		changes:  make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.poll()
+	return w
+}
+
+func (w *pollingFileWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+func (w *pollingFileWatcher) Close() error {
+	w.once.Do(func() {
+		close(w.closed)
+	})
+	<-w.done
+	return nil
+}
+
+func (w *pollingFileWatcher) poll() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ticker.C:
+			current := statFile(w.path)
+			if current != w.last {
+				w.last = current
+				signalChange(w.changes)
+			}
+		}
+	}
+}
+
+func statFile(path string) fileState {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: info.Size(), modTime: info.ModTime()}
+}
+
+// signalChange performs a non-blocking send so that pending signals are coalesced.
+func signalChange(changes chan struct{}) {
+	select {
+	case changes <- struct{}{}:
+	default:
+	}
+}
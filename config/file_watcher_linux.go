@@ -0,0 +1,134 @@
+//go:build linux
+
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+// inotifyFileWatcher watches the parent directory of the file so that editors replacing the
+// file through a rename are detected as well. If the watch breaks, e.g. because the directory
+// was removed, it falls back to polling the file.
+type inotifyFileWatcher struct {
+	path         string
+	pollInterval time.Duration
+	logger       logger.Logger
+	file         *os.File
+	changes      chan struct{}
+	closed       chan struct{}
+	done         chan struct{}
+	once         sync.Once
+}
+
+var errWatchRemoved = errors.New("watched directory was removed")
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE
+
+func newNativeFileWatcher(path string, pollInterval time.Duration, logger logger.Logger) (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := syscall.InotifyAddWatch(fd, filepath.Dir(path), inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+
+	w := &inotifyFileWatcher{
+		path:         path,
+		pollInterval: pollInterval,
+		logger:       logger,
+		// The descriptor is non-blocking, so reads are handled by the runtime poller and
+		// closing the file unblocks a pending read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyFileWatcher) Changes() <-chan struct{} {
+	return w.changes
+}
+
+func (w *inotifyFileWatcher) Close() error {
+	var err error
+	w.once.Do(func() {
+		err = w.file.Close()
+		close(w.closed)
+	})
+	<-w.done
+	return err
+}
+
+func (w *inotifyFileWatcher) read() {
+	defer close(w.done)
+
+	err := w.watch()
+	if err == nil {
+		return
+	}
+
+	// Signal once so that the file is re-read, and keep watching by polling, which also
+	// detects a recreated directory.
+	w.logger.Warn("file watch failed, falling back to polling", "path", w.path, "error", err)
+	signalChange(w.changes)
+
+	poller := newPollingFileWatcher(w.path, w.pollInterval)
+	defer poller.Close()
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-poller.Changes():
+			signalChange(w.changes)
+		}
+	}
+}
+
+// watch signals changes of the file until the watcher is closed, in which case it returns nil,
+// or until the watch breaks.
+func (w *inotifyFileWatcher) watch() error {
+	name := filepath.Base(w.path)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			offset = nameEnd
+
+			if nameEnd > n {
+				break
+			}
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				return errWatchRemoved
+			}
+
+			if string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00")) == name {
+				signalChange(w.changes)
+			}
+		}
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package config
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+func newNativeFileWatcher(path string, pollInterval time.Duration, logger logger.Logger) (fileWatcher, error) {
+	return nil, errors.New("native file watching is not supported on this platform")
+}
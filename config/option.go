@@ -2,6 +2,7 @@ package config
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"net/http"
 	"time"
@@ -31,6 +32,45 @@ func WithConfigEnvPrefix(prefix string) ConfigServiceOption {
 	}
 }
 
+// WithOverrideFile merges the properties of a local file into every refreshed config. The
+// format is detected from the file extension, see CodecForPath.
+func WithOverrideFile(path string) ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		if path == "" {
+			return errors.New("override file path cannot be empty")
+		}
+
+		service.overridePath = path
+		return nil
+	}
+}
+
+// WithOverrideFileWatch reloads the override file whenever it changes instead of only on
+// remote refreshes. Rapid edits are debounced by the given duration. Requires WithOverrideFile.
+func WithOverrideFileWatch(debounce time.Duration) ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		if debounce < 0 {
+			return errors.New("override debounce cannot be negative")
+		}
+
+		service.watchOverride = true
+		service.overrideDebounce = debounce
+		return nil
+	}
+}
+
+// WithValidator rejects configs for which the validator returns an error.
+func WithValidator(validator ConfigValidator) ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		if validator == nil {
+			return errors.New("validator is not provided")
+		}
+
+		service.validator = validator
+		return nil
+	}
+}
+
 func WithPollInterval(pollInterval time.Duration) ConfigServiceOption {
 	return func(ctx context.Context, service *ConfigService) error {
 		if pollInterval <= 0 {
@@ -85,6 +125,17 @@ func WithStorage(storage ConfigStorage) ConfigServiceOption {
 	}
 }
 
+func WithSecretResolver(resolver *SecretResolver) ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		if resolver == nil {
+			return errors.New("secret resolver is not provided")
+		}
+
+		service.secrets = resolver
+		return nil
+	}
+}
+
 func WithEventEmitter(emitter event.Emitter) ConfigServiceOption {
 	return func(ctx context.Context, service *ConfigService) error {
 		if emitter == nil {
@@ -105,3 +156,29 @@ func WithLogger(factory logger.Factory) ConfigServiceOption {
 		return nil
 	}
 }
+
+// WithBundleKeys sets the public keys trusted to sign offline bundles imported by ImportBundle.
+func WithBundleKeys(keys ...ed25519.PublicKey) ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		if len(keys) == 0 {
+			return errors.New("bundle keys cannot be empty")
+		}
+		for _, key := range keys {
+			if len(key) != ed25519.PublicKeySize {
+				return errors.New("invalid bundle key")
+			}
+		}
+
+		service.bundleKeys = append(service.bundleKeys, keys...)
+		return nil
+	}
+}
+
+// WithAllowDowngrade lets ImportBundle apply bundles with a config version older than the
+// current one, e.g. to roll back a faulty config in the field.
+func WithAllowDowngrade() ConfigServiceOption {
+	return func(ctx context.Context, service *ConfigService) error {
+		service.allowDowngrade = true
+		return nil
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/event"
+)
+
+// ReloadOverrides re-reads the override file and applies it on top of the latest remote
+// config. The new config is validated before it replaces the current one. Listeners are
+// notified and ConfigRefreshedEvent is emitted if the properties changed.
+func (cs *ConfigService) ReloadOverrides(ctx context.Context) error {
+	cs.logger.Info("reloading override file", "path", cs.overridePath)
+	cs.events.Push(event.NewEvent(ctx, RefreshConfigEvent, event.WithPayload(RefreshPayload{Source: "file"})))
+
+	changed, err := cs.reloadOverrides()
+	if err != nil {
+		cs.events.Push(event.NewEventFromError(ctx, RefreshConfigEvent, err, event.WithPayload(RefreshPayload{Source: "file"})))
+		return fmt.Errorf("failed to reload override file: %w", err)
+	}
+
+	if !changed {
+		cs.logger.Info("override file did not change config properties")
+		return nil
+	}
+
+	cs.logger.Info("applied override file successfully")
+	cs.events.Push(event.NewEvent(ctx, ConfigRefreshedEvent, event.WithPayload(RefreshPayload{Source: "file"})))
+	return nil
+}
+
+func (cs *ConfigService) reloadOverrides() (bool, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	merged, overrides, err := cs.applyOverrideFile(cs.remote)
+	if err != nil {
+		return false, err
+	}
+
+	changed := !isConfigContentEqual(cs.current, merged)
+	cs.overrides = overrides
+	cs.current = merged
+
+	if changed {
+		cs.secrets.Purge()
+		cs.notifyChange(merged)
+	}
+
+	return changed, nil
+}
+
+// watchOverrideFile reloads the override file whenever it changes. Changes are debounced so
+// that an editor writing the file in several steps results in a single reload.
+func (cs *ConfigService) watchOverrideFile(ctx context.Context) {
+	watcher := newFileWatcher(cs.overridePath, cs.overridePoll, cs.logger)
+
+	cs.wg.Add(1)
+	go func() {
+		defer recovery.Recover(ServiceName)
+		defer cs.wg.Done()
+		defer watcher.Close()
+
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-watcher.Changes():
+				debounce = time.After(cs.overrideDebounce)
+			case <-debounce:
+				debounce = nil
+				if err := cs.ReloadOverrides(ctx); err != nil {
+					cs.logger.Error("failed to apply override file", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// readOverrideFile decodes the local override file. A missing file results in no overrides.
+func (cs *ConfigService) readOverrideFile() (Properties, error) {
+	data, err := os.ReadFile(cs.overridePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	codec := CodecForPath(cs.overridePath)
+
+	var overrides Properties
+	if err := codec.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to decode %s override file: %w", codec.Name(), err)
+	}
+
+	return overrides, nil
+}
+
+// applyOverrideFile reads the override file and applies it on top of the remote config, see
+// applyOverrides.
+func (cs *ConfigService) applyOverrideFile(remote *Config) (*Config, Properties, error) {
+	overrides, err := cs.readOverrideFile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	merged, err := cs.applyOverrides(remote, overrides)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, overrides, nil
+}
+
+// applyOverrides composes the effective config and validates it, so that neither a remote
+// config nor an override file becomes effective without passing the validator.
+func (cs *ConfigService) applyOverrides(remote *Config, overrides Properties) (*Config, error) {
+	merged := cs.compose(remote, overrides)
+	if cs.validator != nil {
+		if err := cs.validator(merged); err != nil {
+			return nil, fmt.Errorf("failed to validate config: %w", err)
+		}
+	}
+	return merged, nil
+}
+
+// compose builds the effective config from the remote config, the local overrides and, if
+// enabled, the environment variables.
+func (cs *ConfigService) compose(remote *Config, overrides Properties) *Config {
+	merged := mergeOverrides(remote, overrides)
+	if cs.extendWithEnvVars {
+		merged = cs.extendWithEnvironmentVariables(merged)
+	}
+
+	return merged
+}
+
+// mergeOverrides returns a copy of the config with the top-level overrides applied.
+func mergeOverrides(baseConfig *Config, overrides Properties) *Config {
+	merged := deepCopyConfig(baseConfig)
+	for k, v := range overrides {
+		merged.Properties[k] = v
+	}
+
+	return merged
+}
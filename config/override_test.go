@@ -0,0 +1,218 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWatchers(t *testing.T) {
+	watchers := map[string]func(path string) (fileWatcher, error){
+		"polling": func(path string) (fileWatcher, error) {
+			return newPollingFileWatcher(path, 10*time.Millisecond), nil
+		},
+		"native": func(path string) (fileWatcher, error) {
+			return newNativeFileWatcher(path, 10*time.Millisecond, &logger.NoopLogger{})
+		},
+	}
+
+	for name, newWatcher := range watchers {
+		t.Run(name, func(t *testing.T) {
+			// given
+			path := filepath.Join(t.TempDir(), "override.yaml")
+			watcher, err := newWatcher(path)
+			if err != nil {
+				t.Skipf("watcher not supported: %v", err)
+			}
+			defer watcher.Close()
+
+			// when
+			require.NoError(t, os.WriteFile(path, []byte("key: value\n"), 0644))
+
+			// then
+			select {
+			case <-watcher.Changes():
+			case <-time.After(2 * time.Second):
+				t.Fatal("expected change after file was created")
+			}
+
+			// when
+			require.NoError(t, os.Remove(path))
+
+			// then
+			select {
+			case <-watcher.Changes():
+			case <-time.After(2 * time.Second):
+				t.Fatal("expected change after file was removed")
+			}
+		})
+	}
+}
+
+func TestNativeFileWatcher_FallsBackToPollingWhenDirectoryIsRemoved(t *testing.T) {
+	// given
+	dir := filepath.Join(t.TempDir(), "overrides")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	path := filepath.Join(dir, "override.yaml")
+	watcher, err := newNativeFileWatcher(path, 10*time.Millisecond, &logger.NoopLogger{})
+	if err != nil {
+		t.Skipf("watcher not supported: %v", err)
+	}
+	defer watcher.Close()
+
+	// when
+	require.NoError(t, os.RemoveAll(dir))
+
+	// then
+	select {
+	case <-watcher.Changes():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected change after directory was removed")
+	}
+
+	// when
+	require.NoError(t, os.Mkdir(dir, 0755))
+	require.NoError(t, os.WriteFile(path, []byte("key: value\n"), 0644))
+
+	// then
+	select {
+	case <-watcher.Changes():
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected change after directory was recreated")
+	}
+}
+
+func TestConfigServiceWatchesOverrideFile(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/json", []byte(`{"logLevel": "info", "retries": 3}`))
+	overridePath := filepath.Join(t.TempDir(), "override.yaml")
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 100})
+	ctx := context.Background()
+
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithEventEmitter(emitter),
+		WithOverrideFile(overridePath),
+		WithOverrideFileWatch(20*time.Millisecond),
+		WithValidator(func(config *Config) error {
+			if retries, err := config.GetInt("retries"); err != nil || retries < 0 {
+				return errors.New("retries must be a positive number")
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+	emitter.PollEvents()
+
+	changes := make(chan *Config, 10)
+	service.ListenForChanges(ctx, func(ctx context.Context, config *Config) {
+		changes <- config
+	})
+
+	// when
+	require.NoError(t, os.WriteFile(overridePath, []byte("logLevel: debug\n"), 0644))
+
+	// then
+	select {
+	case config := <-changes:
+		logLevel, err := config.GetString("logLevel")
+		require.NoError(t, err)
+		require.Equal(t, "debug", logLevel)
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected change notification after override file was written")
+	}
+
+	current := service.Current()
+	require.Equal(t, "v1", current.Version)
+	logLevel, err := current.GetString("logLevel")
+	require.NoError(t, err)
+	require.Equal(t, "debug", logLevel)
+
+	require.Eventually(t, func() bool {
+		for _, evt := range emitter.PollEvents() {
+			if evt.Type == ConfigRefreshedEvent && evt.Data["source"] == "file" {
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	// when
+	require.NoError(t, os.WriteFile(overridePath, []byte("retries: -1\n"), 0644))
+
+	// then
+	require.Eventually(t, func() bool {
+		for _, evt := range emitter.PollEvents() {
+			if evt.Type == RefreshConfigEvent && evt.IsError {
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "invalid override should be rejected")
+
+	retries, err := service.Current().GetInt("retries")
+	require.NoError(t, err)
+	require.Equal(t, 3, retries, "rejected override must not be applied")
+}
+
+func TestConfigServiceValidatesOverrideFileOnStartup(t *testing.T) {
+	// given
+	payload := []byte(`{"retries": 3}`)
+	server := newConfigServer(t, "v1", "application/json", payload)
+	sum := sha256.Sum256(payload)
+
+	storage := NewInMemoryStorage()
+	require.NoError(t, storage.Save(context.Background(), &Config{Version: "v1", Hash: "sha256:" + hex.EncodeToString(sum[:]), Properties: Properties{"retries": 3}}))
+
+	overridePath := filepath.Join(t.TempDir(), "override.yaml")
+	require.NoError(t, os.WriteFile(overridePath, []byte("retries: -1\n"), 0644))
+	ctx := context.Background()
+
+	// when
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithStorage(storage),
+		WithOverrideFile(overridePath),
+		WithValidator(func(config *Config) error {
+			if retries, err := config.GetInt("retries"); err != nil || retries < 0 {
+				return errors.New("retries must be a positive number")
+			}
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	// then
+	retries, err := service.Current().GetInt("retries")
+	require.NoError(t, err)
+	require.Equal(t, 3, retries, "invalid override must not be applied on startup")
+}
+
+func TestWithOverrideFileWatchRequiresOverrideFile(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/json", []byte(`{}`))
+
+	// when
+	_, err := NewService(context.Background(), server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithOverrideFileWatch(0),
+	)
+
+	// then
+	require.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dtomschitz/headless-go-client/common/jsonpatch"
+	"github.com/dtomschitz/headless-go-client/manifest"
+)
+
+// fetchPatched applies the patch referenced by the manifest to the current remote config. Nil
+// properties without an error are returned if the manifest has no patch applicable to the
+// current version. The patched document is verified against the manifest hash using its
+// canonical JSON encoding, i.e. compact with sorted keys.
+func (cs *ConfigService) fetchPatched(ctx context.Context, m *manifest.Manifest, fetch fetchFunc) (Properties, error) {
+	cs.mu.RLock()
+	remote := cs.remote
+	cs.mu.RUnlock()
+
+	if m.Patch == nil || remote == nil || m.Patch.BaseVersion != remote.Version {
+		return nil, nil
+	}
+
+	base, err := json.Marshal(remote.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode current config: %w", err)
+	}
+
+	patch, _, err := fetch(ctx, m.Patch.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch patch: %w", err)
+	}
+
+	var patched []byte
+	switch m.Patch.Type {
+	case manifest.MergePatch:
+		patched, err = jsonpatch.MergePatch(base, patch)
+	case manifest.JSONPatch:
+		patched, err = jsonpatch.Apply(base, patch)
+	default:
+		return nil, fmt.Errorf("unsupported patch type %q", m.Patch.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply patch: %w", err)
+	}
+
+	var properties Properties
+	if err := json.Unmarshal(patched, &properties); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal patched config: %w", err)
+	}
+
+	canonical, err := json.Marshal(properties)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode patched config: %w", err)
+	}
+
+	if err := m.Verify(canonical); err != nil {
+		return nil, fmt.Errorf("failed to verify patched config: %w", err)
+	}
+
+	cs.logger.Info("applied config patch", "baseVersion", m.Patch.BaseVersion, "version", m.Version, "type", m.Patch.Type)
+
+	return properties, nil
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+type patchServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	manifest manifest.Manifest
+	full     []byte
+	patch    []byte
+	requests map[string]int
+}
+
+func newPatchServer(t *testing.T, version string, full []byte) *patchServer {
+	t.Helper()
+
+	s := &patchServer{requests: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests[r.URL.Path]++
+		switch r.URL.Path {
+		case "/manifest":
+			json.NewEncoder(w).Encode(s.manifest)
+		case "/config":
+			w.Write(s.full)
+		case "/patch":
+			w.Write(s.patch)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	s.publish(version, full, nil)
+	return s
+}
+
+func (s *patchServer) publish(version string, full []byte, patch *manifest.Patch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sum := sha256.Sum256(full)
+	s.full = full
+	s.manifest = manifest.Manifest{
+		Version: version,
+		Hash:    "sha256:" + hex.EncodeToString(sum[:]),
+		URL:     s.URL + "/config",
+		Patch:   patch,
+	}
+	if patch != nil {
+		s.manifest.Patch.URL = s.URL + "/patch"
+	}
+}
+
+func (s *patchServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func TestConfigServiceAppliesPatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		patchType manifest.PatchType
+		patch     string
+		wantFull  bool
+	}{
+		{
+			name:      "merge patch",
+			patchType: manifest.MergePatch,
+			patch:     `{"logLevel":"debug","obsolete":null}`,
+		},
+		{
+			name:      "json patch",
+			patchType: manifest.JSONPatch,
+			patch:     `[{"op":"replace","path":"/logLevel","value":"debug"},{"op":"remove","path":"/obsolete"}]`,
+		},
+		{
+			name:      "hash mismatch falls back to full fetch",
+			patchType: manifest.MergePatch,
+			patch:     `{"logLevel":"trace","obsolete":null}`,
+			wantFull:  true,
+		},
+		{
+			name:      "invalid patch falls back to full fetch",
+			patchType: manifest.JSONPatch,
+			patch:     `[{"op":"remove","path":"/missing"}]`,
+			wantFull:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			server := newPatchServer(t, "v1", []byte(`{"logLevel":"info","obsolete":true,"retries":3}`))
+			ctx := context.Background()
+
+			service, err := NewService(ctx, server.URL+"/manifest",
+				WithHTTPClient(server.Client()),
+				WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+			)
+			require.NoError(t, err)
+			defer service.Close(ctx)
+			require.Equal(t, 1, server.count("/config"))
+
+			server.mu.Lock()
+			server.patch = []byte(tt.patch)
+			server.mu.Unlock()
+			server.publish("v2", []byte(`{"logLevel":"debug","retries":3}`), &manifest.Patch{BaseVersion: "v1", Type: tt.patchType})
+
+			// when
+			require.NoError(t, service.Refresh(ctx))
+
+			// then
+			require.Equal(t, 1, server.count("/patch"))
+			if tt.wantFull {
+				require.Equal(t, 2, server.count("/config"), "expected fallback to full fetch")
+			} else {
+				require.Equal(t, 1, server.count("/config"), "expected no full fetch")
+			}
+
+			current := service.Current()
+			require.Equal(t, "v2", current.Version)
+			require.Equal(t, Properties{"logLevel": "debug", "retries": float64(3)}, current.Properties)
+		})
+	}
+}
+
+func TestConfigServiceIgnoresPatchForOtherBaseVersion(t *testing.T) {
+	// given
+	server := newPatchServer(t, "v1", []byte(`{"logLevel":"info"}`))
+	ctx := context.Background()
+
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	server.publish("v3", []byte(`{"logLevel":"debug"}`), &manifest.Patch{BaseVersion: "v2", Type: manifest.MergePatch})
+
+	// when
+	require.NoError(t, service.Refresh(ctx))
+
+	// then
+	require.Equal(t, 0, server.count("/patch"))
+	require.Equal(t, 2, server.count("/config"))
+	require.Equal(t, "v3", service.Current().Version)
+}
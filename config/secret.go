@@ -0,0 +1,202 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Secret holds a resolved secret value. It redacts itself when formatted, logged or
+	// marshalled so that resolved values never end up in logs, events or stored configs.
+	// Use Reveal to access the plain value.
+	Secret struct {
+		value string
+	}
+
+	// SecretProvider resolves the path of a secret reference for a single provider,
+	// e.g. "etc/creds/db" for the reference "secret://file/etc/creds/db".
+	SecretProvider interface {
+		Resolve(ctx context.Context, path string) (string, error)
+	}
+
+	// SecretResolver is a registry of SecretProviders keyed by provider name. Resolved values
+	// are cached for the configured TTL.
+	SecretResolver struct {
+		ttl       time.Duration
+		now       func() time.Time
+		mu        sync.RWMutex
+		providers map[string]SecretProvider
+		cache     map[string]cachedSecret
+	}
+
+	cachedSecret struct {
+		secret    Secret
+		expiresAt time.Time
+	}
+)
+
+const (
+	// SecretReferencePrefix marks a config value as a reference to a secret.
+	SecretReferencePrefix = "secret://"
+
+	redacted = "[REDACTED]"
+)
+
+var (
+	// ErrNotSecretReference is returned when a value is not of the form secret://<provider>/<path>.
+	ErrNotSecretReference = errors.New("not a secret reference")
+	// ErrUnknownSecretProvider is returned when no provider is registered for a reference.
+	ErrUnknownSecretProvider = errors.New("unknown secret provider")
+)
+
+// NewSecret wraps a plain value into a Secret.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// Reveal returns the plain secret value.
+func (s Secret) Reveal() string {
+	return s.value
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(redacted)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// IsSecretReference reports whether the value references a secret.
+func IsSecretReference(value interface{}) bool {
+	str, ok := value.(string)
+	return ok && strings.HasPrefix(str, SecretReferencePrefix)
+}
+
+// ParseSecretReference splits a reference of the form secret://<provider>/<path> into its
+// provider name and path.
+func ParseSecretReference(ref string) (string, string, error) {
+	if !strings.HasPrefix(ref, SecretReferencePrefix) {
+		return "", "", ErrNotSecretReference
+	}
+
+	provider, path, ok := strings.Cut(strings.TrimPrefix(ref, SecretReferencePrefix), "/")
+	if !ok || provider == "" || path == "" {
+		return "", "", fmt.Errorf("%w: expected secret://<provider>/<path>", ErrNotSecretReference)
+	}
+
+	return provider, path, nil
+}
+
+// NewSecretResolver returns a SecretResolver caching resolved values for the given TTL. The
+// env provider is registered by default. A FileSecretProvider has to be registered with the
+// directory it may read from. A TTL <= 0 disables caching.
+func NewSecretResolver(ttl time.Duration) *SecretResolver {
+	resolver := &SecretResolver{
+		ttl:       ttl,
+		now:       time.Now,
+		providers: make(map[string]SecretProvider),
+		cache:     make(map[string]cachedSecret),
+	}
+
+	resolver.Register("env", &EnvSecretProvider{})
+
+	return resolver
+}
+
+// Register adds or replaces the provider for the given name.
+func (r *SecretResolver) Register(name string, provider SecretProvider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providers[name] = provider
+	for ref := range r.cache {
+		if p, _, _ := ParseSecretReference(ref); p == name {
+			delete(r.cache, ref)
+		}
+	}
+}
+
+// Resolve returns the secret for the given reference, either from the cache or from the
+// registered provider.
+func (r *SecretResolver) Resolve(ctx context.Context, ref string) (Secret, error) {
+	providerName, path, err := ParseSecretReference(ref)
+	if err != nil {
+		return Secret{}, err
+	}
+
+	r.mu.RLock()
+	cached, isCached := r.cache[ref]
+	provider, isRegistered := r.providers[providerName]
+	r.mu.RUnlock()
+
+	if isCached && r.now().Before(cached.expiresAt) {
+		return cached.secret, nil
+	}
+	if !isRegistered {
+		return Secret{}, fmt.Errorf("%w: %s", ErrUnknownSecretProvider, providerName)
+	}
+
+	value, err := provider.Resolve(ctx, path)
+	if err != nil {
+		return Secret{}, fmt.Errorf("failed to resolve secret from provider %s: %w", providerName, err)
+	}
+
+	secret := NewSecret(value)
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[ref] = cachedSecret{secret: secret, expiresAt: r.now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+
+	return secret, nil
+}
+
+// Purge drops all cached secrets.
+func (r *SecretResolver) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]cachedSecret)
+}
+
+// GetSecret retrieves a secret from the configuration. Secret references are resolved with the
+// given resolver, plain string values are wrapped as they are.
+func (c *Config) GetSecret(ctx context.Context, resolver *SecretResolver, key string) (Secret, error) {
+	if c == nil {
+		return Secret{}, errors.New("config is nil")
+	}
+
+	val, ok := c.Properties[key]
+	if !ok {
+		return Secret{}, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+
+	switch v := val.(type) {
+	case Secret:
+		return v, nil
+	case string:
+		if !IsSecretReference(v) {
+			return NewSecret(v), nil
+		}
+		if resolver == nil {
+			return Secret{}, errors.New("secret resolver is nil")
+		}
+		return resolver.Resolve(ctx, v)
+	default:
+		return Secret{}, fmt.Errorf("%w: expected secret but got %T", ErrWrongType, val)
+	}
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	_ SecretProvider = &FileSecretProvider{}
+	_ SecretProvider = &EnvSecretProvider{}
+	_ SecretProvider = &HTTPSecretProvider{}
+)
+
+// FileSecretProvider reads secrets from files below BaseDir, which is required. Paths are
+// resolved relative to BaseDir and cannot escape it, neither through ".." nor through symbolic
+// links, so that a config served by the backend cannot read arbitrary files of the device.
+// Surrounding whitespace is trimmed.
+type FileSecretProvider struct {
+	BaseDir string
+}
+
+func (p *FileSecretProvider) Resolve(ctx context.Context, path string) (string, error) {
+	if p.BaseDir == "" {
+		return "", errors.New("file secret provider requires a base directory")
+	}
+
+	root, err := os.OpenRoot(p.BaseDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open secret directory: %w", err)
+	}
+	defer root.Close()
+
+	file, err := root.Open(filepath.FromSlash(strings.TrimPrefix(path, "/")))
+	if err != nil {
+		return "", fmt.Errorf("failed to open secret file: %w", err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// EnvSecretProvider reads secrets from environment variables.
+type EnvSecretProvider struct{}
+
+func (p *EnvSecretProvider) Resolve(ctx context.Context, path string) (string, error) {
+	value, ok := os.LookupEnv(path)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", path)
+	}
+
+	return value, nil
+}
+
+// HTTPSecretProvider fetches secrets from a vault-like HTTP endpoint. The secret path is
+// appended to BaseURL and the endpoint is expected to answer with {"value": "<secret>"}.
+type HTTPSecretProvider struct {
+	Client  *http.Client
+	BaseURL string
+	Token   string
+}
+
+func (p *HTTPSecretProvider) Resolve(ctx context.Context, path string) (string, error) {
+	if p.Client == nil {
+		return "", errors.New("http client cannot be nil")
+	}
+
+	endpoint, err := url.JoinPath(p.BaseURL, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to build secret url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Value *string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode secret response: %w", err)
+	}
+	if body.Value == nil {
+		return "", errors.New("response does not contain a secret value")
+	}
+
+	return *body.Value, nil
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecretReference(t *testing.T) {
+	tests := []struct {
+		name         string
+		ref          string
+		wantProvider string
+		wantPath     string
+		wantErr      bool
+	}{
+		{
+			name:         "file reference",
+			ref:          "secret://file/etc/creds/db",
+			wantProvider: "file",
+			wantPath:     "etc/creds/db",
+		},
+		{
+			name:         "env reference",
+			ref:          "secret://env/DB_PASS",
+			wantProvider: "env",
+			wantPath:     "DB_PASS",
+		},
+		{
+			name:    "missing path",
+			ref:     "secret://env",
+			wantErr: true,
+		},
+		{
+			name:    "plain value",
+			ref:     "DB_PASS",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			provider, path, err := ParseSecretReference(tt.ref)
+
+			// then
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrNotSecretReference)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantProvider, provider)
+			require.Equal(t, tt.wantPath, path)
+		})
+	}
+}
+
+func TestSecretResolverBuiltInProviders(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "db"), []byte("file-secret\n"), 0600))
+	t.Setenv("TEST_SECRET_DB_PASS", "env-secret")
+
+	resolver := NewSecretResolver(time.Minute)
+	resolver.Register("file", &FileSecretProvider{BaseDir: dir})
+
+	config := &Config{Properties: Properties{
+		"file":    "secret://file/db",
+		"env":     "secret://env/TEST_SECRET_DB_PASS",
+		"plain":   "not-a-reference",
+		"missing": "secret://env/TEST_SECRET_MISSING",
+		"unknown": "secret://unknown/foo",
+	}}
+	ctx := context.Background()
+
+	// when
+	fileSecret, fileErr := config.GetSecret(ctx, resolver, "file")
+	envSecret, envErr := config.GetSecret(ctx, resolver, "env")
+	plainSecret, plainErr := config.GetSecret(ctx, resolver, "plain")
+	_, missingErr := config.GetSecret(ctx, resolver, "missing")
+	_, unknownErr := config.GetSecret(ctx, resolver, "unknown")
+
+	// then
+	require.NoError(t, fileErr)
+	require.Equal(t, "file-secret", fileSecret.Reveal())
+	require.NoError(t, envErr)
+	require.Equal(t, "env-secret", envSecret.Reveal())
+	require.NoError(t, plainErr)
+	require.Equal(t, "not-a-reference", plainSecret.Reveal())
+	require.Error(t, missingErr)
+	require.ErrorIs(t, unknownErr, ErrUnknownSecretProvider)
+}
+
+func TestFileSecretProviderConfinesToBaseDir(t *testing.T) {
+	// given
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "secrets")
+	require.NoError(t, os.Mkdir(dir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "outside"), []byte("outside"), 0600))
+	require.NoError(t, os.Symlink(filepath.Join(parent, "outside"), filepath.Join(dir, "link")))
+	provider := &FileSecretProvider{BaseDir: dir}
+	ctx := context.Background()
+
+	// when
+	_, traversalErr := provider.Resolve(ctx, "../outside")
+	_, symlinkErr := provider.Resolve(ctx, "link")
+	_, noBaseDirErr := (&FileSecretProvider{}).Resolve(ctx, filepath.Join(parent, "outside"))
+
+	// then
+	require.Error(t, traversalErr)
+	require.Error(t, symlinkErr)
+	require.Error(t, noBaseDirErr)
+}
+
+func TestSecretResolverHTTPProviderAndCache(t *testing.T) {
+	// given
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/v1/secrets/db/password" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"value": fmt.Sprintf("vault-secret-%d", requests.Load())})
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	resolver := NewSecretResolver(time.Minute)
+	resolver.now = func() time.Time { return now }
+	resolver.Register("vault", &HTTPSecretProvider{Client: server.Client(), BaseURL: server.URL + "/v1/secrets", Token: "token"})
+	ctx := context.Background()
+
+	// when
+	first, err := resolver.Resolve(ctx, "secret://vault/db/password")
+	require.NoError(t, err)
+	second, err := resolver.Resolve(ctx, "secret://vault/db/password")
+	require.NoError(t, err)
+
+	// then
+	require.Equal(t, "vault-secret-1", first.Reveal())
+	require.Equal(t, first, second, "second resolve should be served from cache")
+	require.EqualValues(t, 1, requests.Load())
+
+	// when
+	now = now.Add(2 * time.Minute)
+	third, err := resolver.Resolve(ctx, "secret://vault/db/password")
+
+	// then
+	require.NoError(t, err)
+	require.Equal(t, "vault-secret-2", third.Reveal(), "expired secret should be resolved again")
+
+	// when
+	_, err = resolver.Resolve(ctx, "secret://vault/db/unknown")
+
+	// then
+	require.Error(t, err)
+}
+
+func TestSecretIsRedacted(t *testing.T) {
+	// given
+	secret := NewSecret("super-secret")
+
+	// when
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("resolved", "secret", secret)
+	data, err := json.Marshal(map[string]interface{}{"secret": secret})
+	require.NoError(t, err)
+
+	// then
+	require.NotContains(t, logs.String(), "super-secret")
+	require.NotContains(t, string(data), "super-secret")
+	require.NotContains(t, fmt.Sprintf("%v %s %#v", secret, secret, secret), "super-secret")
+	require.Equal(t, "super-secret", secret.Reveal())
+}
+
+func TestSecretIsNeverStored(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "config.json")
+	storage := NewFileStorage(path)
+	config := &Config{Properties: Properties{
+		"reference": "secret://env/DB_PASS",
+		"resolved":  NewSecret("super-secret"),
+	}}
+
+	// when
+	require.NoError(t, storage.Save(context.Background(), config))
+
+	// then
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "secret://env/DB_PASS")
+	require.NotContains(t, string(data), "super-secret")
+}
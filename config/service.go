@@ -2,7 +2,8 @@ package config
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -15,9 +16,11 @@ import (
 
 	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
 	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
 	"github.com/dtomschitz/headless-go-client/event"
 	"github.com/dtomschitz/headless-go-client/logger"
 	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/metrics"
 )
 
 type (
@@ -26,6 +29,10 @@ type (
 
 		envKeyPrefix      string
 		extendWithEnvVars bool
+		overridePath      string
+		watchOverride     bool
+		overrideDebounce  time.Duration
+		overridePoll      time.Duration
 		initialPollDelay  time.Duration
 		pollInterval      time.Duration
 
@@ -34,16 +41,42 @@ type (
 		events event.Emitter
 
 		manifestRequester manifest.ManifestRequester
+		bundleKeys        []ed25519.PublicKey
+		allowDowngrade    bool
 
-		current *Config
-		storage ConfigStorage
-		mu      sync.RWMutex
+		current   *Config
+		remote    *Config
+		overrides Properties
+		validator ConfigValidator
+		storage   ConfigStorage
+		secrets   *SecretResolver
+		mu        sync.RWMutex
+
+		listenersMu sync.Mutex
+		listeners   map[chan *Config]struct{}
 
 		internalCtx    context.Context
 		internalCancel context.CancelFunc
 		wg             sync.WaitGroup
 		shutdownOnce   sync.Once
 	}
+
+	// ConfigValidator is called with every config before it becomes the current config. A
+	// returned error rejects the config and keeps the previous one.
+	ConfigValidator func(config *Config) error
+
+	// ConfigChangeFunc is called with the new config whenever the properties of the current
+	// config change, either through a remote refresh or a local override file.
+	ConfigChangeFunc func(ctx context.Context, config *Config)
+
+	// RefreshPayload is the payload of RefreshConfigEvent and ConfigRefreshedEvent. Source is
+	// set for refreshes that were not triggered by the remote config.
+	RefreshPayload struct {
+		Source string `json:"source,omitempty"`
+	}
+
+	// fetchFunc returns the payload at url together with the codec decoding it.
+	fetchFunc func(ctx context.Context, url string) ([]byte, Codec, error)
 )
 
 const (
@@ -54,6 +87,12 @@ const (
 	ConfigRefreshedEvent event.EventType = "config_refreshed"
 )
 
+func init() {
+	event.MustRegisterPayload(RefreshConfigEvent, 1, RefreshPayload{})
+	event.MustRegisterPayload(ConfigRefreshedEvent, 1, RefreshPayload{})
+	event.RegisterPriority(ConfigRefreshedEvent, event.PriorityLifecycle)
+}
+
 func NewService(ctx context.Context, manifestURL string, opts ...ConfigServiceOption) (*ConfigService, error) {
 	internalCtx, internalCancel := context.WithCancel(ctx)
 	internalCtx = context.WithValue(internalCtx, commonCtx.ServiceKey, ServiceName)
@@ -69,6 +108,10 @@ func NewService(ctx context.Context, manifestURL string, opts ...ConfigServiceOp
 		client:            client,
 		manifestRequester: manifest.NewDefaultManifestRequester(client),
 		storage:           NewInMemoryStorage(),
+		secrets:           NewSecretResolver(5 * time.Minute),
+		overrideDebounce:  500 * time.Millisecond,
+		overridePoll:      2 * time.Second,
+		listeners:         make(map[chan *Config]struct{}),
 		internalCtx:       internalCtx,
 		internalCancel:    internalCancel,
 	}
@@ -85,6 +128,23 @@ func NewService(ctx context.Context, manifestURL string, opts ...ConfigServiceOp
 	if err != nil {
 		return nil, fmt.Errorf("failed to load initial config from storage: %w", err)
 	}
+	service.remote = service.current
+
+	if service.overridePath == "" && service.watchOverride {
+		internalCancel()
+		return nil, errors.New("override file watching requires an override file")
+	}
+
+	if service.remote != nil {
+		service.current = service.compose(service.remote, nil)
+		if service.overridePath != "" {
+			if merged, overrides, err := service.applyOverrideFile(service.remote); err != nil {
+				service.logger.Warn("failed to apply override file", "path", service.overridePath, "error", err)
+			} else {
+				service.current, service.overrides = merged, overrides
+			}
+		}
+	}
 
 	if err := service.Refresh(ctx); err != nil {
 		internalCancel()
@@ -92,6 +152,9 @@ func NewService(ctx context.Context, manifestURL string, opts ...ConfigServiceOp
 	}
 
 	service.start(internalCtx)
+	if service.watchOverride {
+		service.watchOverrideFile(internalCtx)
+	}
 	service.logger.Info("started service successfully", "pollInterval", service.pollInterval)
 
 	return service, nil
@@ -100,6 +163,7 @@ func NewService(ctx context.Context, manifestURL string, opts ...ConfigServiceOp
 func (cs *ConfigService) start(ctx context.Context) {
 	cs.wg.Add(1)
 	go func() {
+		defer recovery.Recover(ServiceName)
 		defer cs.wg.Done()
 
 		if cs.initialPollDelay > 0 {
@@ -158,11 +222,64 @@ func (cs *ConfigService) Current() *Config {
 	return deepCopyConfig(cs.current)
 }
 
+// ListenForChanges calls fn with the new config whenever the current config changes until ctx
+// is cancelled. If changes happen faster than fn returns, only the latest config is delivered.
+func (cs *ConfigService) ListenForChanges(ctx context.Context, fn ConfigChangeFunc) {
+	changes := make(chan *Config, 1)
+
+	cs.listenersMu.Lock()
+	cs.listeners[changes] = struct{}{}
+	cs.listenersMu.Unlock()
+
+	go func() {
+		defer recovery.Recover(ServiceName)
+		defer func() {
+			cs.listenersMu.Lock()
+			delete(cs.listeners, changes)
+			cs.listenersMu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case config := <-changes:
+				fn(ctx, config)
+			}
+		}
+	}()
+}
+
+func (cs *ConfigService) notifyChange(config *Config) {
+	cs.listenersMu.Lock()
+	defer cs.listenersMu.Unlock()
+
+	for changes := range cs.listeners {
+		// Replace a pending config that has not been consumed yet.
+		select {
+		case <-changes:
+		default:
+		}
+		changes <- deepCopyConfig(config)
+	}
+}
+
+// GetSecret resolves the secret stored under key in the current config. Resolved values are
+// only cached by the SecretResolver and never become part of the stored config.
+func (cs *ConfigService) GetSecret(ctx context.Context, key string) (Secret, error) {
+	cs.mu.RLock()
+	current := cs.current
+	cs.mu.RUnlock()
+
+	return current.GetSecret(ctx, cs.secrets, key)
+}
+
 func (cs *ConfigService) Refresh(ctx context.Context) error {
 	cs.logger.Info("refreshing config from remote")
 	cs.events.Push(event.NewEvent(ctx, RefreshConfigEvent))
 
 	if err := cs.refresh(ctx); err != nil {
+		metrics.DefaultRegistry.Counter("config_refresh_failures_total", "Number of failed config refreshes.", nil).Inc()
 		cs.events.Push(event.NewEventFromError(ctx, RefreshConfigEvent, err))
 		return fmt.Errorf("failed to refresh config: %w", err)
 	}
@@ -173,34 +290,43 @@ func (cs *ConfigService) Refresh(ctx context.Context) error {
 }
 
 func (cs *ConfigService) refresh(ctx context.Context) error {
+	cs.mu.RLock()
+	remote := cs.remote
+	cs.mu.RUnlock()
+
+	if remote != nil {
+		ctx = manifest.WithCurrentVersion(ctx, remote.Version, remote.Hash)
+	}
+
 	manifest, err := cs.manifestRequester.Fetch(ctx, cs.manifestURL)
 	if err != nil {
 		return fmt.Errorf("failed to fetch manifest: %w", err)
 	}
 
-	if cs.current != nil && manifest.Version == cs.current.Version && manifest.Hash == cs.current.Hash {
+	if remote != nil && manifest.Version == remote.Version && manifest.Hash == remote.Hash {
 		cs.logger.Info("config is up to date", "version", manifest.Version)
 		return nil
 	}
 
 	cs.logger.Info("fetched latest manifest for client", "version", manifest.Version)
 
-	config, err := cs.fetchFromRemote(ctx, manifest.URL)
-	if err != nil {
-		return fmt.Errorf("failed to fetch config: %w", err)
-	}
-
-	cs.logger.Info("fetched latest remote config", "version", manifest.Version)
+	return cs.apply(ctx, manifest, cs.fetchFromRemote)
+}
 
-	if err := manifest.Verify(config); err != nil {
-		return fmt.Errorf("failed to verify config: %w", err)
+// apply fetches, verifies and stores the config described by the manifest and makes it the
+// current config. Payloads are read through fetch, so that configs of remote servers and
+// offline bundles pass the same pipeline.
+func (cs *ConfigService) apply(ctx context.Context, manifest *manifest.Manifest, fetch fetchFunc) error {
+	properties, err := cs.fetchPatched(ctx, manifest, fetch)
+	if err != nil {
+		cs.logger.Warn("failed to apply config patch, falling back to full fetch", "error", err)
+		properties = nil
 	}
 
-	cs.logger.Info("verified config")
-
-	var properties Properties
-	if err := json.Unmarshal(config, &properties); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+	if properties == nil {
+		if properties, err = cs.fetchFull(ctx, manifest, fetch); err != nil {
+			return err
+		}
 	}
 
 	newConfig := &Config{
@@ -209,48 +335,90 @@ func (cs *ConfigService) refresh(ctx context.Context) error {
 		Properties: properties,
 	}
 
-	if cs.extendWithEnvVars {
-		cs.logger.Debug("extending config with environment variables")
-		newConfig = cs.extendWithEnvironmentVariables(newConfig)
-	}
-
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 
-	if isConfigContentEqual(newConfig, cs.current) {
+	overrides := cs.overrides
+	if cs.overridePath != "" && !cs.watchOverride {
+		if fileOverrides, err := cs.readOverrideFile(); err != nil {
+			cs.logger.Warn("failed to read override file", "path", cs.overridePath, "error", err)
+		} else {
+			overrides = fileOverrides
+		}
+	}
+
+	merged, err := cs.applyOverrides(newConfig, overrides)
+	if err != nil {
+		return err
+	}
+
+	changed := !isConfigContentEqual(cs.current, merged)
+	if !changed {
 		cs.logger.Info("config properties have not changed")
 	}
 
 	if err := cs.storage.Save(ctx, newConfig); err != nil {
 		return fmt.Errorf("failed to store config: %w", err)
 	}
-	cs.current = newConfig
+	cs.remote = newConfig
+	cs.overrides = overrides
+	cs.current = merged
+	cs.secrets.Purge()
+
+	if changed {
+		cs.notifyChange(merged)
+	}
 
 	return nil
 }
 
-func (cs *ConfigService) fetchFromRemote(ctx context.Context, url string) ([]byte, error) {
+// fetchFull downloads and verifies the complete config document referenced by the manifest.
+func (cs *ConfigService) fetchFull(ctx context.Context, manifest *manifest.Manifest, fetch fetchFunc) (Properties, error) {
+	config, codec, err := fetch(ctx, manifest.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch config: %w", err)
+	}
+
+	cs.logger.Info("fetched latest remote config", "version", manifest.Version)
+
+	if err := manifest.Verify(config); err != nil {
+		return nil, fmt.Errorf("failed to verify config: %w", err)
+	}
+
+	cs.logger.Info("verified config")
+
+	var properties Properties
+	if err := codec.Unmarshal(config, &properties); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s config: %w", codec.Name(), err)
+	}
+
+	return properties, nil
+}
+
+// fetchFromRemote downloads the config payload and returns it together with the codec
+// matching the Content-Type of the response.
+func (cs *ConfigService) fetchFromRemote(ctx context.Context, url string) ([]byte, Codec, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	resp, err := cs.client.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	config, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	return config, nil
+	return config, CodecForContentType(resp.Header.Get("Content-Type")), nil
 }
 
 func (cs *ConfigService) extendWithEnvironmentVariables(baseConfig *Config) *Config {
@@ -302,6 +470,7 @@ func deepCopyConfig(config *Config) *Config {
 
 	copied := &Config{
 		Version:    config.Version,
+		Hash:       config.Hash,
 		Properties: make(map[string]interface{}, len(config.Properties)),
 	}
 
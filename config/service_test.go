@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/stretchr/testify/require"
+)
+
+// newConfigServer serves a manifest at /manifest pointing to the given payload at /config.
+func newConfigServer(t *testing.T, version string, contentType string, payload []byte) *httptest.Server {
+	t.Helper()
+
+	sum := sha256.Sum256(payload)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mux.HandleFunc("/manifest", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(manifest.Manifest{
+			Version: version,
+			Hash:    "sha256:" + hex.EncodeToString(sum[:]),
+			URL:     server.URL + "/config",
+		})
+	})
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Write(payload)
+	})
+
+	return server
+}
+
+func TestConfigServiceRefreshHonorsContentType(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/yaml", []byte("logLevel: debug\nretries: 3\n"))
+	ctx := context.Background()
+
+	// when
+	service, err := NewService(ctx, server.URL+"/manifest", WithHTTPClient(server.Client()), WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())))
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	// then
+	current := service.Current()
+	logLevel, err := current.GetString("logLevel")
+	require.NoError(t, err)
+	require.Equal(t, "debug", logLevel)
+
+	retries, err := current.GetInt("retries")
+	require.NoError(t, err)
+	require.Equal(t, 3, retries)
+}
+
+func TestConfigServiceAppliesOverrideFile(t *testing.T) {
+	// given
+	server := newConfigServer(t, "v1", "application/json", []byte(`{"logLevel": "info", "retries": 3}`))
+	overridePath := filepath.Join(t.TempDir(), "override.env")
+	require.NoError(t, os.WriteFile(overridePath, []byte("logLevel=debug\n"), 0644))
+	ctx := context.Background()
+
+	// when
+	service, err := NewService(ctx, server.URL+"/manifest",
+		WithHTTPClient(server.Client()),
+		WithManifestRequester(manifest.NewDefaultManifestRequester(server.Client())),
+		WithOverrideFile(overridePath),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	// then
+	current := service.Current()
+	logLevel, err := current.GetString("logLevel")
+	require.NoError(t, err)
+	require.Equal(t, "debug", logLevel, "override file should take precedence")
+
+	retries, err := current.GetInt("retries")
+	require.NoError(t, err)
+	require.Equal(t, 3, retries)
+}
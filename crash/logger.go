@@ -0,0 +1,85 @@
+package crash
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type (
+	// logBuffer keeps the most recent log lines in a ring buffer.
+	logBuffer struct {
+		mu    sync.Mutex
+		buf   []string
+		next  int
+		count int
+	}
+
+	recordingLogger struct {
+		next logger.Logger
+		logs *logBuffer
+	}
+)
+
+func newLogBuffer(size int) *logBuffer {
+	return &logBuffer{buf: make([]string, size)}
+}
+
+func (b *logBuffer) add(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf[b.next] = line
+	b.next = (b.next + 1) % len(b.buf)
+	b.count = min(b.count+1, len(b.buf))
+}
+
+// lines returns the buffered lines from oldest to newest.
+func (b *logBuffer) lines() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	lines := make([]string, 0, b.count)
+	start := (b.next - b.count + len(b.buf)) % len(b.buf)
+	for i := 0; i < b.count; i++ {
+		lines = append(lines, b.buf[(start+i)%len(b.buf)])
+	}
+	return lines
+}
+
+func (l *recordingLogger) Debug(msg string, args ...any) {
+	l.record("DEBUG", msg, args)
+	l.next.Debug(msg, args...)
+}
+
+func (l *recordingLogger) Info(msg string, args ...any) {
+	l.record("INFO", msg, args)
+	l.next.Info(msg, args...)
+}
+
+func (l *recordingLogger) Warn(msg string, args ...any) {
+	l.record("WARN", msg, args)
+	l.next.Warn(msg, args...)
+}
+
+func (l *recordingLogger) Error(msg string, args ...any) {
+	l.record("ERROR", msg, args)
+	l.next.Error(msg, args...)
+}
+
+func (l *recordingLogger) record(level, msg string, args []any) {
+	var b strings.Builder
+	b.WriteString(time.Now().Format(time.RFC3339Nano))
+	b.WriteString(" " + level + " " + msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", args[i])
+		}
+	}
+	l.logs.add(b.String())
+}
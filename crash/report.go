@@ -0,0 +1,116 @@
+package crash
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+type (
+	// Report describes a panic of a goroutine. It is persisted before the process exits and
+	// uploaded as CrashReportEvent on the next start.
+	Report struct {
+		Id        string    `json:"id"`
+		Timestamp time.Time `json:"timestamp"`
+		// Goroutine is the name passed to recovery.Recover by the panicking goroutine.
+		Goroutine string `json:"goroutine"`
+		// Panic is the formatted value passed to panic.
+		Panic string `json:"panic"`
+		// Error is the error chain of the panic value, if it is an error.
+		Error *ErrorInfo `json:"error,omitempty"`
+		Stack string     `json:"stack"`
+		// Goroutines is the stack dump of all goroutines, truncated to the configured size.
+		Goroutines string     `json:"goroutines,omitempty"`
+		Build      *BuildInfo `json:"build,omitempty"`
+		// Logs are the most recent log lines written through the logger of the Reporter.
+		Logs []string `json:"logs,omitempty"`
+	}
+
+	// ErrorInfo is a single error of an error chain. Causes holds the errors returned by
+	// Unwrap, which are several for errors created by errors.Join.
+	ErrorInfo struct {
+		Message string       `json:"message"`
+		Type    string       `json:"type"`
+		Causes  []*ErrorInfo `json:"causes,omitempty"`
+	}
+
+	BuildInfo struct {
+		GoVersion string            `json:"goVersion"`
+		Path      string            `json:"path,omitempty"`
+		Version   string            `json:"version,omitempty"`
+		Settings  map[string]string `json:"settings,omitempty"`
+	}
+)
+
+// maxErrorDepth bounds the error chain of errors that wrap themselves.
+const maxErrorDepth = 32
+
+// ErrorChain returns the error chain of err following errors.Unwrap and errors.Join.
+func ErrorChain(err error) *ErrorInfo {
+	return errorChain(err, 0)
+}
+
+func errorChain(err error, depth int) *ErrorInfo {
+	if err == nil {
+		return nil
+	}
+
+	info := &ErrorInfo{Message: err.Error(), Type: reflect.TypeOf(err).String()}
+	if depth >= maxErrorDepth {
+		return info
+	}
+
+	var causes []error
+	switch e := err.(type) {
+	case interface{ Unwrap() []error }:
+		causes = e.Unwrap()
+	default:
+		causes = []error{errors.Unwrap(err)}
+	}
+
+	for _, cause := range causes {
+		if c := errorChain(cause, depth+1); c != nil {
+			info.Causes = append(info.Causes, c)
+		}
+	}
+	return info
+}
+
+func formatPanic(recovered any) string {
+	if err, ok := recovered.(error); ok {
+		return err.Error()
+	}
+	return fmt.Sprint(recovered)
+}
+
+func readBuildInfo() *BuildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return &BuildInfo{GoVersion: runtime.Version()}
+	}
+
+	build := &BuildInfo{GoVersion: info.GoVersion, Path: info.Main.Path, Version: info.Main.Version}
+	for _, s := range info.Settings {
+		if build.Settings == nil {
+			build.Settings = make(map[string]string)
+		}
+		build.Settings[s.Key] = s.Value
+	}
+	return build
+}
+
+// goroutineDump returns the stacks of all goroutines, truncated to maxBytes.
+func goroutineDump(maxBytes int) string {
+	size := 64 << 10
+	for {
+		buf := make([]byte, min(size, maxBytes))
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxBytes {
+			return string(buf[:n])
+		}
+		size *= 2
+	}
+}
@@ -0,0 +1,268 @@
+package crash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Reporter captures panics of goroutines guarded by recovery.Recover as crash reports. The
+	// reports are written to disk before the process exits and polled as CrashReportEvent by
+	// the event.Service on the next start. Reports are deleted once their upload is
+	// acknowledged.
+	Reporter struct {
+		ctx    context.Context
+		config ReporterConfig
+		logs   *logBuffer
+
+		mu       sync.Mutex
+		inflight map[string]string
+	}
+
+	ReporterConfig struct {
+		// Dir is the directory the reports are persisted in. Required.
+		Dir string
+		// LogLines is the number of recent log lines attached to a report. Defaults to 100.
+		LogLines int
+		// MaxGoroutineDump limits the size of the goroutine dump in bytes. Defaults to 256KiB.
+		MaxGoroutineDump int
+	}
+)
+
+const (
+	ServiceName = "CrashReporter"
+
+	CrashReportEvent event.EventType = "crash_report"
+
+	reportPrefix = "crash-"
+	reportSuffix = ".json"
+)
+
+var _ event.AckProducer = &Reporter{}
+
+func init() {
+	event.MustRegisterPayload(CrashReportEvent, 1, Report{})
+	event.RegisterPriority(CrashReportEvent, event.PriorityCritical)
+}
+
+// NewReporter creates a Reporter persisting reports in config.Dir. Call Install to capture
+// panics and register the Reporter as producer of the event.Service to upload them.
+func NewReporter(ctx context.Context, config ReporterConfig) (*Reporter, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("crash report directory cannot be empty")
+	}
+	if config.LogLines <= 0 {
+		config.LogLines = 100
+	}
+	if config.MaxGoroutineDump <= 0 {
+		config.MaxGoroutineDump = 256 << 10
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create crash report directory: %w", err)
+	}
+
+	return &Reporter{
+		ctx:      context.WithValue(ctx, commonCtx.ServiceKey, ServiceName),
+		config:   config,
+		logs:     newLogBuffer(config.LogLines),
+		inflight: make(map[string]string),
+	}, nil
+}
+
+// Install makes the Reporter the handler of recovery.Recover.
+func (r *Reporter) Install() {
+	recovery.SetHandler(func(goroutine string, recovered any, stack []byte) {
+		if _, err := r.Capture(goroutine, recovered, stack); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to persist crash report: %v\n", err)
+		}
+	})
+}
+
+// Uninstall removes the handler of recovery.Recover.
+func (r *Reporter) Uninstall() {
+	recovery.SetHandler(nil)
+}
+
+// Capture creates a report for the recovered panic and persists it.
+func (r *Reporter) Capture(goroutine string, recovered any, stack []byte) (*Report, error) {
+	report := &Report{
+		Id:         uuid.New().String(),
+		Timestamp:  time.Now(),
+		Goroutine:  goroutine,
+		Panic:      formatPanic(recovered),
+		Stack:      string(stack),
+		Goroutines: goroutineDump(r.config.MaxGoroutineDump),
+		Build:      readBuildInfo(),
+		Logs:       r.logs.lines(),
+	}
+	if err, ok := recovered.(error); ok {
+		report.Error = ErrorChain(err)
+	}
+
+	return report, r.persist(report)
+}
+
+// persist writes the report atomically so that a crash while writing leaves no partial file.
+func (r *Reporter) persist(report *Report) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode crash report: %w", err)
+	}
+
+	name := fmt.Sprintf("%s%d-%s%s", reportPrefix, report.Timestamp.UnixNano(), report.Id, reportSuffix)
+	tmpFile, err := os.CreateTemp(r.config.Dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create crash report: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write crash report: %w", err)
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to sync crash report: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close crash report: %w", err)
+	}
+
+	return os.Rename(tmpFile.Name(), filepath.Join(r.config.Dir, name))
+}
+
+// PollEvents returns the persisted reports that are not awaiting acknowledgement.
+func (r *Reporter) PollEvents() []*event.Event {
+	entries, err := os.ReadDir(r.config.Dir)
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, reportPrefix) && strings.HasSuffix(name, reportSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	inflight := make(map[string]struct{}, len(r.inflight))
+	for _, path := range r.inflight {
+		inflight[path] = struct{}{}
+	}
+
+	var events []*event.Event
+	for _, name := range names {
+		path := filepath.Join(r.config.Dir, name)
+		if _, ok := inflight[path]; ok {
+			continue
+		}
+
+		report, err := readReport(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "discarding unreadable crash report %s: %v\n", path, err)
+			os.Remove(path)
+			continue
+		}
+
+		e := event.NewEvent(r.ctx, CrashReportEvent, event.WithPayload(report), event.WithMessage(report.Panic))
+		e.Id = report.Id
+		e.Timestamp = report.Timestamp
+		e.IsError = true
+
+		r.inflight[e.Id] = path
+		events = append(events, e)
+	}
+	return events
+}
+
+func readReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Ack deletes the reports of the delivered events.
+func (r *Reporter) Ack(events []*event.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for _, e := range events {
+		path, ok := r.inflight[e.Id]
+		if !ok {
+			continue
+		}
+		delete(r.inflight, e.Id)
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to delete crash reports: %v", errs)
+	}
+	return nil
+}
+
+// Nack releases the reports of the events so that they are polled again.
+func (r *Reporter) Nack(events []*event.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range events {
+		delete(r.inflight, e.Id)
+	}
+}
+
+func (r *Reporter) Name() string {
+	return ServiceName
+}
+
+// Close uninstalls the handler of recovery.Recover. Persisted reports are kept for the next start.
+func (r *Reporter) Close(ctx context.Context) error {
+	r.Uninstall()
+	return nil
+}
+
+// Logger returns a logger that keeps the recent lines for crash reports and forwards them to
+// next.
+func (r *Reporter) Logger(next logger.Logger) logger.Logger {
+	if next == nil {
+		next = &logger.NoopLogger{}
+	}
+	return &recordingLogger{next: next, logs: r.logs}
+}
+
+// LoggerFactory wraps the loggers created by factory with Logger.
+func (r *Reporter) LoggerFactory(factory logger.Factory) logger.Factory {
+	return func(ctx context.Context) logger.Logger {
+		return r.Logger(logger.New(ctx, factory))
+	}
+}
@@ -0,0 +1,111 @@
+package crash_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/crash"
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func panicGuarded(goroutine string, value any) (recovered any) {
+	defer func() { recovered = recover() }()
+
+	func() {
+		defer recovery.Recover(goroutine)
+		panic(value)
+	}()
+	return nil
+}
+
+func TestErrorChain(t *testing.T) {
+	// given
+	err := fmt.Errorf("refresh: %w", errors.Join(os.ErrNotExist, errors.New("timeout")))
+
+	// when
+	chain := crash.ErrorChain(err)
+
+	// then
+	assert.Equal(t, "*fmt.wrapError", chain.Type)
+	require.Len(t, chain.Causes, 1)
+	joined := chain.Causes[0]
+	require.Len(t, joined.Causes, 2)
+	assert.Equal(t, "file does not exist", joined.Causes[0].Message)
+	assert.Equal(t, "timeout", joined.Causes[1].Message)
+}
+
+func TestReporter_CapturesPanicsAndUploadsThemOnNextStart(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	reporter, err := crash.NewReporter(context.Background(), crash.ReporterConfig{Dir: dir, LogLines: 2})
+	require.NoError(t, err)
+	reporter.Install()
+
+	log := reporter.Logger(nil)
+	log.Info("first")
+	log.Warn("second", "attempt", 2)
+	log.Error("third")
+
+	// when
+	recovered := panicGuarded("UpdateService", fmt.Errorf("apply update: %w", os.ErrPermission))
+	reporter.Close(context.Background())
+
+	// then
+	require.Error(t, recovered.(error), "expected panic to be re-raised")
+
+	restarted, err := crash.NewReporter(context.Background(), crash.ReporterConfig{Dir: dir, LogLines: 2})
+	require.NoError(t, err)
+	defer restarted.Close(context.Background())
+	events := restarted.PollEvents()
+	require.Len(t, events, 1)
+
+	e := events[0]
+	assert.Equal(t, crash.CrashReportEvent, e.Type)
+	assert.True(t, e.IsError)
+	assert.Equal(t, "apply update: permission denied", e.Message)
+	assert.NotContains(t, e.Data, event.InvalidPayloadDataKey)
+	assert.Equal(t, "UpdateService", e.Data["goroutine"])
+	assert.Contains(t, e.Data["stack"], "panicGuarded")
+	assert.Contains(t, e.Data["goroutines"], "goroutine ")
+	assert.NotEmpty(t, e.Data["build"])
+
+	logs := e.Data["logs"].([]interface{})
+	require.Len(t, logs, 2)
+	assert.Contains(t, logs[0], "WARN second attempt=2")
+	assert.Contains(t, logs[1], "ERROR third")
+
+	chain := e.Data["error"].(map[string]interface{})
+	assert.Equal(t, "permission denied", chain["causes"].([]interface{})[0].(map[string]interface{})["message"])
+}
+
+func TestReporter_DeletesReportsOnceAcknowledged(t *testing.T) {
+	// given
+	dir := t.TempDir()
+	reporter, err := crash.NewReporter(context.Background(), crash.ReporterConfig{Dir: dir})
+	require.NoError(t, err)
+	defer reporter.Close(context.Background())
+	_, err = reporter.Capture("main", "boom", nil)
+	require.NoError(t, err)
+
+	// when
+	events := reporter.PollEvents()
+	require.Len(t, events, 1)
+	assert.Empty(t, reporter.PollEvents(), "expected inflight report not to be polled again")
+	reporter.Nack(events)
+	events = reporter.PollEvents()
+	require.Len(t, events, 1)
+	require.NoError(t, reporter.Ack(events))
+
+	// then
+	assert.Empty(t, reporter.PollEvents())
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -2,16 +2,28 @@ package event
 
 import (
 	"context"
-	"log/slog"
 	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
 )
 
 type (
+	// BufferedEmitter keeps events in memory until they are polled. Once the buffer is full, the
+	// eviction policy decides which event is dropped.
 	BufferedEmitter struct {
-		queue        chan *Event
-		bufferMu     sync.Mutex
-		buffer       []*Event
-		dropCallback func(*Event)
+		config BufferedEmitterConfig
+
+		mu      sync.Mutex
+		buffer  []*Event
+		dropped map[EventType]uint64
+		// evicted collects the events dropped while mu is held. They are passed to the drop
+		// callback once mu is released, so that the callback may push events itself.
+		evicted []*Event
+		// unreported counts the drops since the last drop report.
+		unreported map[EventType]uint64
+		// space is closed and replaced whenever room becomes available in the buffer.
+		space chan struct{}
 
 		closed chan struct{}
 		done   chan struct{}
@@ -19,94 +31,276 @@ type (
 	}
 
 	BufferedEmitterConfig struct {
-		BufferSize   int
-		DropCallback func(event *Event)
+		// BufferSize is the maximum number of events kept until the next poll. Defaults to 1024.
+		BufferSize int
+		// Eviction decides which event is dropped when the buffer is full. Defaults to
+		// DropNewest.
+		Eviction EvictionPolicy
+		// BlockTimeout is the time Push waits for space with BlockWithTimeout before the event
+		// is dropped. Defaults to one second.
+		BlockTimeout time.Duration
+		// Priorities assigns priorities to event types. Event types without an explicit priority
+		// get the priority registered with RegisterPriority. Other error events get
+		// PriorityError, all others PriorityInfo.
+		Priorities map[EventType]Priority
+		// ReportInterval enables a periodic DroppedEventsEvent with the number of events dropped
+		// per type since the last report. Zero disables reporting.
+		ReportInterval time.Duration
+		DropCallback   func(event *Event)
 	}
+
+	EvictionPolicy int
+
+	Priority int
+)
+
+const (
+	// DropNewest drops the event being pushed.
+	DropNewest EvictionPolicy = iota
+	// DropOldest drops the oldest buffered event.
+	DropOldest
+	// DropLowestPriority drops the oldest event with the lowest priority, which may be the
+	// event being pushed.
+	DropLowestPriority
+	// BlockWithTimeout blocks Push until space is available or the timeout elapsed.
+	BlockWithTimeout
+)
+
+const (
+	PriorityDebug Priority = iota
+	PriorityInfo
+	PriorityLifecycle
+	PriorityError
+	PriorityCritical
+)
+
+const (
+	DroppedEventsEvent EventType = "events_dropped"
+)
+
+var (
+	prioritiesMu sync.RWMutex
+	priorities   = map[EventType]Priority{}
 )
 
+func init() {
+	MustRegisterPayload(DroppedEventsEvent, 1, map[string]uint64{})
+	RegisterPriority(DroppedEventsEvent, PriorityCritical)
+}
+
+// RegisterPriority sets the default priority of the event type for all BufferedEmitters. It
+// is meant to be used in package initialization by the packages defining event types, e.g.
+// with PriorityLifecycle for events marking state changes of the client.
+func RegisterPriority(eventType EventType, priority Priority) {
+	prioritiesMu.Lock()
+	defer prioritiesMu.Unlock()
+	priorities[eventType] = priority
+}
+
+// NewBufferedEmitter creates a BufferedEmitter. The returned Emitter can be asserted to
+// *BufferedEmitter to access the drop counters.
 func NewBufferedEmitter(config BufferedEmitterConfig) Emitter {
 	if config.BufferSize <= 0 {
 		config.BufferSize = 1024
 	}
+	if config.BlockTimeout <= 0 {
+		config.BlockTimeout = time.Second
+	}
 
 	e := &BufferedEmitter{
-		queue:        make(chan *Event, config.BufferSize),
-		buffer:       make([]*Event, 0, config.BufferSize),
-		dropCallback: config.DropCallback,
-		closed:       make(chan struct{}),
-		done:         make(chan struct{}),
+		config:     config,
+		buffer:     make([]*Event, 0, config.BufferSize),
+		dropped:    make(map[EventType]uint64),
+		unreported: make(map[EventType]uint64),
+		space:      make(chan struct{}),
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 
-	go e.collector()
+	recovery.Go("BufferedEmitter", e.reporter)
 
 	return e
 }
 
-func (e *BufferedEmitter) collector() {
+// reporter periodically pushes a DroppedEventsEvent if events were dropped.
+func (e *BufferedEmitter) reporter() {
 	defer close(e.done)
 
-	// Drain any remaining events from the queue upon shutdown signal.
-	// This ensures no events are lost in the queue if Push stopped before
-	// the collector fully processes everything.
-	defer func() {
-		for {
-			select {
-			case evt := <-e.queue:
-				e.bufferMu.Lock()
-				e.buffer = append(e.buffer, evt)
-				e.bufferMu.Unlock()
-			default: // Queue is empty, done draining
-				return
-			}
-		}
-	}()
+	if e.config.ReportInterval <= 0 {
+		<-e.closed
+		return
+	}
+
+	ticker := time.NewTicker(e.config.ReportInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case evt := <-e.queue:
-			e.bufferMu.Lock()
-			e.buffer = append(e.buffer, evt)
-			e.bufferMu.Unlock()
+		case <-ticker.C:
+			e.reportDrops()
 		case <-e.closed:
 			return
 		}
 	}
 }
 
-// Push adds an event to the emitter queue. If the emitter is closed or the queue is full,
-// it will drop the event and call the drop callback if provided.
+func (e *BufferedEmitter) reportDrops() {
+	e.mu.Lock()
+	if len(e.unreported) == 0 {
+		e.mu.Unlock()
+		return
+	}
+
+	counts := make(map[string]interface{}, len(e.unreported))
+	for t, n := range e.unreported {
+		counts[string(t)] = n
+	}
+	e.unreported = make(map[EventType]uint64)
+	e.mu.Unlock()
+
+	e.Push(NewEvent(context.Background(), DroppedEventsEvent, WithData(counts)))
+}
+
+// Priority returns the priority of the event.
+func (e *BufferedEmitter) Priority(event *Event) Priority {
+	if p, ok := e.config.Priorities[event.Type]; ok {
+		return p
+	}
+
+	prioritiesMu.RLock()
+	p, ok := priorities[event.Type]
+	prioritiesMu.RUnlock()
+	if ok {
+		return p
+	}
+
+	if event.IsError {
+		return PriorityError
+	}
+	return PriorityInfo
+}
+
+// Push adds an event to the buffer. If the emitter is closed or the buffer is full, an event
+// is dropped according to the eviction policy and the drop callback is called if provided.
 func (e *BufferedEmitter) Push(event *Event) {
-	select {
-	case <-e.done: // If collector goroutine is done, emitter is fully closed
-		if e.dropCallback != nil {
-			e.dropCallback(event)
+	var deadline <-chan time.Time
+
+	for {
+		select {
+		case <-e.closed:
+			e.mu.Lock()
+			e.drop(event)
+			e.unlock()
+			return
+		default:
+		}
+
+		e.mu.Lock()
+		if len(e.buffer) < e.config.BufferSize {
+			e.buffer = append(e.buffer, event)
+			e.mu.Unlock()
+			return
+		}
+
+		switch e.config.Eviction {
+		case DropOldest:
+			e.drop(e.buffer[0])
+			e.buffer = append(e.buffer[1:], event)
+		case DropLowestPriority:
+			e.evictLowestPriority(event)
+		case BlockWithTimeout:
+			space := e.space
+			e.mu.Unlock()
+
+			if deadline == nil {
+				deadline = time.After(e.config.BlockTimeout)
+			}
+			select {
+			case <-space:
+				continue
+			case <-e.closed:
+				continue
+			case <-deadline:
+				e.mu.Lock()
+				e.drop(event)
+			}
+		default:
+			e.drop(event)
+		}
+		e.unlock()
+		return
+	}
+}
+
+// evictLowestPriority drops the oldest event with the lowest priority. The pushed event is
+// dropped instead if its priority is lower than that of all buffered events.
+func (e *BufferedEmitter) evictLowestPriority(event *Event) {
+	victim := -1
+	lowest := e.Priority(event)
+	for i, buffered := range e.buffer {
+		if p := e.Priority(buffered); p < lowest || (victim == -1 && p == lowest) {
+			victim, lowest = i, p
 		}
+	}
+
+	if victim == -1 {
+		e.drop(event)
 		return
-	default:
-		// Not fully closed yet, proceed
 	}
 
-	select {
-	case e.queue <- event:
-	default: // Queue is full, or it was just closed by the collector before this send
-		if e.dropCallback != nil {
-			e.dropCallback(event)
+	e.drop(e.buffer[victim])
+	e.buffer = append(e.buffer[:victim], e.buffer[victim+1:]...)
+	e.buffer = append(e.buffer, event)
+}
+
+// drop counts the event and queues it for the drop callback. It must be called with mu held.
+func (e *BufferedEmitter) drop(event *Event) {
+	e.dropped[event.Type]++
+	e.unreported[event.Type]++
+	countDropped("buffer", event)
+	e.evicted = append(e.evicted, event)
+}
+
+// unlock releases mu and passes the events dropped while it was held to the drop callback.
+func (e *BufferedEmitter) unlock() {
+	evicted := e.evicted
+	e.evicted = nil
+	e.mu.Unlock()
+
+	if e.config.DropCallback != nil {
+		for _, event := range evicted {
+			e.config.DropCallback(event)
 		}
 	}
 }
 
+// DroppedCounts returns the number of dropped events per type since the emitter was created.
+func (e *BufferedEmitter) DroppedCounts() map[EventType]uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	counts := make(map[EventType]uint64, len(e.dropped))
+	for t, n := range e.dropped {
+		counts[t] = n
+	}
+	return counts
+}
+
 // PollEvents returns and clears current event buffer
 func (e *BufferedEmitter) PollEvents() []*Event {
-	e.bufferMu.Lock()
-	defer e.bufferMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
 	events := e.buffer
-	e.buffer = make([]*Event, 0, cap(e.buffer))
+	e.buffer = make([]*Event, 0, e.config.BufferSize)
+
+	close(e.space)
+	e.space = make(chan struct{})
 	return events
 }
 
-// Close stops the internal collector goroutine and waits for it to finish.
-// It also ensures any remaining events in the queue are moved to the buffer
-// so they can be retrieved by PollEvents.
+// Close stops the drop reporter and waits for it to finish. Buffered events can still be
+// retrieved by PollEvents, events pushed afterwards are dropped.
 func (e *BufferedEmitter) Close(ctx context.Context) error {
 	var err error
 	e.once.Do(func() {
@@ -114,11 +308,8 @@ func (e *BufferedEmitter) Close(ctx context.Context) error {
 
 		select {
 		case <-e.done:
-			// Collector finished successfully
 		case <-ctx.Done():
-			// Context cancelled or timed out before collector finished
 			err = ctx.Err()
-			slog.Warn("BufferedEmitter collector did not finish draining in time", "error", err) // [CHANGE 20] Log warning
 		}
 	})
 
@@ -0,0 +1,86 @@
+package event
+
+import (
+	"context"
+	"sync"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+)
+
+type (
+	// CircuitBreakerProducer reports the state transitions of circuit breakers as
+	// CircuitStateChangedEvent.
+	CircuitBreakerProducer struct {
+		ctx         context.Context
+		unsubscribe func()
+
+		mu      sync.Mutex
+		pending []*Event
+	}
+
+	// CircuitStatePayload is the payload of CircuitStateChangedEvent.
+	CircuitStatePayload struct {
+		Host        string                  `json:"host"`
+		From        commonHttp.CircuitState `json:"from"`
+		To          commonHttp.CircuitState `json:"to"`
+		FailureRate float64                 `json:"failureRate"`
+	}
+)
+
+const (
+	CircuitStateChangedEvent EventType = "circuit_state_changed"
+
+	// maxPendingTransitions bounds the transitions kept between two polls of a flapping circuit.
+	maxPendingTransitions = 100
+)
+
+func init() {
+	MustRegisterPayload(CircuitStateChangedEvent, 1, CircuitStatePayload{})
+}
+
+// NewCircuitBreakerProducer subscribes to the transitions of the breakers. The events are
+// created with ctx, e.g. the context of the Service. Nil breakers select
+// commonHttp.DefaultCircuitBreakers.
+func NewCircuitBreakerProducer(ctx context.Context, breakers *commonHttp.CircuitBreakers) *CircuitBreakerProducer {
+	if breakers == nil {
+		breakers = commonHttp.DefaultCircuitBreakers
+	}
+
+	p := &CircuitBreakerProducer{ctx: ctx}
+	p.unsubscribe = breakers.Subscribe(p.record)
+	return p
+}
+
+func (p *CircuitBreakerProducer) record(transition commonHttp.CircuitTransition) {
+	evt := NewEvent(p.ctx, CircuitStateChangedEvent, WithPayload(CircuitStatePayload{
+		Host:        transition.Host,
+		From:        transition.From,
+		To:          transition.To,
+		FailureRate: transition.FailureRate,
+	}))
+	evt.Timestamp = transition.Time
+	evt.IsError = transition.To == commonHttp.CircuitOpen
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.pending) >= maxPendingTransitions {
+		countDropped("circuit", p.pending[0])
+		p.pending = p.pending[1:]
+	}
+	p.pending = append(p.pending, evt)
+}
+
+func (p *CircuitBreakerProducer) PollEvents() []*Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := p.pending
+	p.pending = nil
+	return events
+}
+
+func (p *CircuitBreakerProducer) Close(ctx context.Context) error {
+	p.unsubscribe()
+	return nil
+}
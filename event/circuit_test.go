@@ -0,0 +1,44 @@
+package event_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerProducer_ReportsTransitions(t *testing.T) {
+	// given
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	breakers := commonHttp.NewCircuitBreakers(commonHttp.CircuitBreakerConfig{MinRequests: 1, Cooldown: time.Hour})
+	producer := event.NewCircuitBreakerProducer(context.Background(), breakers)
+	defer producer.Close(context.Background())
+
+	client := commonHttp.NewClient(commonHttp.WithCircuitBreakers(breakers), commonHttp.WithRetry(0, time.Millisecond))
+
+	// when
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// then
+	events := producer.PollEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, event.CircuitStateChangedEvent, events[0].Type)
+	assert.True(t, events[0].IsError)
+	assert.Equal(t, "closed", events[0].Data["from"])
+	assert.Equal(t, "open", events[0].Data["to"])
+	assert.Equal(t, float64(1), events[0].Data["failureRate"])
+	assert.Empty(t, producer.PollEvents())
+}
@@ -0,0 +1,607 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+)
+
+type (
+	// DiskEmitter is a durable Emitter backed by an append-only, segmented log on disk. Polled
+	// events stay in the log until they are acknowledged, so events survive crashes, restarts
+	// and failed flushes.
+	DiskEmitter struct {
+		config DiskEmitterConfig
+
+		mu       sync.Mutex
+		segments []*segment
+		active   *os.File
+		nextSeq  uint64
+		dirty    bool
+		closed   bool
+
+		// ackPos points behind the last record that was acknowledged in log order, readPos
+		// behind the last record handed out by PollEvents.
+		ackPos   position
+		readPos  position
+		inflight []*lease
+		// leases holds the leases of inflight by sequence number, as producers may change the
+		// ids of polled events.
+		leases map[uint64]*lease
+		// redeliver holds released events, which are returned by PollEvents before new events.
+		redeliver []*Event
+		// dropped collects dropped events, which are passed to the drop callback after the lock
+		// is released so that the callback may use the emitter.
+		dropped []*Event
+
+		stopSync chan struct{}
+		syncDone chan struct{}
+	}
+
+	DiskEmitterConfig struct {
+		// Dir is the directory the log segments and the cursor are stored in.
+		Dir string
+		// MaxSegmentBytes is the size after which a new segment is started. Defaults to 4 MiB.
+		MaxSegmentBytes int64
+		// MaxTotalBytes caps the size of the log. The oldest segments are dropped once the cap
+		// is exceeded. Defaults to 64 MiB.
+		MaxTotalBytes int64
+		// MaxAge drops segments whose newest event is older than the given age. Zero disables
+		// the age cap.
+		MaxAge time.Duration
+		// BatchSize is the maximum number of events returned by a single PollEvents call.
+		// Defaults to 1000.
+		BatchSize int
+		// SyncPolicy controls when the log is fsynced to disk. Defaults to SyncInterval.
+		SyncPolicy SyncPolicy
+		// SyncInterval is the fsync interval used with SyncInterval. Defaults to one second.
+		SyncInterval time.Duration
+		// DropCallback is called for events that are dropped because they could not be
+		// written or were evicted by a size or age cap before being acknowledged.
+		DropCallback func(event *Event)
+	}
+
+	SyncPolicy int
+
+	position struct {
+		BaseSeq uint64 `json:"baseSeq"`
+		Offset  int64  `json:"offset"`
+	}
+
+	lease struct {
+		seq      uint64
+		end      position
+		acked    bool
+		released bool
+	}
+)
+
+const (
+	// SyncInterval fsyncs the log periodically in the background.
+	SyncInterval SyncPolicy = iota
+	// SyncAlways fsyncs the log after every written event.
+	SyncAlways
+	// SyncNever leaves flushing to the operating system. The log is only fsynced on Close.
+	SyncNever
+
+	cursorFileName = "cursor"
+)
+
+var (
+	_ Emitter     = &DiskEmitter{}
+	_ AckProducer = &DiskEmitter{}
+)
+
+// NewDiskEmitter opens or creates the event log in config.Dir. Damaged records at the end of a
+// segment, e.g. from a crash during a write, are truncated.
+func NewDiskEmitter(config DiskEmitterConfig) (*DiskEmitter, error) {
+	if config.Dir == "" {
+		return nil, errors.New("dir cannot be empty")
+	}
+	if config.MaxSegmentBytes <= 0 {
+		config.MaxSegmentBytes = 4 * 1024 * 1024
+	}
+	if config.MaxTotalBytes <= 0 {
+		config.MaxTotalBytes = 64 * 1024 * 1024
+	}
+	if config.MaxTotalBytes < config.MaxSegmentBytes {
+		return nil, errors.New("max total bytes must not be smaller than max segment bytes")
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = time.Second
+	}
+
+	if err := os.MkdirAll(config.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+
+	e := &DiskEmitter{
+		config:  config,
+		nextSeq: 1,
+		leases:  make(map[uint64]*lease),
+	}
+
+	if err := e.recover(); err != nil {
+		return nil, err
+	}
+
+	if config.SyncPolicy == SyncInterval {
+		e.stopSync = make(chan struct{})
+		e.syncDone = make(chan struct{})
+		recovery.Go("DiskEmitter", e.syncLoop)
+	}
+
+	return e, nil
+}
+
+// recover loads the cursor, validates all segments and opens the active segment.
+func (e *DiskEmitter) recover() error {
+	segments, err := listSegments(e.config.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	for _, seg := range segments {
+		info, err := os.Stat(seg.path)
+		if err != nil {
+			return fmt.Errorf("failed to stat segment: %w", err)
+		}
+		seg.lastWrite = info.ModTime()
+
+		end, err := scanSegment(seg.path, 0, func(rec *record) bool {
+			seg.lastSeq = rec.seq
+			if rec.seq >= e.nextSeq {
+				e.nextSeq = rec.seq + 1
+			}
+			return true
+		})
+		if errors.Is(err, errCorruptRecord) {
+			slog.Warn("truncating corrupt event log segment", "segment", seg.path, "offset", end, "error", err)
+			if err := os.Truncate(seg.path, end); err != nil {
+				return fmt.Errorf("failed to truncate corrupt segment: %w", err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to read segment: %w", err)
+		}
+		seg.size = end
+	}
+	e.segments = segments
+
+	if data, err := os.ReadFile(filepath.Join(e.config.Dir, cursorFileName)); err == nil {
+		if err := json.Unmarshal(data, &e.ackPos); err != nil {
+			slog.Warn("ignoring corrupt event log cursor", "error", err)
+			e.ackPos = position{}
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read cursor: %w", err)
+	}
+
+	e.removeAckedSegments()
+	e.normalizePositions()
+	e.readPos = e.ackPos
+
+	return e.openActive()
+}
+
+func (e *DiskEmitter) openActive() error {
+	if len(e.segments) == 0 || e.segments[len(e.segments)-1].size >= e.config.MaxSegmentBytes {
+		e.segments = append(e.segments, &segment{
+			baseSeq:   e.nextSeq,
+			path:      filepath.Join(e.config.Dir, segmentName(e.nextSeq)),
+			lastWrite: time.Now(),
+		})
+	}
+
+	current := e.segments[len(e.segments)-1]
+	file, err := os.OpenFile(current.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open segment: %w", err)
+	}
+
+	e.active = file
+	e.normalizePositions()
+	return nil
+}
+
+func (e *DiskEmitter) syncLoop() {
+	defer close(e.syncDone)
+
+	ticker := time.NewTicker(e.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-e.stopSync:
+			return
+		case <-ticker.C:
+			e.mu.Lock()
+			if e.dirty && !e.closed {
+				if err := e.active.Sync(); err != nil {
+					slog.Warn("failed to sync event log", "error", err)
+				}
+				e.dirty = false
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// Push appends the event to the log. If the event cannot be written or the emitter is closed,
+// it is dropped and the drop callback is called if provided.
+func (e *DiskEmitter) Push(event *Event) {
+	e.mu.Lock()
+	defer e.unlock()
+
+	if e.closed {
+		e.drop(event)
+		return
+	}
+
+	e.enforceCaps()
+	if err := e.append(event); err != nil {
+		slog.Warn("failed to write event to log", "error", err)
+		e.drop(event)
+		return
+	}
+
+	e.enforceCaps()
+}
+
+func (e *DiskEmitter) append(event *Event) error {
+	data, err := encodeRecord(e.nextSeq, event)
+	if err != nil {
+		return err
+	}
+
+	current := e.segments[len(e.segments)-1]
+	if current.size > 0 && current.size+int64(len(data)) > e.config.MaxSegmentBytes {
+		if err := e.rotate(); err != nil {
+			return err
+		}
+		current = e.segments[len(e.segments)-1]
+	}
+
+	if _, err := e.active.Write(data); err != nil {
+		return err
+	}
+
+	current.size += int64(len(data))
+	current.lastSeq = e.nextSeq
+	current.lastWrite = time.Now()
+	e.nextSeq++
+
+	if e.config.SyncPolicy == SyncAlways {
+		return e.active.Sync()
+	}
+	e.dirty = true
+	return nil
+}
+
+func (e *DiskEmitter) rotate() error {
+	if err := e.active.Sync(); err != nil {
+		return err
+	}
+	if err := e.active.Close(); err != nil {
+		return err
+	}
+	e.dirty = false
+
+	e.segments = append(e.segments, &segment{
+		baseSeq:   e.nextSeq,
+		path:      filepath.Join(e.config.Dir, segmentName(e.nextSeq)),
+		lastWrite: time.Now(),
+	})
+	return e.openActive()
+}
+
+// enforceCaps drops the oldest segments while the log exceeds its size cap and all segments
+// whose newest event exceeds the age cap.
+func (e *DiskEmitter) enforceCaps() {
+	if e.config.MaxAge > 0 {
+		current := e.segments[len(e.segments)-1]
+		if current.size > 0 && time.Since(current.lastWrite) > e.config.MaxAge {
+			if err := e.rotate(); err != nil {
+				slog.Warn("failed to rotate expired event log segment", "error", err)
+			}
+		}
+	}
+
+	var total int64
+	for _, seg := range e.segments {
+		total += seg.size
+	}
+
+	evicted := false
+	for len(e.segments) > 1 {
+		oldest := e.segments[0]
+		expired := e.config.MaxAge > 0 && time.Since(oldest.lastWrite) > e.config.MaxAge
+		if total <= e.config.MaxTotalBytes && !expired {
+			break
+		}
+
+		total -= oldest.size
+		e.evict(oldest)
+		evicted = true
+	}
+
+	if evicted {
+		e.advanceAck()
+	}
+}
+
+// evict removes the oldest segment and reports its unacknowledged events as dropped.
+func (e *DiskEmitter) evict(seg *segment) {
+	offset := int64(0)
+	if e.ackPos.BaseSeq == seg.baseSeq {
+		offset = e.ackPos.Offset
+	}
+	_, _ = scanSegment(seg.path, offset, func(rec *record) bool {
+		if l, ok := e.leases[rec.seq]; !ok || !l.acked {
+			e.drop(rec.event)
+		}
+		return true
+	})
+
+	// Leased events of the segment are gone and must not hold back the ack position.
+	for _, l := range e.inflight {
+		if l.seq <= seg.lastSeq {
+			l.acked = true
+		}
+	}
+	redeliver := e.redeliver[:0]
+	for _, event := range e.redeliver {
+		if event.seq > seg.lastSeq {
+			redeliver = append(redeliver, event)
+		}
+	}
+	e.redeliver = redeliver
+
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		slog.Warn("failed to remove event log segment", "segment", seg.path, "error", err)
+	}
+	e.segments = e.segments[1:]
+	e.normalizePositions()
+}
+
+// PollEvents returns the next batch of unacknowledged events. The events are leased until they
+// are acknowledged with Ack or released with Nack. Released events are returned first.
+func (e *DiskEmitter) PollEvents() []*Event {
+	e.mu.Lock()
+	defer e.unlock()
+
+	if e.closed {
+		return nil
+	}
+
+	e.enforceCaps()
+
+	var events []*Event
+	for len(e.redeliver) > 0 && len(events) < e.config.BatchSize {
+		event := e.redeliver[0]
+		e.redeliver = e.redeliver[1:]
+
+		if l, ok := e.leases[event.seq]; ok && !l.acked {
+			l.released = false
+			events = append(events, event)
+		}
+	}
+
+	for i := e.segmentIndex(e.readPos.BaseSeq); i >= 0 && i < len(e.segments) && len(events) < e.config.BatchSize; i++ {
+		seg := e.segments[i]
+		offset := int64(0)
+		if seg.baseSeq == e.readPos.BaseSeq {
+			offset = e.readPos.Offset
+		}
+
+		end, err := scanSegment(seg.path, offset, func(rec *record) bool {
+			l := &lease{seq: rec.seq, end: position{BaseSeq: seg.baseSeq, Offset: rec.offset + rec.size}}
+			e.readPos = l.end
+			e.inflight = append(e.inflight, l)
+			e.leases[rec.seq] = l
+
+			rec.event.seq = rec.seq
+			events = append(events, rec.event)
+			return len(events) < e.config.BatchSize
+		})
+		if err != nil {
+			slog.Warn("failed to read event log segment", "segment", seg.path, "error", err)
+			break
+		}
+
+		if end >= seg.size && i+1 < len(e.segments) {
+			e.readPos = position{BaseSeq: e.segments[i+1].baseSeq}
+		}
+	}
+
+	return events
+}
+
+// Ack acknowledges the given leased events. Acknowledged events are removed from the log once
+// all events before them are acknowledged as well.
+func (e *DiskEmitter) Ack(events []*Event) error {
+	e.mu.Lock()
+	defer e.unlock()
+
+	for _, event := range events {
+		if l, ok := e.leases[event.seq]; ok {
+			l.acked = true
+		}
+	}
+
+	if !e.advanceAck() || e.closed {
+		return nil
+	}
+
+	return e.persistCursor()
+}
+
+// Nack releases the given leased events so that they are returned by the next PollEvents call.
+// Other leased events stay leased.
+func (e *DiskEmitter) Nack(events []*Event) {
+	e.mu.Lock()
+	defer e.unlock()
+
+	for _, event := range events {
+		if l, ok := e.leases[event.seq]; ok && !l.acked && !l.released {
+			l.released = true
+			e.redeliver = append(e.redeliver, event)
+		}
+	}
+
+	sort.Slice(e.redeliver, func(i, j int) bool { return e.redeliver[i].seq < e.redeliver[j].seq })
+}
+
+// advanceAck moves the ack position over all acknowledged leases at the front of the log and
+// removes segments that are fully acknowledged. It reports whether the position changed.
+func (e *DiskEmitter) advanceAck() bool {
+	advanced := false
+	for len(e.inflight) > 0 && e.inflight[0].acked {
+		e.ackPos = e.inflight[0].end
+		delete(e.leases, e.inflight[0].seq)
+		e.inflight = e.inflight[1:]
+		advanced = true
+	}
+
+	if advanced {
+		e.removeAckedSegments()
+		e.normalizePositions()
+	}
+	return advanced
+}
+
+func (e *DiskEmitter) removeAckedSegments() {
+	for len(e.segments) > 1 {
+		oldest := e.segments[0]
+		fullyAcked := oldest.baseSeq < e.ackPos.BaseSeq || (oldest.baseSeq == e.ackPos.BaseSeq && e.ackPos.Offset >= oldest.size)
+		if !fullyAcked {
+			return
+		}
+
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("failed to remove event log segment", "segment", oldest.path, "error", err)
+		}
+		e.segments = e.segments[1:]
+	}
+}
+
+// normalizePositions moves positions that point into removed or truncated segments to the next
+// valid location.
+func (e *DiskEmitter) normalizePositions() {
+	if len(e.segments) == 0 {
+		return
+	}
+
+	for _, pos := range []*position{&e.ackPos, &e.readPos} {
+		i := e.segmentIndex(pos.BaseSeq)
+		if i < 0 {
+			first := e.segments[0]
+			if pos.BaseSeq < first.baseSeq {
+				*pos = position{BaseSeq: first.baseSeq}
+			}
+			continue
+		}
+
+		seg := e.segments[i]
+		if pos.Offset > seg.size {
+			pos.Offset = seg.size
+		}
+		if pos.Offset == seg.size && i+1 < len(e.segments) {
+			*pos = position{BaseSeq: e.segments[i+1].baseSeq}
+		}
+	}
+}
+
+func (e *DiskEmitter) segmentIndex(baseSeq uint64) int {
+	for i, seg := range e.segments {
+		if seg.baseSeq == baseSeq {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *DiskEmitter) persistCursor() error {
+	data, err := json.Marshal(e.ackPos)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(e.config.Dir, cursorFileName)
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cursor: %w", err)
+	}
+	if e.config.SyncPolicy == SyncAlways {
+		if err := syncFile(tmpFile); err != nil {
+			return fmt.Errorf("failed to sync cursor: %w", err)
+		}
+	}
+
+	return os.Rename(tmpFile, path)
+}
+
+func (e *DiskEmitter) drop(event *Event) {
+	countDropped("disk", event)
+	e.dropped = append(e.dropped, event)
+}
+
+// unlock releases the lock and passes the events dropped while it was held to the drop
+// callback.
+func (e *DiskEmitter) unlock() {
+	dropped := e.dropped
+	e.dropped = nil
+	e.mu.Unlock()
+
+	if e.config.DropCallback != nil {
+		for _, event := range dropped {
+			e.config.DropCallback(event)
+		}
+	}
+}
+
+// Close fsyncs and closes the log. Unacknowledged events are delivered again after the log is
+// reopened.
+func (e *DiskEmitter) Close(ctx context.Context) error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+
+	errSync := e.active.Sync()
+	errClose := e.active.Close()
+	e.mu.Unlock()
+
+	if e.stopSync != nil {
+		close(e.stopSync)
+		select {
+		case <-e.syncDone:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return errors.Join(errSync, errClose)
+}
+
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
@@ -0,0 +1,263 @@
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pushEvents(emitter event.Emitter, n int) {
+	for i := 0; i < n; i++ {
+		emitter.Push(&event.Event{Id: fmt.Sprintf("event-%d", i), Message: fmt.Sprintf("message %d", i)})
+	}
+}
+
+func messages(events []*event.Event) []string {
+	result := make([]string, len(events))
+	for i, e := range events {
+		result[i] = e.Message
+	}
+	return result
+}
+
+func TestDiskEmitter(t *testing.T) {
+	t.Run("persists unacknowledged events", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir, SyncPolicy: event.SyncAlways})
+		require.NoError(t, err)
+
+		pushEvents(emitter, 3)
+		events := emitter.PollEvents()
+		require.NoError(t, emitter.Ack(events[:1]))
+		require.NoError(t, emitter.Close(context.Background()))
+
+		// when
+		reopened, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir})
+		require.NoError(t, err)
+		defer reopened.Close(context.Background())
+
+		// then
+		assert.Equal(t, []string{"message 1", "message 2"}, messages(reopened.PollEvents()))
+	})
+
+	t.Run("nack redelivers events", func(t *testing.T) {
+		// given
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir(), BatchSize: 2})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+		pushEvents(emitter, 3)
+
+		first := emitter.PollEvents()
+		require.Equal(t, []string{"message 0", "message 1"}, messages(first))
+		require.NoError(t, emitter.Ack(first[1:]))
+
+		// when
+		emitter.Nack(first[:1])
+
+		// then
+		assert.Equal(t, []string{"message 0", "message 2"}, messages(emitter.PollEvents()))
+		assert.Empty(t, emitter.PollEvents())
+	})
+
+	t.Run("nack keeps other events leased", func(t *testing.T) {
+		// given
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir(), BatchSize: 2})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+		pushEvents(emitter, 4)
+
+		first := emitter.PollEvents()
+		second := emitter.PollEvents()
+		require.Equal(t, []string{"message 2", "message 3"}, messages(second))
+
+		// when
+		emitter.Nack(first[1:])
+
+		// then
+		assert.Equal(t, []string{"message 1"}, messages(emitter.PollEvents()))
+		assert.Empty(t, emitter.PollEvents())
+	})
+
+	t.Run("leases do not depend on event ids", func(t *testing.T) {
+		// given
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+		emitter.Push(&event.Event{Id: "duplicate", Message: "message 0"})
+		emitter.Push(&event.Event{Id: "duplicate", Message: "message 1"})
+
+		events := emitter.PollEvents()
+		require.Len(t, events, 2)
+		events[0].Id = "overwritten"
+
+		// when
+		require.NoError(t, emitter.Ack(events[:1]))
+		emitter.Nack(events[1:])
+
+		// then
+		assert.Equal(t, []string{"message 1"}, messages(emitter.PollEvents()))
+	})
+
+	t.Run("acked events are not polled again", func(t *testing.T) {
+		// given
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+		pushEvents(emitter, 2)
+
+		// when
+		require.NoError(t, emitter.Ack(emitter.PollEvents()))
+		emitter.Push(&event.Event{Id: "event-2", Message: "message 2"})
+
+		// then
+		assert.Equal(t, []string{"message 2"}, messages(emitter.PollEvents()))
+	})
+
+	t.Run("truncates corrupt records", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir})
+		require.NoError(t, err)
+		pushEvents(emitter, 2)
+		require.NoError(t, emitter.Close(context.Background()))
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+		require.NoError(t, err)
+		require.Len(t, segments, 1)
+
+		file, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0644)
+		require.NoError(t, err)
+		_, err = file.Write([]byte{0, 0, 0, 42, 1, 2, 3})
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		// when
+		reopened, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir})
+		require.NoError(t, err)
+		defer reopened.Close(context.Background())
+		reopened.Push(&event.Event{Id: "event-2", Message: "message 2"})
+
+		// then
+		assert.Equal(t, []string{"message 0", "message 1", "message 2"}, messages(reopened.PollEvents()))
+	})
+
+	t.Run("drops oldest segments when size cap is exceeded", func(t *testing.T) {
+		// given
+		var dropped atomic.Int32
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{
+			Dir:             t.TempDir(),
+			MaxSegmentBytes: 512,
+			MaxTotalBytes:   1024,
+			DropCallback:    func(*event.Event) { dropped.Add(1) },
+		})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+
+		// when
+		pushEvents(emitter, 50)
+
+		// then
+		events := emitter.PollEvents()
+		require.NotEmpty(t, events)
+		assert.Less(t, len(events), 50)
+		assert.Equal(t, 50, len(events)+int(dropped.Load()))
+		assert.Equal(t, "message 49", events[len(events)-1].Message)
+	})
+
+	t.Run("drop callback may use emitter", func(t *testing.T) {
+		// given
+		var emitter *event.DiskEmitter
+		var dropped atomic.Int32
+		var err error
+		emitter, err = event.NewDiskEmitter(event.DiskEmitterConfig{
+			Dir:             t.TempDir(),
+			MaxSegmentBytes: 512,
+			MaxTotalBytes:   1024,
+			DropCallback: func(*event.Event) {
+				if dropped.Add(1) == 1 {
+					emitter.Push(&event.Event{Id: "dropped", Message: "events dropped"})
+				}
+			},
+		})
+		require.NoError(t, err)
+		defer emitter.Close(context.Background())
+
+		// when
+		pushEvents(emitter, 50)
+
+		// then
+		assert.Positive(t, dropped.Load())
+	})
+
+	t.Run("drops expired segments", func(t *testing.T) {
+		// given
+		dir := t.TempDir()
+		emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir})
+		require.NoError(t, err)
+		pushEvents(emitter, 2)
+		require.NoError(t, emitter.Close(context.Background()))
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.log"))
+		require.NoError(t, err)
+		for _, segment := range segments {
+			expired := time.Now().Add(-time.Hour)
+			require.NoError(t, os.Chtimes(segment, expired, expired))
+		}
+
+		// when
+		reopened, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: dir, MaxAge: time.Minute})
+		require.NoError(t, err)
+		defer reopened.Close(context.Background())
+		reopened.Push(&event.Event{Id: "event-2", Message: "message 2"})
+
+		// then
+		assert.Equal(t, []string{"message 2"}, messages(reopened.PollEvents()))
+	})
+}
+
+func TestService_FlushAcknowledgesDeliveredEvents(t *testing.T) {
+	// given
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	service, err := event.NewService(ctx, server.URL,
+		event.WithFlushInterval(time.Hour),
+		event.WithRetryPolicy(event.RetryPolicy{MaxAttempts: 1}),
+	)
+	require.NoError(t, err)
+	defer service.Close(ctx)
+
+	emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	pushEvents(emitter, 2)
+
+	// when
+	require.Error(t, service.Flush(ctx))
+	require.NoError(t, service.Flush(ctx))
+
+	// then
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Empty(t, emitter.PollEvents())
+}
@@ -0,0 +1,172 @@
+package event
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// segment is a single append-only file of the event log. Its name is the sequence number of
+	// the first record it may contain.
+	segment struct {
+		baseSeq uint64
+		path    string
+		size    int64
+		lastSeq uint64
+		// lastWrite is the time of the newest record and is used for the age cap.
+		lastWrite time.Time
+	}
+
+	// record is a decoded log entry together with its position in the segment.
+	record struct {
+		seq    uint64
+		offset int64
+		size   int64
+		event  *Event
+	}
+)
+
+const (
+	segmentExtension = ".log"
+	// recordHeaderSize is the size of the header preceding every payload:
+	// payload length (uint32), crc32c of seq and payload (uint32) and seq (uint64).
+	recordHeaderSize = 16
+	// maxRecordSize guards against allocating huge buffers for corrupted length fields.
+	maxRecordSize = 16 * 1024 * 1024
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	errCorruptRecord = errors.New("corrupt record")
+)
+
+func segmentName(baseSeq uint64) string {
+	return fmt.Sprintf("%020d%s", baseSeq, segmentExtension)
+}
+
+// listSegments returns the segments in dir ordered by their base sequence number.
+func listSegments(dir string) ([]*segment, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []*segment
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExtension) {
+			continue
+		}
+
+		baseSeq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExtension), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, &segment{baseSeq: baseSeq, path: filepath.Join(dir, name)})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].baseSeq < segments[j].baseSeq
+	})
+	return segments, nil
+}
+
+func encodeRecord(seq uint64, event *Event) ([]byte, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("event exceeds maximum record size of %d bytes", maxRecordSize)
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint64(buf[8:16], seq)
+	copy(buf[recordHeaderSize:], payload)
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(buf[8:], crcTable))
+
+	return buf, nil
+}
+
+// readRecord decodes the record at the current position of r. io.EOF is returned at the clean
+// end of a segment and errCorruptRecord for torn or damaged records.
+func readRecord(r *bufio.Reader, offset int64) (*record, error) {
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("%w: truncated header", errCorruptRecord)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("%w: invalid length %d", errCorruptRecord, length)
+	}
+
+	data := make([]byte, 8+int(length))
+	copy(data, header[8:16])
+	if _, err := io.ReadFull(r, data[8:]); err != nil {
+		return nil, fmt.Errorf("%w: truncated payload", errCorruptRecord)
+	}
+
+	if crc32.Checksum(data, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorruptRecord)
+	}
+
+	var event Event
+	if err := json.Unmarshal(data[8:], &event); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptRecord, err)
+	}
+
+	return &record{
+		seq:    binary.BigEndian.Uint64(header[8:16]),
+		offset: offset,
+		size:   int64(recordHeaderSize + length),
+		event:  &event,
+	}, nil
+}
+
+// scanSegment reads all valid records of the segment starting at offset and calls fn for each
+// of them. Scanning stops early if fn returns false. The returned offset points behind the last
+// valid record, an errCorruptRecord is returned if the segment is damaged behind it.
+func scanSegment(path string, offset int64, fn func(*record) bool) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		rec, err := readRecord(reader, offset)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, nil
+			}
+			return offset, err
+		}
+
+		offset += rec.size
+		if !fn(rec) {
+			return offset, nil
+		}
+	}
+}
@@ -16,6 +16,14 @@ type (
 		Close(ctx context.Context) error
 	}
 
+	// AckProducer is a Producer that keeps polled events until the Service reports whether they
+	// were delivered. Acknowledged events are released, rejected events are polled again.
+	AckProducer interface {
+		Producer
+		Ack(events []*Event) error
+		Nack(events []*Event)
+	}
+
 	NoopEmitter struct{}
 )
 
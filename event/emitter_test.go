@@ -9,6 +9,7 @@ import (
 	"github.com/dtomschitz/headless-go-client/event"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBufferedEmitter_PushAndPoll(t *testing.T) {
@@ -97,3 +98,170 @@ func TestBufferedEmitter_Close(t *testing.T) {
 		t.Fatal("push after close blocked")
 	}
 }
+
+func TestBufferedEmitter_EvictionPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		eviction event.EvictionPolicy
+		push     []*event.Event
+		want     []string
+		dropped  []string
+	}{
+		{
+			name:     "drop newest",
+			eviction: event.DropNewest,
+			push:     []*event.Event{{Message: "1"}, {Message: "2"}, {Message: "3"}},
+			want:     []string{"1", "2"},
+			dropped:  []string{"3"},
+		},
+		{
+			name:     "drop oldest",
+			eviction: event.DropOldest,
+			push:     []*event.Event{{Message: "1"}, {Message: "2"}, {Message: "3"}},
+			want:     []string{"2", "3"},
+			dropped:  []string{"1"},
+		},
+		{
+			name:     "drop lowest priority",
+			eviction: event.DropLowestPriority,
+			push:     []*event.Event{{Message: "error", IsError: true}, {Message: "info"}, {Message: "lifecycle", Type: "update_applied"}},
+			want:     []string{"error", "lifecycle"},
+			dropped:  []string{"info"},
+		},
+		{
+			name:     "drop event below registered priority",
+			eviction: event.DropLowestPriority,
+			push:     []*event.Event{{Message: "registered", Type: "registered_lifecycle"}, {Message: "info"}, {Message: "error", IsError: true}},
+			want:     []string{"registered", "error"},
+			dropped:  []string{"info"},
+		},
+		{
+			name:     "drop pushed event with lowest priority",
+			eviction: event.DropLowestPriority,
+			push:     []*event.Event{{Message: "error", IsError: true}, {Message: "lifecycle", Type: "update_applied"}, {Message: "info"}},
+			want:     []string{"error", "lifecycle"},
+			dropped:  []string{"info"},
+		},
+	}
+
+	event.RegisterPriority("registered_lifecycle", event.PriorityLifecycle)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			var dropped []string
+			emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{
+				BufferSize:   2,
+				Eviction:     tt.eviction,
+				Priorities:   map[event.EventType]event.Priority{"update_applied": event.PriorityLifecycle},
+				DropCallback: func(e *event.Event) { dropped = append(dropped, e.Message) },
+			})
+			defer emitter.Close(context.Background())
+
+			// when
+			for _, e := range tt.push {
+				emitter.Push(e)
+			}
+
+			// then
+			var got []string
+			for _, e := range emitter.PollEvents() {
+				got = append(got, e.Message)
+			}
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.dropped, dropped)
+		})
+	}
+}
+
+func TestBufferedEmitter_BlockWithTimeout(t *testing.T) {
+	// given
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{
+		BufferSize:   1,
+		Eviction:     event.BlockWithTimeout,
+		BlockTimeout: 50 * time.Millisecond,
+	})
+	defer emitter.Close(context.Background())
+	emitter.Push(&event.Event{Message: "1"})
+
+	// when
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		emitter.Push(&event.Event{Message: "2"})
+	}()
+	first := emitter.PollEvents()
+	<-pushed
+
+	start := time.Now()
+	emitter.Push(&event.Event{Message: "3"})
+
+	// then
+	assert.Len(t, first, 1)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	events := emitter.PollEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, "2", events[0].Message)
+	assert.Equal(t, map[event.EventType]uint64{"": 1}, emitter.(*event.BufferedEmitter).DroppedCounts())
+}
+
+func TestBufferedEmitter_ReportsDroppedEvents(t *testing.T) {
+	// given
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{
+		BufferSize:     2,
+		ReportInterval: 20 * time.Millisecond,
+	})
+	defer emitter.Close(context.Background())
+
+	emitter.Push(&event.Event{Type: "heartbeat"})
+	for i := 0; i < 3; i++ {
+		emitter.Push(&event.Event{Type: "flag_evaluated"})
+	}
+	emitter.PollEvents()
+
+	// when
+	var events []*event.Event
+	require.Eventually(t, func() bool {
+		events = append(events, emitter.PollEvents()...)
+		return len(events) > 0
+	}, time.Second, 5*time.Millisecond)
+
+	// then
+	require.Len(t, events, 1)
+	assert.Equal(t, event.DroppedEventsEvent, events[0].Type)
+	assert.Equal(t, uint64(2), events[0].Data["flag_evaluated"])
+	assert.Equal(t, map[event.EventType]uint64{"flag_evaluated": 2}, emitter.(*event.BufferedEmitter).DroppedCounts())
+}
+
+func TestBufferedEmitter_DropCallbackMayPush(t *testing.T) {
+	// given
+	var emitter event.Emitter
+	emitter = event.NewBufferedEmitter(event.BufferedEmitterConfig{
+		BufferSize: 1,
+		Eviction:   event.DropOldest,
+		DropCallback: func(dropped *event.Event) {
+			if dropped.Message != "dropped" {
+				emitter.Push(&event.Event{Message: "dropped"})
+			}
+		},
+	})
+	defer emitter.Close(context.Background())
+
+	// when
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		emitter.Push(&event.Event{Message: "1"})
+		emitter.Push(&event.Event{Message: "2"})
+	}()
+
+	// then
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push from drop callback blocked")
+	}
+	events := emitter.PollEvents()
+	require.Len(t, events, 1)
+	assert.Equal(t, "dropped", events[0].Message)
+}
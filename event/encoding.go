@@ -0,0 +1,131 @@
+package event
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type (
+	// Encoding is the wire format of an event upload.
+	Encoding string
+
+	// Compression is the Content-Encoding applied to an event upload.
+	Compression string
+)
+
+const (
+	// EncodingJSON sends events as a single JSON array.
+	EncodingJSON Encoding = "application/json"
+	// EncodingNDJSON sends one JSON encoded event per line.
+	EncodingNDJSON Encoding = "application/x-ndjson"
+
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+func defaultRequestBuilder(endpoint string, encoding Encoding, compression Compression) RequestBuilder {
+	return func(ctx context.Context, events []*Event) (*http.Request, error) {
+		payload, err := encodeEvents(events, encoding)
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = compress(payload, compression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress events: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", string(encoding))
+		if compression != CompressionNone {
+			req.Header.Set("Content-Encoding", string(compression))
+		}
+		return req, nil
+	}
+}
+
+func encodeEvents(events []*Event, encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON:
+		return json.Marshal(events)
+	case EncodingNDJSON:
+		var buf bytes.Buffer
+		encoder := json.NewEncoder(&buf)
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return nil, err
+			}
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+func compress(payload []byte, compression Compression) ([]byte, error) {
+	switch compression {
+	case CompressionNone:
+		return payload, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, err := zstd.NewWriter(nil)
+		if err != nil {
+			return nil, err
+		}
+		defer encoder.Close()
+		return encoder.EncodeAll(payload, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+// chunkEvents splits the batch into chunks of at most maxEvents events and roughly maxBytes
+// uncompressed bytes. A non-positive limit disables it. An event larger than maxBytes is sent
+// in a chunk of its own.
+func chunkEvents(events []*Event, maxEvents, maxBytes int) [][]*Event {
+	var chunks [][]*Event
+
+	start, size := 0, 0
+	for i, event := range events {
+		eventSize := 0
+		if maxBytes > 0 {
+			data, err := json.Marshal(event)
+			if err == nil {
+				// one byte for the separator between two events
+				eventSize = len(data) + 1
+			}
+		}
+
+		count := i - start
+		full := (maxEvents > 0 && count >= maxEvents) || (maxBytes > 0 && count > 0 && size+eventSize > maxBytes)
+		if full {
+			chunks = append(chunks, events[start:i])
+			start, size = i, 0
+		}
+		size += eventSize
+	}
+
+	if start < len(events) {
+		chunks = append(chunks, events[start:])
+	}
+	return chunks
+}
@@ -2,6 +2,8 @@ package event
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
 	"time"
 
 	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
@@ -21,6 +23,12 @@ type (
 		Message       string                 `json:"message"`
 		Data          map[string]interface{} `json:"data,omitempty"`
 		IsError       bool                   `json:"isError"`
+		// SchemaVersion is the version of the registered payload definition of Type, if any.
+		SchemaVersion int `json:"schemaVersion,omitempty"`
+
+		// seq is the sequence number of the event in a DiskEmitter log. It identifies leased
+		// events independently of their id.
+		seq uint64
 	}
 
 	EventOption func(*Event)
@@ -40,6 +48,25 @@ func WithData(data map[string]interface{}) EventOption {
 	}
 }
 
+// WithPayload creates an EventOption that sets the data of the event to the JSON representation
+// of the given typed payload.
+func WithPayload(payload any) EventOption {
+	return func(e *Event) {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			e.Data = map[string]interface{}{InvalidPayloadDataKey: err.Error()}
+			return
+		}
+
+		var data map[string]interface{}
+		if err := json.Unmarshal(raw, &data); err != nil {
+			e.Data = map[string]interface{}{InvalidPayloadDataKey: err.Error()}
+			return
+		}
+		e.Data = data
+	}
+}
+
 // WithDataField creates an EventOption that sets a specific field in the event data.
 func WithDataField(key string, value interface{}) EventOption {
 	return func(e *Event) {
@@ -63,12 +90,16 @@ func NewEventFromError(ctx context.Context, eventType EventType, err error, opts
 	return NewEvent(ctx, eventType, append([]EventOption{WithError(err)}, opts...)...)
 }
 
-// NewEvent creates a new Event with the given context and event type.
+// NewEvent creates a new Event with the given context and event type. If a payload is
+// registered for the event type, the data is validated against its schema. Valid data is kept
+// as given and the event carries the schema version, invalid data is replaced by a description
+// of the validation error.
 func NewEvent(ctx context.Context, eventType EventType, opts ...EventOption) *Event {
 	event := &Event{
 		Id:            uuid.New().String(),
 		DeviceId:      commonCtx.GetStringValue(ctx, commonCtx.DeviceIdKey),
 		ClientVersion: commonCtx.GetStringValue(ctx, commonCtx.ClientVersionKey),
+		Source:        commonCtx.GetStringValue(ctx, commonCtx.ServiceKey),
 		Type:          eventType,
 		Timestamp:     time.Now(),
 	}
@@ -77,5 +108,14 @@ func NewEvent(ctx context.Context, eventType EventType, opts ...EventOption) *Ev
 		opt(event)
 	}
 
+	if definition, ok := DefaultSchemaRegistry.Definition(eventType); ok {
+		if _, err := DefaultSchemaRegistry.Normalize(eventType, event.Data); err != nil {
+			slog.Warn("discarding invalid event payload", "type", eventType, "error", err)
+			event.Data = map[string]interface{}{InvalidPayloadDataKey: err.Error()}
+		} else {
+			event.SchemaVersion = definition.Version
+		}
+	}
+
 	return event
 }
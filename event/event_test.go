@@ -0,0 +1,27 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEvent_SetsContextValues(t *testing.T) {
+	// given
+	ctx := context.WithValue(context.Background(), commonCtx.ServiceKey, "ConfigService")
+	ctx = context.WithValue(ctx, commonCtx.DeviceIdKey, "device-1")
+	ctx = context.WithValue(ctx, commonCtx.ClientVersionKey, "1.2.3")
+
+	// when
+	e := event.NewEvent(ctx, "config_refreshed")
+
+	// then
+	assert.Equal(t, "ConfigService", e.Source)
+	assert.Equal(t, "device-1", e.DeviceId)
+	assert.Equal(t, "1.2.3", e.ClientVersion)
+	assert.True(t, event.Filter{Sources: []string{"ConfigService"}}.Matches(e))
+}
@@ -0,0 +1,106 @@
+package event
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/metrics"
+)
+
+type (
+	// MetricsProducer turns the state of a metrics registry into a MetricsSnapshotEvent at most
+	// once per interval, so that metrics are delivered alongside the other events.
+	MetricsProducer struct {
+		ctx      context.Context
+		registry *metrics.Registry
+		interval time.Duration
+
+		mu   sync.Mutex
+		last time.Time
+	}
+
+	// MetricsSnapshotPayload is the payload of MetricsSnapshotEvent.
+	MetricsSnapshotPayload struct {
+		Metrics []MetricSample `json:"metrics"`
+	}
+
+	// MetricSample is a single series of a metrics snapshot. Value is set for counters and
+	// gauges, Count, Sum and Buckets for histograms.
+	MetricSample struct {
+		Name    string            `json:"name"`
+		Kind    metrics.Kind      `json:"kind"`
+		Labels  map[string]string `json:"labels,omitempty"`
+		Value   *float64          `json:"value,omitempty"`
+		Count   *uint64           `json:"count,omitempty"`
+		Sum     *float64          `json:"sum,omitempty"`
+		Buckets []MetricBucket    `json:"buckets,omitempty"`
+	}
+
+	// MetricBucket holds the cumulative number of observations less than or equal to UpperBound.
+	MetricBucket struct {
+		UpperBound float64 `json:"le"`
+		Count      uint64  `json:"count"`
+	}
+)
+
+const MetricsSnapshotEvent EventType = "metrics_snapshot"
+
+func init() {
+	MustRegisterPayload(MetricsSnapshotEvent, 1, MetricsSnapshotPayload{})
+}
+
+// NewMetricsProducer creates a MetricsProducer for the registry. The snapshot events are created
+// with ctx, e.g. the context of the Service. A nil registry selects metrics.DefaultRegistry.
+func NewMetricsProducer(ctx context.Context, registry *metrics.Registry, interval time.Duration) *MetricsProducer {
+	if registry == nil {
+		registry = metrics.DefaultRegistry
+	}
+	return &MetricsProducer{ctx: ctx, registry: registry, interval: interval}
+}
+
+// PollEvents returns a snapshot of the registry if the interval elapsed since the last one.
+func (p *MetricsProducer) PollEvents() []*Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(p.last) < p.interval {
+		return nil
+	}
+	p.last = now
+
+	samples := p.registry.Snapshot()
+	if len(samples) == 0 {
+		return nil
+	}
+
+	payload := MetricsSnapshotPayload{Metrics: make([]MetricSample, 0, len(samples))}
+	for _, s := range samples {
+		sample := MetricSample{Name: s.Name, Kind: s.Kind, Labels: s.Labels}
+		if h := s.Histogram; h != nil {
+			sample.Count, sample.Sum = &h.Count, &h.Sum
+			for i, bound := range h.UpperBounds {
+				sample.Buckets = append(sample.Buckets, MetricBucket{UpperBound: bound, Count: h.Counts[i]})
+			}
+		} else {
+			value := s.Value
+			sample.Value = &value
+		}
+		payload.Metrics = append(payload.Metrics, sample)
+	}
+
+	return []*Event{NewEvent(p.ctx, MetricsSnapshotEvent, WithPayload(payload))}
+}
+
+func (p *MetricsProducer) Close(ctx context.Context) error {
+	return nil
+}
+
+// countDropped records events dropped at the given stage of the pipeline.
+func countDropped(stage string, events ...*Event) {
+	for _, event := range events {
+		metrics.DefaultRegistry.Counter("events_dropped_total", "Number of events dropped before delivery.",
+			metrics.Labels{"stage": stage, "type": string(event.Type)}).Inc()
+	}
+}
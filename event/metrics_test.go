@@ -0,0 +1,61 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsProducer_PollsSnapshotsPerInterval(t *testing.T) {
+	// given
+	registry := metrics.NewRegistry()
+	registry.Counter("refresh_failures_total", "", metrics.Labels{"source": "remote"}).Add(2)
+	registry.Histogram("latency_seconds", "", []float64{1}, nil).Observe(0.5)
+	ctx := context.WithValue(context.Background(), commonCtx.DeviceIdKey, "device-1")
+	producer := event.NewMetricsProducer(ctx, registry, time.Hour)
+
+	// when
+	events := producer.PollEvents()
+
+	// then
+	require.Len(t, events, 1)
+	assert.Equal(t, event.MetricsSnapshotEvent, events[0].Type)
+	assert.Equal(t, 1, events[0].SchemaVersion)
+	assert.Equal(t, "device-1", events[0].DeviceId)
+	assert.NotContains(t, events[0].Data, event.InvalidPayloadDataKey)
+
+	samples := events[0].Data["metrics"].([]interface{})
+	require.Len(t, samples, 2)
+	assert.Equal(t, map[string]interface{}{
+		"name": "latency_seconds", "kind": "histogram", "count": float64(1), "sum": 0.5,
+		"buckets": []interface{}{map[string]interface{}{"le": float64(1), "count": float64(1)}},
+	}, samples[0])
+	assert.Equal(t, map[string]interface{}{
+		"name": "refresh_failures_total", "kind": "counter", "value": float64(2),
+		"labels": map[string]interface{}{"source": "remote"},
+	}, samples[1])
+
+	assert.Empty(t, producer.PollEvents(), "expected no snapshot before the interval elapsed")
+}
+
+func TestBufferedEmitter_CountsDroppedEvents(t *testing.T) {
+	// given
+	counter := metrics.DefaultRegistry.Counter("events_dropped_total", "", metrics.Labels{"stage": "buffer", "type": "metrics_test"})
+	before := counter.Value()
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 1})
+	defer emitter.Close(context.Background())
+
+	// when
+	emitter.Push(&event.Event{Type: "metrics_test"})
+	emitter.Push(&event.Event{Type: "metrics_test"})
+
+	// then
+	assert.Equal(t, before+1, counter.Value())
+}
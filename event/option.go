@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
 	"github.com/dtomschitz/headless-go-client/logger"
+	"github.com/dtomschitz/headless-go-client/metrics"
 )
 
 type ServiceOption func(context.Context, *Service) (string, error)
@@ -32,6 +35,103 @@ func WithRequestBuilder(builder RequestBuilder) ServiceOption {
 	}
 }
 
+// WithBatchLimits limits the number of events and the uncompressed size in bytes of a single
+// upload. Flushes exceeding a limit are split into several requests. Zero disables a limit.
+func WithBatchLimits(maxEvents, maxBytes int) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if maxEvents < 0 || maxBytes < 0 {
+			return "WithBatchLimits", fmt.Errorf("batch limits must not be negative")
+		}
+
+		s.maxBatchEvents = maxEvents
+		s.maxBatchBytes = maxBytes
+		return "WithBatchLimits", nil
+	}
+}
+
+// WithEncoding sets the wire format used by the default request builder.
+func WithEncoding(encoding Encoding) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if encoding != EncodingJSON && encoding != EncodingNDJSON {
+			return "WithEncoding", fmt.Errorf("unsupported encoding %q", encoding)
+		}
+
+		s.encoding = encoding
+		return "WithEncoding", nil
+	}
+}
+
+// WithCompression sets the Content-Encoding used by the default request builder.
+func WithCompression(compression Compression) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		switch compression {
+		case CompressionNone, CompressionGzip, CompressionZstd:
+		default:
+			return "WithCompression", fmt.Errorf("unsupported compression %q", compression)
+		}
+
+		s.compression = compression
+		return "WithCompression", nil
+	}
+}
+
+// WithRetryPolicy sets how failed flushes are retried. MaxAttempts must be at least 1.
+func WithRetryPolicy(policy RetryPolicy) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if policy.MaxAttempts < 1 {
+			return "WithRetryPolicy", fmt.Errorf("max attempts must be at least 1")
+		}
+		if policy.BaseDelay < 0 || policy.MaxDelay < policy.BaseDelay {
+			return "WithRetryPolicy", fmt.Errorf("delays must be positive and max delay must not be smaller than base delay")
+		}
+
+		s.retryPolicy = policy
+		return "WithRetryPolicy", nil
+	}
+}
+
+// WithMaxPendingEvents limits how many undelivered events are kept for the next flush. Zero
+// keeps no events.
+func WithMaxPendingEvents(maxPending int) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if maxPending < 0 {
+			return "WithMaxPendingEvents", fmt.Errorf("max pending events must not be negative")
+		}
+
+		s.maxPending = maxPending
+		return "WithMaxPendingEvents", nil
+	}
+}
+
+// WithRoute adds a route that sends the events matching its filter to its sink. Routes are used
+// in addition to the endpoint passed to NewService, which may be left empty.
+func WithRoute(route Route) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if route.Sink == nil {
+			return "WithRoute", fmt.Errorf("sink cannot be nil")
+		}
+		if route.RetryPolicy.MaxAttempts < 0 || route.MaxPending < 0 {
+			return "WithRoute", fmt.Errorf("retry attempts and max pending events must not be negative")
+		}
+
+		s.routeConfigs = append(s.routeConfigs, route)
+		return "WithRoute", nil
+	}
+}
+
+// WithHTTPClient sets the client used to upload events to the endpoint, e.g. a client
+// authenticating the device.
+func WithHTTPClient(client *http.Client) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if client == nil {
+			return "WithHTTPClient", errors.New("http client is not provided")
+		}
+
+		s.client = client
+		return "WithHTTPClient", nil
+	}
+}
+
 func WithLogger(factory logger.Factory) ServiceOption {
 	return func(ctx context.Context, s *Service) (string, error) {
 		if factory == nil {
@@ -42,3 +142,25 @@ func WithLogger(factory logger.Factory) ServiceOption {
 		return "WitLogger", nil
 	}
 }
+
+// WithMetricsSnapshots registers a MetricsProducer that pushes a snapshot of the registry at
+// most once per interval. A nil registry selects metrics.DefaultRegistry.
+func WithMetricsSnapshots(registry *metrics.Registry, interval time.Duration) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		if interval <= 0 {
+			return "WithMetricsSnapshots", fmt.Errorf("snapshot interval must be greater than 0")
+		}
+
+		s.RegisterProducer(NewMetricsProducer(ctx, registry, interval))
+		return "WithMetricsSnapshots", nil
+	}
+}
+
+// WithCircuitBreakerEvents registers a CircuitBreakerProducer, so that state transitions of the
+// breakers are delivered as events. Nil breakers select commonHttp.DefaultCircuitBreakers.
+func WithCircuitBreakerEvents(breakers *commonHttp.CircuitBreakers) ServiceOption {
+	return func(ctx context.Context, s *Service) (string, error) {
+		s.RegisterProducer(NewCircuitBreakerProducer(ctx, breakers))
+		return "WithCircuitBreakerEvents", nil
+	}
+}
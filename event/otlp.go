@@ -0,0 +1,271 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type (
+	// OTLPConfig configures the export of events as OpenTelemetry log records using OTLP/HTTP
+	// with JSON encoding.
+	OTLPConfig struct {
+		// Endpoint is the full URL of the logs endpoint, e.g. http://collector:4318/v1/logs.
+		Endpoint string
+		// Headers are added to every export request, e.g. for authentication.
+		Headers map[string]string
+		// Compression is the Content-Encoding of the export requests. Only gzip is part of the
+		// OTLP specification.
+		Compression Compression
+		// ServiceName is reported as service.name resource attribute. Defaults to
+		// headless-go-client.
+		ServiceName string
+		// ScopeName is the instrumentation scope of the log records. Defaults to
+		// github.com/dtomschitz/headless-go-client/event.
+		ScopeName string
+	}
+
+	otlpLogsRequest struct {
+		ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+	}
+
+	otlpResourceLogs struct {
+		Resource  otlpResource    `json:"resource"`
+		ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+
+	otlpScopeLogs struct {
+		Scope      otlpScope       `json:"scope"`
+		LogRecords []otlpLogRecord `json:"logRecords"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpLogRecord struct {
+		TimeUnixNano         string         `json:"timeUnixNano"`
+		ObservedTimeUnixNano string         `json:"observedTimeUnixNano"`
+		SeverityNumber       int            `json:"severityNumber"`
+		SeverityText         string         `json:"severityText"`
+		EventName            string         `json:"eventName,omitempty"`
+		Body                 otlpAnyValue   `json:"body"`
+		Attributes           []otlpKeyValue `json:"attributes,omitempty"`
+	}
+
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue *string         `json:"stringValue,omitempty"`
+		BoolValue   *bool           `json:"boolValue,omitempty"`
+		IntValue    *string         `json:"intValue,omitempty"`
+		DoubleValue *float64        `json:"doubleValue,omitempty"`
+		ArrayValue  *otlpArrayValue `json:"arrayValue,omitempty"`
+		KvlistValue *otlpKvlist     `json:"kvlistValue,omitempty"`
+	}
+
+	otlpArrayValue struct {
+		Values []otlpAnyValue `json:"values"`
+	}
+
+	otlpKvlist struct {
+		Values []otlpKeyValue `json:"values"`
+	}
+
+	otlpResourceKey struct {
+		deviceId      string
+		clientVersion string
+		source        string
+	}
+)
+
+const (
+	otlpSeverityInfo  = 9
+	otlpSeverityError = 17
+
+	defaultOTLPServiceName = "headless-go-client"
+	defaultOTLPScopeName   = "github.com/dtomschitz/headless-go-client/event"
+)
+
+// NewOTLPRequestBuilder returns a RequestBuilder that exports events as OTLP log records.
+// DeviceId, ClientVersion and Source become resource attributes, Type the event name, Data the
+// record attributes and IsError the severity. Use it together with WithRequestBuilder.
+func NewOTLPRequestBuilder(config OTLPConfig) (RequestBuilder, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("endpoint cannot be empty")
+	}
+	if config.ServiceName == "" {
+		config.ServiceName = defaultOTLPServiceName
+	}
+	if config.ScopeName == "" {
+		config.ScopeName = defaultOTLPScopeName
+	}
+
+	return func(ctx context.Context, events []*Event) (*http.Request, error) {
+		payload, err := json.Marshal(newOTLPLogsRequest(config, events))
+		if err != nil {
+			return nil, err
+		}
+
+		payload, err = compress(payload, config.Compression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress events: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.Endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range config.Headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if config.Compression != CompressionNone {
+			req.Header.Set("Content-Encoding", string(config.Compression))
+		}
+		return req, nil
+	}, nil
+}
+
+// newOTLPLogsRequest groups the events by their resource, keeping the order of first occurrence.
+func newOTLPLogsRequest(config OTLPConfig, events []*Event) *otlpLogsRequest {
+	request := &otlpLogsRequest{}
+	index := make(map[otlpResourceKey]int)
+
+	for _, e := range events {
+		key := otlpResourceKey{deviceId: e.DeviceId, clientVersion: e.ClientVersion, source: e.Source}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(request.ResourceLogs)
+			index[key] = i
+			request.ResourceLogs = append(request.ResourceLogs, otlpResourceLogs{
+				Resource: otlpResource{Attributes: otlpResourceAttributes(config, key)},
+				ScopeLogs: []otlpScopeLogs{{
+					Scope: otlpScope{Name: config.ScopeName},
+				}},
+			})
+		}
+
+		scopeLogs := &request.ResourceLogs[i].ScopeLogs[0]
+		scopeLogs.LogRecords = append(scopeLogs.LogRecords, newOTLPLogRecord(e))
+	}
+
+	return request
+}
+
+func otlpResourceAttributes(config OTLPConfig, key otlpResourceKey) []otlpKeyValue {
+	attributes := []otlpKeyValue{{Key: "service.name", Value: otlpString(config.ServiceName)}}
+	if key.deviceId != "" {
+		attributes = append(attributes, otlpKeyValue{Key: "device.id", Value: otlpString(key.deviceId)})
+	}
+	if key.clientVersion != "" {
+		attributes = append(attributes, otlpKeyValue{Key: "service.version", Value: otlpString(key.clientVersion)})
+	}
+	if key.source != "" {
+		attributes = append(attributes, otlpKeyValue{Key: "event.source", Value: otlpString(key.source)})
+	}
+	return attributes
+}
+
+func newOTLPLogRecord(e *Event) otlpLogRecord {
+	timestamp := strconv.FormatInt(e.Timestamp.UnixNano(), 10)
+
+	record := otlpLogRecord{
+		TimeUnixNano:         timestamp,
+		ObservedTimeUnixNano: timestamp,
+		SeverityNumber:       otlpSeverityInfo,
+		SeverityText:         "INFO",
+		EventName:            string(e.Type),
+		Body:                 otlpString(e.Message),
+	}
+	if e.IsError {
+		record.SeverityNumber = otlpSeverityError
+		record.SeverityText = "ERROR"
+	}
+
+	// event.name is kept as attribute for receivers that predate the eventName field
+	record.Attributes = append(record.Attributes,
+		otlpKeyValue{Key: "event.name", Value: otlpString(string(e.Type))},
+		otlpKeyValue{Key: "event.id", Value: otlpString(e.Id)},
+	)
+	// OTLP requires unique attribute keys, so data fields named like the attributes above are
+	// prefixed.
+	for _, kv := range otlpKeyValues(e.Data) {
+		if kv.Key == "event.name" || kv.Key == "event.id" {
+			kv.Key = "data." + kv.Key
+		}
+		record.Attributes = append(record.Attributes, kv)
+	}
+	return record
+}
+
+func otlpKeyValues(data map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, otlpKeyValue{Key: k, Value: otlpValue(data[k])})
+	}
+	return values
+}
+
+func otlpValue(value interface{}) otlpAnyValue {
+	switch v := value.(type) {
+	case nil:
+		return otlpAnyValue{}
+	case string:
+		return otlpString(v)
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		return otlpInt(int64(v))
+	case int32:
+		return otlpInt(int64(v))
+	case int64:
+		return otlpInt(v)
+	case float32:
+		return otlpValue(float64(v))
+	case float64:
+		// Whole numbers are kept as doubles so that a field does not change its type between
+		// records.
+		return otlpAnyValue{DoubleValue: &v}
+	case []interface{}:
+		values := make([]otlpAnyValue, len(v))
+		for i, item := range v {
+			values[i] = otlpValue(item)
+		}
+		return otlpAnyValue{ArrayValue: &otlpArrayValue{Values: values}}
+	case map[string]interface{}:
+		return otlpAnyValue{KvlistValue: &otlpKvlist{Values: otlpKeyValues(v)}}
+	default:
+		if data, err := json.Marshal(v); err == nil {
+			return otlpString(string(data))
+		}
+		return otlpString(fmt.Sprint(v))
+	}
+}
+
+func otlpString(value string) otlpAnyValue {
+	return otlpAnyValue{StringValue: &value}
+}
+
+func otlpInt(value int64) otlpAnyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpAnyValue{IntValue: &s}
+}
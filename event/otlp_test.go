@@ -0,0 +1,185 @@
+package event_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// otlpReceiver is a minimal OTLP/HTTP logs receiver that records exported requests.
+	otlpReceiver struct {
+		*httptest.Server
+
+		mu       sync.Mutex
+		requests []otlpExport
+		headers  []http.Header
+	}
+
+	otlpExport struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []otlpAttribute `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				Scope struct {
+					Name string `json:"name"`
+				} `json:"scope"`
+				LogRecords []struct {
+					TimeUnixNano   string          `json:"timeUnixNano"`
+					SeverityNumber int             `json:"severityNumber"`
+					SeverityText   string          `json:"severityText"`
+					EventName      string          `json:"eventName"`
+					Body           json.RawMessage `json:"body"`
+					Attributes     []otlpAttribute `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+
+	otlpAttribute struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+)
+
+func (receiver *otlpReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = reader
+	}
+
+	var export otlpExport
+	if err := json.NewDecoder(body).Decode(&export); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	receiver.mu.Lock()
+	receiver.requests = append(receiver.requests, export)
+	receiver.headers = append(receiver.headers, r.Header.Clone())
+	receiver.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"partialSuccess":{}}`))
+}
+
+func attributes(values []otlpAttribute) map[string]string {
+	result := make(map[string]string, len(values))
+	for _, v := range values {
+		result[v.Key] = string(v.Value)
+	}
+	return result
+}
+
+func TestOTLPRequestBuilder_ExportsEventsAsLogRecords(t *testing.T) {
+	// given
+	receiver := &otlpReceiver{}
+	receiver.Server = httptest.NewServer(receiver)
+	defer receiver.Close()
+	builder, err := event.NewOTLPRequestBuilder(event.OTLPConfig{
+		Endpoint:    receiver.URL + "/v1/logs",
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		Compression: event.CompressionGzip,
+	})
+	require.NoError(t, err)
+
+	service, err := event.NewService(context.Background(), receiver.URL, event.WithFlushInterval(time.Hour), event.WithRequestBuilder(builder))
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+
+	timestamp := time.Unix(1700000000, 42)
+	emitter.Push(&event.Event{
+		Id:            "event-0",
+		DeviceId:      "device-1",
+		ClientVersion: "1.2.3",
+		Source:        "ConfigService",
+		Type:          "config_refreshed",
+		Message:       "refreshed",
+		Timestamp:     timestamp,
+		Data:          map[string]interface{}{"retries": 3, "ratio": 0.5, "duration": 1.0, "cached": true, "tags": []interface{}{"a"}, "event.id": "custom"},
+	})
+	emitter.Push(&event.Event{
+		Id:            "event-1",
+		DeviceId:      "device-1",
+		ClientVersion: "1.2.3",
+		Source:        "Updater",
+		Type:          "update_failed",
+		Message:       "boom",
+		Timestamp:     timestamp,
+		IsError:       true,
+	})
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, receiver.requests, 1)
+	assert.Equal(t, "Bearer token", receiver.headers[0].Get("Authorization"))
+
+	resourceLogs := receiver.requests[0].ResourceLogs
+	require.Len(t, resourceLogs, 2, "expected one resource per source")
+
+	assert.Equal(t, map[string]string{
+		"service.name":    `{"stringValue":"headless-go-client"}`,
+		"device.id":       `{"stringValue":"device-1"}`,
+		"service.version": `{"stringValue":"1.2.3"}`,
+		"event.source":    `{"stringValue":"ConfigService"}`,
+	}, attributes(resourceLogs[0].Resource.Attributes))
+
+	info := resourceLogs[0].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, "1700000000000000042", info.TimeUnixNano)
+	assert.Equal(t, 9, info.SeverityNumber)
+	assert.Equal(t, "INFO", info.SeverityText)
+	assert.Equal(t, "config_refreshed", info.EventName)
+	assert.JSONEq(t, `{"stringValue":"refreshed"}`, string(info.Body))
+	assert.Equal(t, map[string]string{
+		"event.name":    `{"stringValue":"config_refreshed"}`,
+		"event.id":      `{"stringValue":"event-0"}`,
+		"cached":        `{"boolValue":true}`,
+		"ratio":         `{"doubleValue":0.5}`,
+		"duration":      `{"doubleValue":1}`,
+		"retries":       `{"intValue":"3"}`,
+		"tags":          `{"arrayValue":{"values":[{"stringValue":"a"}]}}`,
+		"data.event.id": `{"stringValue":"custom"}`,
+	}, attributes(info.Attributes))
+	assert.Len(t, info.Attributes, 8, "expected attribute keys to be unique")
+
+	failure := resourceLogs[1].ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, 17, failure.SeverityNumber)
+	assert.Equal(t, "ERROR", failure.SeverityText)
+	assert.Equal(t, "update_failed", failure.EventName)
+}
+
+func TestNewOTLPRequestBuilder_RequiresEndpoint(t *testing.T) {
+	// when
+	_, err := event.NewOTLPRequestBuilder(event.OTLPConfig{})
+
+	// then
+	assert.Error(t, err)
+}
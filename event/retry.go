@@ -0,0 +1,82 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+)
+
+type (
+	// RetryPolicy controls how often and how fast a failed flush is retried. Uploads are POST
+	// requests without an Idempotency-Key, so the RetryTransport of the client only retries
+	// them on transport errors and this policy alone decides on retrying 5xx responses. This
+	// keeps the attempts of both from multiplying.
+	RetryPolicy struct {
+		// MaxAttempts is the number of delivery attempts per flush including the first one.
+		MaxAttempts int
+		// BaseDelay is the delay before the first retry. It doubles with every further attempt.
+		BaseDelay time.Duration
+		// MaxDelay caps the delay between two attempts.
+		MaxDelay time.Duration
+	}
+
+	// BackpressureError is returned by Flush when an endpoint asked the client to slow down
+	// with a 429 or 503 response. The events are kept and delivered after RetryAfter.
+	BackpressureError struct {
+		StatusCode int
+		RetryAfter time.Duration
+	}
+
+	// deliveryError describes a failed delivery attempt and whether it is worth retrying.
+	deliveryError struct {
+		err       error
+		retryable bool
+	}
+)
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+func (e *BackpressureError) Error() string {
+	return fmt.Sprintf("endpoint applied backpressure with status %d, retrying after %s", e.StatusCode, e.RetryAfter)
+}
+
+// IsBackpressureError reports whether err was caused by backpressure of the endpoint.
+func IsBackpressureError(err error) bool {
+	var backpressureError *BackpressureError
+	return errors.As(err, &backpressureError)
+}
+
+func (e *deliveryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *deliveryError) Unwrap() error {
+	return e.err
+}
+
+// backoff returns the delay before the given retry using exponential backoff with full jitter.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	return commonHttp.Backoff(p.BaseDelay, p.MaxDelay, retry)
+}
+
+// classifyResponse turns a non-2xx response into an error. 5xx, 408 and 429 responses are
+// retryable, other client errors are not. 429 and 503 are reported as backpressure, without a
+// Retry-After header the route falls back to its retry policy.
+func classifyResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		retryAfter, _ := commonHttp.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return &BackpressureError{StatusCode: resp.StatusCode, RetryAfter: retryAfter}
+	}
+
+	return &deliveryError{
+		err:       fmt.Errorf("received non-2xx response: %s", resp.Status),
+		retryable: resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout,
+	}
+}
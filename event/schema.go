@@ -0,0 +1,389 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Schema is the subset of JSON Schema (draft 2020-12) used to describe event payloads.
+	Schema struct {
+		Type   string `json:"-"`
+		Format string `json:"format,omitempty"`
+		// Nullable allows null in addition to Type.
+		Nullable             bool               `json:"-"`
+		Properties           map[string]*Schema `json:"properties,omitempty"`
+		Required             []string           `json:"required,omitempty"`
+		AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+		// Closed forbids properties that are not listed in Properties.
+		Closed bool    `json:"-"`
+		Items  *Schema `json:"items,omitempty"`
+	}
+
+	// PayloadDefinition describes the payload of an event type.
+	PayloadDefinition struct {
+		Type    EventType
+		Version int
+		Schema  *Schema
+	}
+
+	// SchemaRegistry holds the payload definitions per event type. NewEvent validates the data
+	// of registered event types against the DefaultSchemaRegistry.
+	SchemaRegistry struct {
+		mu          sync.RWMutex
+		definitions map[EventType]*PayloadDefinition
+	}
+)
+
+// InvalidPayloadDataKey is the only data field of an event whose payload failed validation.
+// Such events carry no SchemaVersion as their data no longer follows the registered schema.
+const InvalidPayloadDataKey = "payloadError"
+
+var (
+	DefaultSchemaRegistry = NewSchemaRegistry()
+
+	ErrInvalidPayload = errors.New("invalid event payload")
+
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{definitions: make(map[EventType]*PayloadDefinition)}
+}
+
+// RegisterPayload registers the payload of the event type in the DefaultSchemaRegistry.
+func RegisterPayload(eventType EventType, version int, payload any) error {
+	return DefaultSchemaRegistry.Register(eventType, version, payload)
+}
+
+// MustRegisterPayload is like RegisterPayload but panics on error. It is meant to be used in
+// package initialization.
+func MustRegisterPayload(eventType EventType, version int, payload any) {
+	if err := RegisterPayload(eventType, version, payload); err != nil {
+		panic(err)
+	}
+}
+
+// Register derives the schema of the event type from the Go type of payload, which has to be a
+// struct or a map with string keys. The schema also allows the RepetitionsDataKey field added
+// to deduplication summaries, so payloads must not use it themselves. Registering an event
+// type again with a higher version replaces the previous definition.
+func (r *SchemaRegistry) Register(eventType EventType, version int, payload any) error {
+	if eventType == "" {
+		return errors.New("event type cannot be empty")
+	}
+	if version < 1 {
+		return errors.New("schema version must be at least 1")
+	}
+
+	t := reflect.TypeOf(payload)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || (t.Kind() != reflect.Struct && (t.Kind() != reflect.Map || t.Key().Kind() != reflect.String)) {
+		return fmt.Errorf("payload of %s must be a struct or a map with string keys", eventType)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.definitions[eventType]; ok && existing.Version >= version {
+		return fmt.Errorf("%s is already registered with version %d", eventType, existing.Version)
+	}
+
+	schema := schemaOf(t, make(map[reflect.Type]bool))
+	schema.Nullable = false
+	if _, ok := schema.Properties[RepetitionsDataKey]; ok {
+		return fmt.Errorf("payload of %s must not declare the reserved field %s", eventType, RepetitionsDataKey)
+	}
+	if schema.Properties == nil {
+		schema.Properties = make(map[string]*Schema)
+	}
+	schema.Properties[RepetitionsDataKey] = &Schema{Type: "integer"}
+	r.definitions[eventType] = &PayloadDefinition{Type: eventType, Version: version, Schema: schema}
+	return nil
+}
+
+// Definition returns the payload definition of the event type.
+func (r *SchemaRegistry) Definition(eventType EventType) (*PayloadDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definition, ok := r.definitions[eventType]
+	return definition, ok
+}
+
+// Normalize validates the data against the definition of the event type and returns it in its
+// JSON representation. Empty data is valid for every event type, e.g. for error events.
+func (r *SchemaRegistry) Normalize(eventType EventType, data map[string]interface{}) (map[string]interface{}, error) {
+	definition, ok := r.Definition(eventType)
+	if !ok || len(data) == 0 {
+		return data, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(raw, &normalized); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+
+	if err := definition.Schema.validate("", normalized); err != nil {
+		return nil, fmt.Errorf("%w for %s: %v", ErrInvalidPayload, eventType, err)
+	}
+	return normalized, nil
+}
+
+// JSONSchema exports the schemas of all registered event types as a single JSON Schema
+// document with one definition per event type.
+func (r *SchemaRegistry) JSONSchema() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	defs := make(map[EventType]json.RawMessage, len(r.definitions))
+	for t, d := range r.definitions {
+		data, err := json.Marshal(d.Schema)
+		if err != nil {
+			return nil, err
+		}
+
+		var definition map[string]interface{}
+		if err := json.Unmarshal(data, &definition); err != nil {
+			return nil, err
+		}
+		definition["title"] = string(t)
+		definition["x-schema-version"] = d.Version
+
+		if defs[t], err = json.Marshal(definition); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "Event payloads",
+		"$defs":   defs,
+	}, "", "  ")
+}
+
+// ServeHTTP serves the JSON Schema export.
+func (r *SchemaRegistry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	data, err := r.JSONSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
+
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type plain Schema
+	out := struct {
+		Type                 interface{} `json:"type,omitempty"`
+		AdditionalProperties interface{} `json:"additionalProperties,omitempty"`
+		*plain
+	}{plain: (*plain)(s)}
+
+	switch {
+	case s.Type != "" && s.Nullable:
+		out.Type = []string{s.Type, "null"}
+	case s.Type != "":
+		out.Type = s.Type
+	}
+
+	switch {
+	case s.Closed:
+		out.AdditionalProperties = false
+	case s.AdditionalProperties != nil:
+		out.AdditionalProperties = s.AdditionalProperties
+	}
+
+	return json.Marshal(out)
+}
+
+// schemaOf derives the schema of a Go type following the rules of encoding/json. Types with
+// custom JSON encoding and recursive references accept any value.
+func schemaOf(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if visiting[t] || t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := schemaOf(t.Elem(), visiting)
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Nullable: t.Kind() == reflect.Slice, Items: schemaOf(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", Nullable: true, AdditionalProperties: schemaOf(t.Elem(), visiting)}
+	case reflect.Struct:
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema), Closed: true}
+		addStructFields(schema, t, visiting)
+		sort.Strings(schema.Required)
+		return schema
+	default:
+		return &Schema{}
+	}
+}
+
+func addStructFields(schema *Schema, t reflect.Type, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			addStructFields(schema, field.Type, visiting)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = schemaOf(field.Type, visiting)
+		if !slices.Contains(strings.Split(options, ","), "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// validate checks a value decoded from JSON against the schema.
+func (s *Schema) validate(path string, value interface{}) error {
+	if value == nil {
+		if s.Type == "" || s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s must not be null", displayPath(path))
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return typeError(path, s.Type, value)
+		}
+	case "integer":
+		if n, ok := value.(float64); !ok || n != float64(int64(n)) {
+			return typeError(path, s.Type, value)
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return typeError(path, s.Type, value)
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return typeError(path, s.Type, value)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s must be a date-time", displayPath(path))
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return typeError(path, s.Type, value)
+		}
+		for i, item := range items {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return typeError(path, s.Type, value)
+		}
+		return s.validateObject(path, object)
+	}
+
+	return nil
+}
+
+func (s *Schema) validateObject(path string, object map[string]interface{}) error {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			return fmt.Errorf("%s is required", displayPath(joinPath(path, name)))
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		property, ok := s.Properties[k]
+		switch {
+		case ok:
+		case s.AdditionalProperties != nil:
+			property = s.AdditionalProperties
+		case s.Closed:
+			return fmt.Errorf("%s is not allowed", displayPath(joinPath(path, k)))
+		default:
+			continue
+		}
+
+		if err := property.validate(joinPath(path, k), object[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func typeError(path, expected string, value interface{}) error {
+	return fmt.Errorf("%s must be of type %s but is %T", displayPath(path), expected, value)
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "payload"
+	}
+	return path
+}
@@ -0,0 +1,156 @@
+package event_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/google/uuid"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPayload struct {
+	Name    string            `json:"name"`
+	Count   int               `json:"count"`
+	Comment *string           `json:"comment"`
+	Tags    []string          `json:"tags,omitempty"`
+	At      time.Time         `json:"at,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+func TestSchemaRegistry_Register(t *testing.T) {
+	registry := event.NewSchemaRegistry()
+	require.NoError(t, registry.Register("test_event", 1, testPayload{}))
+
+	assert.Error(t, registry.Register("", 1, testPayload{}))
+	assert.Error(t, registry.Register("other_event", 0, testPayload{}))
+	assert.Error(t, registry.Register("other_event", 1, "payload"))
+	assert.Error(t, registry.Register("test_event", 1, testPayload{}), "expected version to be increased")
+	assert.Error(t, registry.Register("other_event", 1, struct {
+		Repetitions int `json:"repetitions"`
+	}{}), "expected the reserved field to be rejected")
+	assert.NoError(t, registry.Register("test_event", 2, &testPayload{}))
+
+	definition, ok := registry.Definition("test_event")
+	require.True(t, ok)
+	assert.Equal(t, 2, definition.Version)
+	assert.Equal(t, []string{"count", "name"}, definition.Schema.Required)
+}
+
+func TestSchemaRegistry_Normalize(t *testing.T) {
+	registry := event.NewSchemaRegistry()
+	require.NoError(t, registry.Register("test_event", 1, testPayload{}))
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		wantErr string
+	}{
+		{name: "valid payload", data: map[string]interface{}{"name": "a", "count": 1, "tags": []string{"x"}, "at": time.Now()}},
+		{name: "empty payload", data: nil},
+		{name: "nullable field", data: map[string]interface{}{"name": "a", "count": 1, "comment": nil}},
+		{name: "missing required field", data: map[string]interface{}{"name": "a"}, wantErr: "count is required"},
+		{name: "wrong type", data: map[string]interface{}{"name": "a", "count": 1.5}, wantErr: "count must be of type integer"},
+		{name: "unknown field", data: map[string]interface{}{"name": "a", "count": 1, "extra": true}, wantErr: "extra is not allowed"},
+		{name: "nested field", data: map[string]interface{}{"name": "a", "count": 1, "labels": map[string]int{"k": 1}}, wantErr: "labels.k must be of type string"},
+		{name: "invalid date-time", data: map[string]interface{}{"name": "a", "count": 1, "at": "yesterday"}, wantErr: "at must be a date-time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := registry.Normalize("test_event", tt.data)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, event.ErrInvalidPayload)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSchemaRegistry_JSONSchema(t *testing.T) {
+	// given
+	registry := event.NewSchemaRegistry()
+	require.NoError(t, registry.Register("test_event", 1, testPayload{}))
+	recorder := httptest.NewRecorder()
+
+	// when
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/schema", nil))
+
+	// then
+	assert.Equal(t, "application/schema+json", recorder.Header().Get("Content-Type"))
+
+	var document struct {
+		Schema string                            `json:"$schema"`
+		Defs   map[string]map[string]interface{} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &document))
+	assert.Equal(t, "https://json-schema.org/draft/2020-12/schema", document.Schema)
+
+	definition := document.Defs["test_event"]
+	require.NotNil(t, definition)
+	assert.Equal(t, "test_event", definition["title"])
+	assert.Equal(t, float64(1), definition["x-schema-version"])
+	assert.Equal(t, false, definition["additionalProperties"])
+
+	properties := definition["properties"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"string", "null"}, properties["comment"].(map[string]interface{})["type"])
+	assert.Equal(t, "date-time", properties["at"].(map[string]interface{})["format"])
+}
+
+func TestNewEvent_ValidatesRegisteredPayloads(t *testing.T) {
+	// The default registry is shared by all runs of the test, so every run registers its own type.
+	eventType := event.EventType("schema_test_event_" + uuid.NewString())
+	require.NoError(t, event.RegisterPayload(eventType, 3, testPayload{}))
+
+	valid := event.NewEvent(context.Background(), eventType, event.WithPayload(testPayload{Name: "a", Count: 2}))
+	assert.Equal(t, 3, valid.SchemaVersion)
+	assert.Equal(t, "a", valid.Data["name"])
+	assert.Equal(t, float64(2), valid.Data["count"])
+
+	invalid := event.NewEvent(context.Background(), eventType, event.WithDataField("count", "two"))
+	assert.Zero(t, invalid.SchemaVersion, "expected replaced payloads to claim no schema")
+	assert.Contains(t, invalid.Data[event.InvalidPayloadDataKey], "name is required")
+	assert.Len(t, invalid.Data, 1)
+
+	unregistered := event.NewEvent(context.Background(), "unregistered", event.WithDataField("any", 1))
+	assert.Zero(t, unregistered.SchemaVersion)
+	assert.Equal(t, 1, unregistered.Data["any"])
+}
+
+func TestSchemaRegistry_AcceptsRepetitionSummaries(t *testing.T) {
+	// given
+	registry := event.NewSchemaRegistry()
+	require.NoError(t, registry.Register("test_event", 1, testPayload{}))
+	require.NoError(t, registry.Register("map_event", 1, map[string]string{}))
+	emitter := event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+		DefaultPolicy: event.ThrottlePolicy{DedupeWindow: 10 * time.Millisecond},
+	})
+	defer emitter.Close(context.Background())
+
+	// when
+	for i := 0; i < 2; i++ {
+		emitter.Push(&event.Event{Type: "test_event", Message: "timeout", IsError: true, Data: map[string]interface{}{"name": "a", "count": 1}})
+		emitter.Push(&event.Event{Type: "map_event", Message: "timeout", IsError: true, Data: map[string]interface{}{"host": "a"}})
+	}
+	require.Len(t, emitter.PollEvents(), 2)
+
+	var summaries []*event.Event
+	require.Eventually(t, func() bool {
+		summaries = append(summaries, emitter.PollEvents()...)
+		return len(summaries) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	// then
+	for _, summary := range summaries {
+		assert.Equal(t, 1, summary.Data[event.RepetitionsDataKey])
+		_, err := registry.Normalize(summary.Type, summary.Data)
+		assert.NoError(t, err, "expected the summary of %s to follow its schema", summary.Type)
+	}
+}
@@ -1,9 +1,8 @@
 package event
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
@@ -11,6 +10,7 @@ import (
 
 	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
 	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
 	"github.com/dtomschitz/headless-go-client/logger"
 )
 
@@ -19,11 +19,27 @@ type (
 		endpoint string
 		logger   logger.Logger
 
-		requestBuilder RequestBuilder
-		producers      []Producer
+		producers []Producer
+		interval  time.Duration
 
-		interval time.Duration
-		client   *http.Client
+		// The following fields configure the route to endpoint which receives all events.
+		requestBuilder RequestBuilder
+		encoding       Encoding
+		compression    Compression
+		client         *http.Client
+		retryPolicy    RetryPolicy
+		maxPending     int
+		// maxBatchEvents and maxBatchBytes limit a single upload. Larger flushes are split into
+		// several requests.
+		maxBatchEvents int
+		maxBatchBytes  int
+
+		routeConfigs []Route
+		routes       []*route
+		// deliveries tracks the polled events of AckProducers until all routes are done with
+		// them. It is guarded by flushMu.
+		deliveries map[*Event]*delivery
+		flushMu    sync.Mutex
 
 		internalCtx    context.Context
 		internalCancel context.CancelFunc
@@ -33,27 +49,20 @@ type (
 	}
 
 	RequestBuilder func(ctx context.Context, events []*Event) (*http.Request, error)
+
+	// delivery is the state of an event of an AckProducer. routes counts the matching routes
+	// which are not done with the event yet, settled reports whether any route is done with it.
+	delivery struct {
+		producer AckProducer
+		routes   int
+		settled  bool
+	}
 )
 
 const (
 	ServiceName = "EventService"
 )
 
-func defaultRequestBuilder(endpoint string) RequestBuilder {
-	return func(ctx context.Context, events []*Event) (*http.Request, error) {
-		payload, err := json.Marshal(events)
-		if err != nil {
-			return nil, err
-		}
-		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(payload))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/json")
-		return req, nil
-	}
-}
-
 func NewService(ctx context.Context, endpoint string, opts ...ServiceOption) (*Service, error) {
 	internalCtx, internalCancel := context.WithCancel(context.WithValue(ctx, commonCtx.ServiceKey, ServiceName))
 
@@ -65,8 +74,14 @@ func NewService(ctx context.Context, endpoint string, opts ...ServiceOption) (*S
 		endpoint:       endpoint,
 		interval:       1 * time.Minute,
 		client:         httpClient,
+		retryPolicy:    DefaultRetryPolicy,
+		maxPending:     1000,
 		logger:         &logger.NoopLogger{},
-		requestBuilder: defaultRequestBuilder(endpoint),
+		encoding:       EncodingJSON,
+		compression:    CompressionNone,
+		maxBatchEvents: 500,
+		maxBatchBytes:  1024 * 1024,
+		deliveries:     make(map[*Event]*delivery),
 	}
 
 	for _, opt := range opts {
@@ -76,16 +91,63 @@ func NewService(ctx context.Context, endpoint string, opts ...ServiceOption) (*S
 		}
 	}
 
+	if err := service.buildRoutes(); err != nil {
+		internalCancel()
+		return nil, err
+	}
+
 	service.start(internalCtx)
 	service.logger.Info("started service successfully", "pushInterval", service.interval)
 
 	return service, nil
 }
 
+// buildRoutes creates the route to endpoint, if given, followed by the routes added with
+// WithRoute.
+func (s *Service) buildRoutes() error {
+	if s.endpoint != "" {
+		sink, err := NewHTTPSink(HTTPSinkConfig{
+			Endpoint:       s.endpoint,
+			Client:         s.client,
+			RequestBuilder: s.requestBuilder,
+			Encoding:       s.encoding,
+			Compression:    s.compression,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create sink for endpoint: %w", err)
+		}
+
+		s.routes = append(s.routes, newRoute(Route{
+			Sink:           sink,
+			RetryPolicy:    s.retryPolicy,
+			MaxPending:     s.maxPending,
+			MaxBatchEvents: unlimitedIfZero(s.maxBatchEvents),
+			MaxBatchBytes:  unlimitedIfZero(s.maxBatchBytes),
+		}, s.logger))
+	}
+
+	for _, r := range s.routeConfigs {
+		s.routes = append(s.routes, newRoute(withRouteDefaults(r), s.logger))
+	}
+
+	if len(s.routes) == 0 {
+		s.logger.Warn("no event endpoint or route configured, events are discarded")
+	}
+	return nil
+}
+
+func unlimitedIfZero(limit int) int {
+	if limit == 0 {
+		return -1
+	}
+	return limit
+}
+
 func (s *Service) start(ctx context.Context) {
 	s.wg.Add(1)
 
 	go func() {
+		defer recovery.Recover(ServiceName)
 		ticker := time.NewTicker(s.interval)
 		defer ticker.Stop()
 		defer s.wg.Done()
@@ -95,7 +157,9 @@ func (s *Service) start(ctx context.Context) {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if err := s.Flush(ctx); err != nil {
+				if err := s.Flush(ctx); IsBackpressureError(err) {
+					s.logger.Info("event sink applied backpressure", "error", err)
+				} else if err != nil {
 					s.logger.Error("failed to flush events", "error", err)
 				}
 			}
@@ -109,37 +173,118 @@ func (s *Service) RegisterProducer(e Producer) {
 	s.producers = append(s.producers, e)
 }
 
+// Flush delivers the events of all producers to the sinks of the matching routes with
+// at-least-once semantics. Every route splits its events into batches, retries failed writes
+// according to its retry policy and pauses while its sink applies backpressure. Undelivered
+// events are kept by the route and are written again with the next flush. Events of
+// AckProducers are acknowledged once all matching routes are done with them, or handed back to
+// their producer if no route could deliver them.
 func (s *Service) Flush(ctx context.Context) error {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
 	s.mu.RLock()
 	producers := make([]Producer, len(s.producers))
 	copy(producers, s.producers)
+	routes := make([]*route, len(s.routes))
+	copy(routes, s.routes)
 	s.mu.RUnlock()
 
 	var batch []*Event
 	for _, p := range producers {
-		batch = append(batch, p.PollEvents()...)
+		events := p.PollEvents()
+		if ap, ok := p.(AckProducer); ok {
+			for _, e := range events {
+				s.deliveries[e] = &delivery{producer: ap}
+			}
+		}
+		batch = append(batch, events...)
 	}
 
-	if len(batch) == 0 {
-		return nil
+	routed := make([][]*Event, len(routes))
+	for _, e := range batch {
+		for i, r := range routes {
+			if r.Filter.Matches(e) {
+				routed[i] = append(routed[i], e)
+				if d, ok := s.deliveries[e]; ok {
+					d.routes++
+				}
+			}
+		}
 	}
 
-	req, err := s.requestBuilder(ctx, batch)
-	if err != nil {
-		return fmt.Errorf("failed to build request: %w", err)
+	var (
+		wg      sync.WaitGroup
+		errs    = make([]error, len(routes))
+		settled = make([][]*Event, len(routes))
+	)
+	for i, r := range routes {
+		wg.Add(1)
+		go func() {
+			defer recovery.Recover(ServiceName)
+			defer wg.Done()
+
+			var err error
+			if settled[i], err = r.flush(ctx, routed[i]); err != nil {
+				errs[i] = fmt.Errorf("sink %s: %w", r.Sink.Name(), err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.settle(batch, routes, settled)
+	return errors.Join(errs...)
+}
+
+// settle acknowledges the events of AckProducers which all matching routes are done with. Polled
+// events that no route could deliver are removed from the pending events of the routes and
+// handed back to their producer, so that routes which delivered an event do not receive it
+// again. Routes keep the other undelivered events until their pending limit is reached.
+func (s *Service) settle(polled []*Event, routes []*route, settled [][]*Event) {
+	done := func(events []*Event) {
+		for _, e := range events {
+			if d, ok := s.deliveries[e]; ok {
+				d.routes--
+				d.settled = true
+			}
+		}
+	}
+	for _, events := range settled {
+		done(events)
 	}
 
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+	nacked := make(map[AckProducer][]*Event)
+	released := make(map[*Event]struct{})
+	for _, e := range polled {
+		if d, ok := s.deliveries[e]; ok && d.routes > 0 && !d.settled {
+			nacked[d.producer] = append(nacked[d.producer], e)
+			released[e] = struct{}{}
+			delete(s.deliveries, e)
+		}
+	}
+	for _, r := range routes {
+		if len(released) > 0 {
+			r.release(released)
+		}
+		done(r.trim())
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("received non-2xx response: %s", resp.Status)
+	acked := make(map[AckProducer][]*Event)
+	for e, d := range s.deliveries {
+		if d.routes <= 0 {
+			acked[d.producer] = append(acked[d.producer], e)
+			delete(s.deliveries, e)
+		}
 	}
 
-	return nil
+	for p, events := range acked {
+		if err := p.Ack(events); err != nil {
+			s.logger.Error("failed to acknowledge events", "error", err)
+		}
+	}
+	for p, events := range nacked {
+		p.Nack(events)
+	}
 }
 
 func (s *Service) Name() string {
@@ -172,5 +317,11 @@ func (s *Service) Close(ctx context.Context) error {
 
 	<-done
 
+	for _, r := range s.routes {
+		if err := r.Sink.Close(ctx); err != nil {
+			s.logger.Error("failed to close event sink", "sink", r.Sink.Name(), "error", err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,367 @@
+package event_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventServer records the events it receives and answers with the given responses in order,
+// and with 200 OK once they are used up.
+type eventServer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []func(w http.ResponseWriter)
+	received  [][]*event.Event
+}
+
+func (s *eventServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	events, err := decodeEvents(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, events)
+
+	if len(s.responses) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	respond := s.responses[0]
+	s.responses = s.responses[1:]
+	respond(w)
+}
+
+func decodeEvents(r *http.Request) ([]*event.Event, error) {
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = reader
+	case "zstd":
+		decoder, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		body = decoder
+	}
+
+	var events []*event.Event
+	if r.Header.Get("Content-Type") != string(event.EncodingNDJSON) {
+		err := json.NewDecoder(body).Decode(&events)
+		return events, err
+	}
+
+	decoder := json.NewDecoder(body)
+	for decoder.More() {
+		var e event.Event
+		if err := decoder.Decode(&e); err != nil {
+			return nil, err
+		}
+		events = append(events, &e)
+	}
+	return events, nil
+}
+
+func ids(events []*event.Event) []string {
+	result := make([]string, len(events))
+	for i, e := range events {
+		result[i] = e.Id
+	}
+	return result
+}
+
+func (s *eventServer) requests() [][]*event.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]*event.Event(nil), s.received...)
+}
+
+func status(code int, headers ...string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func TestService_FlushRetries(t *testing.T) {
+	t.Run("retries failed deliveries", func(t *testing.T) {
+		// given
+		server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError), status(http.StatusBadGateway)}}
+		server.Server = httptest.NewServer(server)
+		defer server.Close()
+		service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour), event.WithRetryPolicy(event.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+		require.NoError(t, err)
+		defer service.Close(context.Background())
+
+		emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+		defer emitter.Close(context.Background())
+		service.RegisterProducer(emitter)
+		pushEvents(emitter, 2)
+
+		// when
+		err = service.Flush(context.Background())
+
+		// then
+		require.NoError(t, err)
+		requests := server.requests()
+		require.Len(t, requests, 3)
+		for _, events := range requests {
+			assert.Equal(t, []string{"event-0", "event-1"}, []string{events[0].Id, events[1].Id})
+		}
+	})
+
+	t.Run("requeues undelivered events", func(t *testing.T) {
+		// given
+		server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+		server.Server = httptest.NewServer(server)
+		defer server.Close()
+		service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour), event.WithRetryPolicy(event.RetryPolicy{MaxAttempts: 1}))
+		require.NoError(t, err)
+		defer service.Close(context.Background())
+
+		emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+		defer emitter.Close(context.Background())
+		service.RegisterProducer(emitter)
+		pushEvents(emitter, 1)
+		require.Error(t, service.Flush(context.Background()))
+
+		emitter.Push(&event.Event{Id: "event-1"})
+
+		// when
+		err = service.Flush(context.Background())
+
+		// then
+		require.NoError(t, err)
+		requests := server.requests()
+		require.Len(t, requests, 2)
+		require.Len(t, requests[1], 2)
+		assert.Equal(t, "event-0", requests[1][0].Id)
+		assert.Equal(t, "event-1", requests[1][1].Id)
+	})
+
+	t.Run("honours retry after", func(t *testing.T) {
+		// given
+		server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusTooManyRequests, "Retry-After", "1")}}
+		server.Server = httptest.NewServer(server)
+		defer server.Close()
+		service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour))
+		require.NoError(t, err)
+		defer service.Close(context.Background())
+
+		emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+		defer emitter.Close(context.Background())
+		service.RegisterProducer(emitter)
+		pushEvents(emitter, 1)
+
+		// when
+		err = service.Flush(context.Background())
+
+		// then
+		require.True(t, event.IsBackpressureError(err))
+		require.NoError(t, service.Flush(context.Background()))
+		require.Len(t, server.requests(), 1, "expected flush to be paused")
+
+		require.Eventually(t, func() bool {
+			return service.Flush(context.Background()) == nil && len(server.requests()) == 2
+		}, 3*time.Second, 50*time.Millisecond)
+		requests := server.requests()
+		assert.Equal(t, "event-0", requests[1][0].Id)
+	})
+
+	t.Run("drops rejected events", func(t *testing.T) {
+		// given
+		server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusBadRequest)}}
+		server.Server = httptest.NewServer(server)
+		defer server.Close()
+		service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour))
+		require.NoError(t, err)
+		defer service.Close(context.Background())
+
+		emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+		defer emitter.Close(context.Background())
+		service.RegisterProducer(emitter)
+		pushEvents(emitter, 1)
+
+		// when
+		err = service.Flush(context.Background())
+
+		// then
+		require.Error(t, err)
+		require.NoError(t, service.Flush(context.Background()))
+		assert.Len(t, server.requests(), 1)
+	})
+}
+
+func TestService_FlushSplitsBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		maxEvents int
+		maxBytes  int
+		want      [][]string
+	}{
+		{
+			name:      "max events",
+			maxEvents: 2,
+			want:      [][]string{{"event-0", "event-1"}, {"event-2", "event-3"}, {"event-4"}},
+		},
+		{
+			name:     "max bytes",
+			maxBytes: 300,
+			want:     [][]string{{"event-0", "event-1"}, {"event-2", "event-3"}, {"event-4"}},
+		},
+		{
+			name:     "event larger than max bytes",
+			maxBytes: 1,
+			want:     [][]string{{"event-0"}, {"event-1"}, {"event-2"}, {"event-3"}, {"event-4"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			server := &eventServer{}
+			server.Server = httptest.NewServer(server)
+			defer server.Close()
+			service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour), event.WithBatchLimits(tt.maxEvents, tt.maxBytes))
+			require.NoError(t, err)
+			defer service.Close(context.Background())
+
+			emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+			defer emitter.Close(context.Background())
+			service.RegisterProducer(emitter)
+			pushEvents(emitter, 5)
+
+			// when
+			err = service.Flush(context.Background())
+
+			// then
+			require.NoError(t, err)
+			var got [][]string
+			for _, events := range server.requests() {
+				got = append(got, ids(events))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestService_FlushRequeuesOnlyUndeliveredChunks(t *testing.T) {
+	// given
+	server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusOK), status(http.StatusInternalServerError)}}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour),
+		event.WithBatchLimits(1, 0),
+		event.WithRetryPolicy(event.RetryPolicy{MaxAttempts: 1}),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	pushEvents(emitter, 2)
+	require.Error(t, service.Flush(context.Background()))
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.NoError(t, err)
+	var got [][]string
+	for _, events := range server.requests() {
+		got = append(got, ids(events))
+	}
+	assert.Equal(t, [][]string{{"event-0"}, {"event-1"}, {"event-1"}}, got)
+}
+
+func TestService_FlushEncodesEvents(t *testing.T) {
+	for _, encoding := range []event.Encoding{event.EncodingJSON, event.EncodingNDJSON} {
+		for _, compression := range []event.Compression{event.CompressionNone, event.CompressionGzip, event.CompressionZstd} {
+			t.Run(fmt.Sprintf("%s %s", encoding, compression), func(t *testing.T) {
+				// given
+				server := &eventServer{}
+				server.Server = httptest.NewServer(server)
+				defer server.Close()
+				service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour), event.WithEncoding(encoding), event.WithCompression(compression))
+				require.NoError(t, err)
+				defer service.Close(context.Background())
+
+				emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+				defer emitter.Close(context.Background())
+				service.RegisterProducer(emitter)
+				pushEvents(emitter, 3)
+
+				// when
+				err = service.Flush(context.Background())
+
+				// then
+				require.NoError(t, err)
+				requests := server.requests()
+				require.Len(t, requests, 1)
+				assert.Equal(t, []string{"event-0", "event-1", "event-2"}, ids(requests[0]))
+			})
+		}
+	}
+}
+
+func TestWithMaxPendingEvents(t *testing.T) {
+	t.Run("rejects negative limits", func(t *testing.T) {
+		// when
+		_, err := event.NewService(context.Background(), "", event.WithMaxPendingEvents(-1))
+
+		// then
+		require.Error(t, err)
+	})
+
+	t.Run("keeps no events with zero limit", func(t *testing.T) {
+		// given
+		server := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+		server.Server = httptest.NewServer(server)
+		defer server.Close()
+		service, err := event.NewService(context.Background(), server.URL, event.WithFlushInterval(time.Hour),
+			event.WithRetryPolicy(event.RetryPolicy{MaxAttempts: 1}),
+			event.WithMaxPendingEvents(0),
+		)
+		require.NoError(t, err)
+		defer service.Close(context.Background())
+
+		emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+		defer emitter.Close(context.Background())
+		service.RegisterProducer(emitter)
+		pushEvents(emitter, 1)
+		require.Error(t, service.Flush(context.Background()))
+
+		// when
+		err = service.Flush(context.Background())
+
+		// then
+		require.NoError(t, err)
+		assert.Len(t, server.requests(), 1)
+	})
+}
@@ -0,0 +1,192 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type (
+	// Sink is a destination for events. Write delivers a single batch without retrying; retries,
+	// batching and buffering are handled by the route the sink is registered with.
+	//
+	// Errors returned by Write are retried unless the sink reports the batch as rejected, e.g. an
+	// HTTP endpoint answering with 400.
+	Sink interface {
+		Name() string
+		Write(ctx context.Context, events []*Event) error
+		Close(ctx context.Context) error
+	}
+
+	// Filter selects the events routed to a sink. Empty fields match every event, all set fields
+	// must match.
+	Filter struct {
+		Types   []EventType
+		Sources []string
+		// IsError restricts the route to error or non-error events if set.
+		IsError *bool
+	}
+
+	// Route sends the events matching Filter to Sink. Every route retries and buffers
+	// independently, so a slow or failing sink does not affect the others.
+	Route struct {
+		Sink   Sink
+		Filter Filter
+
+		// RetryPolicy defaults to DefaultRetryPolicy.
+		RetryPolicy RetryPolicy
+		// MaxPending limits the events kept for the next flush after a failed delivery.
+		// Defaults to 1000.
+		MaxPending int
+		// MaxBatchEvents and MaxBatchBytes limit a single write. Larger flushes are split into
+		// several writes. Default to 500 events and 1 MiB, a negative value disables a limit.
+		MaxBatchEvents int
+		MaxBatchBytes  int
+	}
+
+	// route is the runtime state of a Route. It is only accessed by a single flush at a time.
+	route struct {
+		Route
+		logger logger.Logger
+
+		// pending holds events whose delivery failed. They are written again with the next
+		// flush unless the Service hands them back to their producer.
+		pending     []*Event
+		pausedUntil time.Time
+	}
+)
+
+// Matches reports whether the event passes the filter.
+func (f Filter) Matches(e *Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	if len(f.Sources) > 0 && !slices.Contains(f.Sources, e.Source) {
+		return false
+	}
+	if f.IsError != nil && *f.IsError != e.IsError {
+		return false
+	}
+	return true
+}
+
+// withRouteDefaults fills the unset fields of a route added with WithRoute.
+func withRouteDefaults(r Route) Route {
+	if r.RetryPolicy.MaxAttempts == 0 {
+		r.RetryPolicy = DefaultRetryPolicy
+	}
+	if r.MaxPending == 0 {
+		r.MaxPending = 1000
+	}
+	if r.MaxBatchEvents == 0 {
+		r.MaxBatchEvents = 500
+	}
+	if r.MaxBatchBytes == 0 {
+		r.MaxBatchBytes = 1024 * 1024
+	}
+	return r
+}
+
+func newRoute(r Route, log logger.Logger) *route {
+	return &route{Route: r, logger: log}
+}
+
+// flush writes the pending and the given events to the sink. It returns the events the route is
+// done with because they were written or rejected by the sink. The other events are kept as
+// pending and written again with the next flush.
+func (r *route) flush(ctx context.Context, events []*Event) ([]*Event, error) {
+	batch := append(r.pending, events...)
+	r.pending = nil
+
+	if len(batch) == 0 {
+		return nil, nil
+	}
+
+	if wait := time.Until(r.pausedUntil); wait > 0 {
+		r.logger.Debug("skipping flush due to backpressure", "sink", r.Sink.Name(), "retryAfter", wait)
+		r.pending = batch
+		return nil, nil
+	}
+
+	var firstErr error
+	offset := 0
+	for _, chunk := range chunkEvents(batch, r.MaxBatchEvents, r.MaxBatchBytes) {
+		err := r.deliver(ctx, chunk)
+
+		var backpressureError *BackpressureError
+		var deliveryErr *deliveryError
+		switch {
+		case err == nil:
+		case errors.As(err, &backpressureError):
+			if backpressureError.RetryAfter <= 0 {
+				backpressureError.RetryAfter = r.RetryPolicy.backoff(1)
+			}
+			r.pausedUntil = time.Now().Add(backpressureError.RetryAfter)
+			r.pending = batch[offset:]
+			return batch[:offset:offset], err
+		case errors.As(err, &deliveryErr) && !deliveryErr.retryable:
+			r.logger.Error("sink rejected events, dropping them", "sink", r.Sink.Name(), "count", len(chunk), "error", err)
+			countDropped("sink", chunk...)
+			if firstErr == nil {
+				firstErr = err
+			}
+		default:
+			r.pending = batch[offset:]
+			return batch[:offset:offset], err
+		}
+
+		offset += len(chunk)
+	}
+
+	return batch, firstErr
+}
+
+// deliver writes the batch and retries retryable failures with exponential backoff and jitter.
+func (r *route) deliver(ctx context.Context, batch []*Event) error {
+	for attempt := 1; ; attempt++ {
+		err := r.Sink.Write(ctx, batch)
+		if err == nil {
+			return nil
+		}
+
+		var deliveryErr *deliveryError
+		if IsBackpressureError(err) || (errors.As(err, &deliveryErr) && !deliveryErr.retryable) || attempt >= r.RetryPolicy.MaxAttempts {
+			return err
+		}
+
+		delay := r.RetryPolicy.backoff(attempt)
+		r.logger.Warn("failed to deliver events, retrying", "sink", r.Sink.Name(), "attempt", attempt, "delay", delay, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// release removes the events from the pending events, e.g. because their producer delivers them
+// again.
+func (r *route) release(events map[*Event]struct{}) {
+	r.pending = slices.DeleteFunc(r.pending, func(e *Event) bool {
+		_, ok := events[e]
+		return ok
+	})
+}
+
+// trim drops the oldest pending events exceeding the pending limit and returns them.
+func (r *route) trim() []*Event {
+	overflow := len(r.pending) - max(r.MaxPending, 0)
+	if overflow <= 0 {
+		return nil
+	}
+
+	r.logger.Warn("pending events exceed limit, dropping oldest", "sink", r.Sink.Name(), "dropped", overflow)
+	dropped := r.pending[:overflow]
+	countDropped("sink", dropped...)
+	r.pending = r.pending[overflow:]
+	return dropped
+}
@@ -0,0 +1,145 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type (
+	// FileSink appends events as JSON lines to a file. The file is rotated once it exceeds
+	// MaxBytes, keeping MaxBackups rotated files named <path>.1 (newest) to <path>.<MaxBackups>.
+	FileSink struct {
+		config FileSinkConfig
+
+		mu   sync.Mutex
+		file *os.File
+		size int64
+	}
+
+	FileSinkConfig struct {
+		// Name identifies the sink in logs. Defaults to the path.
+		Name string
+		Path string
+		// MaxBytes defaults to 10 MiB.
+		MaxBytes int64
+		// MaxBackups defaults to 3.
+		MaxBackups int
+	}
+)
+
+var _ Sink = &FileSink{}
+
+func NewFileSink(config FileSinkConfig) (*FileSink, error) {
+	if config.Path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+	if config.Name == "" {
+		config.Name = config.Path
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 10 * 1024 * 1024
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = 3
+	}
+
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	sink := &FileSink{config: config}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Name() string {
+	return s.config.Name
+}
+
+func (s *FileSink) Write(ctx context.Context, events []*Event) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := encoder.Encode(e); err != nil {
+			return &deliveryError{err: err}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("file sink is closed")
+	}
+
+	if s.size > 0 && s.size+int64(buf.Len()) > s.config.MaxBytes {
+		if err := s.rotate(); err != nil {
+			if s.file == nil {
+				_ = s.open()
+			}
+			return fmt.Errorf("failed to rotate file: %w", err)
+		}
+	}
+
+	n, err := s.file.Write(buf.Bytes())
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups by one, moves the current file to <path>.1 and opens a new file.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file = nil
+
+	for i := s.config.MaxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.config.Path, i)
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", s.config.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.config.Path, s.config.Path+".1"); err != nil {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *FileSink) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
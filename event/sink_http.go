@@ -0,0 +1,97 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+)
+
+type (
+	// HTTPSink posts events to an HTTP endpoint. 429 and 503 responses are reported as
+	// backpressure, other 4xx responses except 408 reject the batch.
+	HTTPSink struct {
+		name           string
+		client         *http.Client
+		requestBuilder RequestBuilder
+	}
+
+	HTTPSinkConfig struct {
+		// Name identifies the sink in logs. Defaults to the endpoint.
+		Name     string
+		Endpoint string
+		// Client defaults to the common HTTP client.
+		Client *http.Client
+		// RequestBuilder replaces the default request builder which uses Encoding and
+		// Compression.
+		RequestBuilder RequestBuilder
+		// Encoding defaults to EncodingJSON.
+		Encoding    Encoding
+		Compression Compression
+	}
+)
+
+var _ Sink = &HTTPSink{}
+
+func NewHTTPSink(config HTTPSinkConfig) (*HTTPSink, error) {
+	if config.Endpoint == "" && config.RequestBuilder == nil {
+		return nil, errors.New("endpoint cannot be empty")
+	}
+	if config.Name == "" {
+		config.Name = config.Endpoint
+	}
+	if config.Client == nil {
+		config.Client = commonHttp.NewClient()
+	}
+	if config.Encoding == "" {
+		config.Encoding = EncodingJSON
+	}
+	if config.RequestBuilder == nil {
+		config.RequestBuilder = defaultRequestBuilder(config.Endpoint, config.Encoding, config.Compression)
+	}
+
+	return &HTTPSink{
+		name:           config.Name,
+		client:         config.Client,
+		requestBuilder: config.RequestBuilder,
+	}, nil
+}
+
+// NewOTLPSink returns an HTTPSink that exports events as OTLP log records.
+func NewOTLPSink(name string, config OTLPConfig) (*HTTPSink, error) {
+	builder, err := NewOTLPRequestBuilder(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHTTPSink(HTTPSinkConfig{Name: name, Endpoint: config.Endpoint, RequestBuilder: builder})
+}
+
+func (s *HTTPSink) Name() string {
+	return s.name
+}
+
+func (s *HTTPSink) Write(ctx context.Context, events []*Event) error {
+	req, err := s.requestBuilder(ctx, events)
+	if err != nil {
+		return &deliveryError{err: fmt.Errorf("failed to build request: %w", err)}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &deliveryError{err: fmt.Errorf("failed to send request: %w", err), retryable: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return classifyResponse(resp)
+	}
+
+	return nil
+}
+
+func (s *HTTPSink) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,242 @@
+package event_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readJSONLines(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var result []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e event.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		result = append(result, e.Id)
+	}
+	require.NoError(t, scanner.Err())
+	return result
+}
+
+func TestFilter_Matches(t *testing.T) {
+	isError := true
+	e := &event.Event{Type: "update_failed", Source: "Updater", IsError: true}
+
+	tests := []struct {
+		name   string
+		filter event.Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: event.Filter{}, want: true},
+		{name: "matching type", filter: event.Filter{Types: []event.EventType{"config_refreshed", "update_failed"}}, want: true},
+		{name: "other type", filter: event.Filter{Types: []event.EventType{"config_refreshed"}}, want: false},
+		{name: "matching source", filter: event.Filter{Sources: []string{"Updater"}}, want: true},
+		{name: "other source", filter: event.Filter{Sources: []string{"ConfigService"}}, want: false},
+		{name: "errors only", filter: event.Filter{IsError: &isError}, want: true},
+		{name: "all fields must match", filter: event.Filter{Sources: []string{"Updater"}, Types: []event.EventType{"config_refreshed"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Matches(e))
+		})
+	}
+}
+
+func TestService_FlushRoutesEventsToSinks(t *testing.T) {
+	// given
+	isError := true
+	alerting := &eventServer{}
+	alerting.Server = httptest.NewServer(alerting)
+	defer alerting.Close()
+	lake := &eventServer{}
+	lake.Server = httptest.NewServer(lake)
+	defer lake.Close()
+	debugFile := filepath.Join(t.TempDir(), "debug.jsonl")
+
+	fileSink, err := event.NewFileSink(event.FileSinkConfig{Path: debugFile})
+	require.NoError(t, err)
+
+	alertingSink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: alerting.URL})
+	require.NoError(t, err)
+	lakeSink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: lake.URL})
+	require.NoError(t, err)
+
+	service, err := event.NewService(context.Background(), "", event.WithFlushInterval(time.Hour),
+		event.WithRoute(event.Route{Sink: alertingSink, Filter: event.Filter{IsError: &isError}}),
+		event.WithRoute(event.Route{Sink: lakeSink}),
+		event.WithRoute(event.Route{Sink: fileSink, Filter: event.Filter{Types: []event.EventType{"debug"}}}),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	emitter.Push(&event.Event{Id: "info", Type: "config_refreshed"})
+	emitter.Push(&event.Event{Id: "error", Type: "update_failed", IsError: true})
+	emitter.Push(&event.Event{Id: "debug", Type: "debug"})
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.NoError(t, err)
+	require.Len(t, alerting.requests(), 1)
+	assert.Equal(t, []string{"error"}, ids(alerting.requests()[0]))
+	require.Len(t, lake.requests(), 1)
+	assert.Equal(t, []string{"info", "error", "debug"}, ids(lake.requests()[0]))
+	assert.Equal(t, []string{"debug"}, readJSONLines(t, debugFile))
+}
+
+func TestService_FlushRetriesSinksIndependently(t *testing.T) {
+	// given
+	failing := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+	failing.Server = httptest.NewServer(failing)
+	defer failing.Close()
+	healthy := &eventServer{}
+	healthy.Server = httptest.NewServer(healthy)
+	defer healthy.Close()
+
+	failingSink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: failing.URL})
+	require.NoError(t, err)
+	healthySink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: healthy.URL})
+	require.NoError(t, err)
+
+	service, err := event.NewService(context.Background(), "", event.WithFlushInterval(time.Hour),
+		event.WithRoute(event.Route{Sink: failingSink, RetryPolicy: event.RetryPolicy{MaxAttempts: 1}}),
+		event.WithRoute(event.Route{Sink: healthySink}),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	pushEvents(emitter, 1)
+	require.Error(t, service.Flush(context.Background()))
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.NoError(t, err)
+	assert.Len(t, failing.requests(), 2, "expected failing sink to retry its pending events")
+	assert.Len(t, healthy.requests(), 1, "expected healthy sink not to receive events again")
+}
+
+func TestService_FlushAcknowledgesEventsOnceAllSinksSucceed(t *testing.T) {
+	// given
+	failing := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+	failing.Server = httptest.NewServer(failing)
+	defer failing.Close()
+	healthy := &eventServer{}
+	healthy.Server = httptest.NewServer(healthy)
+	defer healthy.Close()
+
+	failingSink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: failing.URL})
+	require.NoError(t, err)
+	healthySink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: healthy.URL})
+	require.NoError(t, err)
+
+	service, err := event.NewService(context.Background(), "", event.WithFlushInterval(time.Hour),
+		event.WithRoute(event.Route{Sink: failingSink, RetryPolicy: event.RetryPolicy{MaxAttempts: 1}}),
+		event.WithRoute(event.Route{Sink: healthySink}),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	pushEvents(emitter, 1)
+	require.Error(t, service.Flush(context.Background()))
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.NoError(t, err)
+	assert.Len(t, failing.requests(), 2)
+	assert.Len(t, healthy.requests(), 1, "expected healthy sink not to receive the event again")
+	assert.Empty(t, emitter.PollEvents())
+}
+
+func TestService_FlushHandsUndeliveredEventsBackToAckProducer(t *testing.T) {
+	// given
+	failing := &eventServer{responses: []func(w http.ResponseWriter){status(http.StatusInternalServerError)}}
+	failing.Server = httptest.NewServer(failing)
+	defer failing.Close()
+	sink, err := event.NewHTTPSink(event.HTTPSinkConfig{Endpoint: failing.URL})
+	require.NoError(t, err)
+
+	service, err := event.NewService(context.Background(), "", event.WithFlushInterval(time.Hour),
+		event.WithRoute(event.Route{Sink: sink, RetryPolicy: event.RetryPolicy{MaxAttempts: 1}}),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	emitter, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer emitter.Close(context.Background())
+	service.RegisterProducer(emitter)
+	pushEvents(emitter, 1)
+
+	// when
+	err = service.Flush(context.Background())
+
+	// then
+	require.Error(t, err)
+	assert.Equal(t, []string{"message 0"}, messages(emitter.PollEvents()))
+}
+
+func TestFileSink_RotatesFiles(t *testing.T) {
+	// given
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := event.NewFileSink(event.FileSinkConfig{Path: path, MaxBytes: 300, MaxBackups: 2})
+	require.NoError(t, err)
+	defer sink.Close(context.Background())
+
+	// when
+	for _, id := range []string{"1", "2", "3", "4", "5", "6"} {
+		require.NoError(t, sink.Write(context.Background(), []*event.Event{{Id: id}}))
+	}
+
+	// then
+	assert.Equal(t, []string{"5", "6"}, readJSONLines(t, path))
+	assert.Equal(t, []string{"3", "4"}, readJSONLines(t, path+".1"))
+	assert.Equal(t, []string{"1", "2"}, readJSONLines(t, path+".2"))
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestWriterSink_WritesJSONLines(t *testing.T) {
+	// given
+	var buf bytes.Buffer
+	sink := event.NewWriterSink("buffer", &buf)
+
+	// when
+	err := sink.Write(context.Background(), []*event.Event{{Id: "1"}, {Id: "2"}})
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte("\n")))
+}
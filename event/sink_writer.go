@@ -0,0 +1,48 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// WriterSink writes events as JSON lines to an io.Writer.
+type WriterSink struct {
+	name string
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+var _ Sink = &WriterSink{}
+
+func NewWriterSink(name string, writer io.Writer) *WriterSink {
+	return &WriterSink{name: name, encoder: json.NewEncoder(writer)}
+}
+
+// NewStdoutSink returns a WriterSink that writes to the standard output.
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink("stdout", os.Stdout)
+}
+
+func (s *WriterSink) Name() string {
+	return s.name
+}
+
+func (s *WriterSink) Write(ctx context.Context, events []*Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range events {
+		if err := s.encoder.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *WriterSink) Close(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,239 @@
+package event
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// ThrottledEmitter applies per EventType rate limits, sampling and deduplication before
+	// pushing events to the wrapped Emitter, so that a flood of a single type cannot crowd out
+	// other events.
+	ThrottledEmitter struct {
+		next   Emitter
+		config ThrottledEmitterConfig
+
+		mu      sync.Mutex
+		buckets map[EventType]*tokenBucket
+		windows map[dedupeKey]*dedupeWindow
+	}
+
+	ThrottledEmitterConfig struct {
+		// Policies configures the throttling per event type.
+		Policies map[EventType]ThrottlePolicy
+		// DefaultPolicy is used for event types without a policy.
+		DefaultPolicy ThrottlePolicy
+		// Critical event types are never rate limited or sampled. Deduplication still applies as
+		// it keeps every occurrence accounted for.
+		Critical []EventType
+		// DropCallback is called for events that were rate limited or sampled away.
+		DropCallback func(event *Event)
+	}
+
+	ThrottlePolicy struct {
+		// RateLimit is the sustained number of events per second. Zero disables rate limiting.
+		RateLimit float64
+		// Burst is the number of events allowed at once. Defaults to the rate limit rounded up.
+		Burst int
+		// SampleRate is the fraction of events kept, between 0 and 1. Zero disables sampling.
+		SampleRate float64
+		// DedupeWindow collapses identical error events within the window into the first
+		// occurrence and a summary event carrying the number of repetitions. Zero disables
+		// deduplication.
+		DedupeWindow time.Duration
+	}
+
+	// ackThrottledEmitter is returned for wrapped emitters supporting acknowledgements.
+	ackThrottledEmitter struct {
+		*ThrottledEmitter
+		next AckProducer
+	}
+
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	dedupeKey struct {
+		eventType EventType
+		source    string
+		message   string
+	}
+
+	dedupeWindow struct {
+		until       time.Time
+		last        *Event
+		repetitions int
+	}
+)
+
+// RepetitionsDataKey is the data field of a deduplication summary event holding the number of
+// collapsed occurrences.
+const RepetitionsDataKey = "repetitions"
+
+var _ AckProducer = &ackThrottledEmitter{}
+
+// NewThrottledEmitter wraps next with the configured policies. If next supports
+// acknowledgements, so does the returned Emitter.
+func NewThrottledEmitter(next Emitter, config ThrottledEmitterConfig) Emitter {
+	e := &ThrottledEmitter{
+		next:    next,
+		config:  config,
+		buckets: make(map[EventType]*tokenBucket),
+		windows: make(map[dedupeKey]*dedupeWindow),
+	}
+
+	if ap, ok := next.(AckProducer); ok {
+		return &ackThrottledEmitter{ThrottledEmitter: e, next: ap}
+	}
+	return e
+}
+
+// Push forwards the event to the wrapped emitter unless it is suppressed by the policy of its
+// type.
+func (e *ThrottledEmitter) Push(event *Event) {
+	admitted, summary, dropped := e.admit(event, time.Now())
+	if dropped {
+		e.drop(event)
+	}
+	if summary != nil {
+		e.next.Push(summary)
+	}
+	if admitted {
+		e.next.Push(event)
+	}
+}
+
+// admit applies the policy of the event type. It returns the summary of an expired
+// deduplication window replaced by the event, if any, and whether the event was dropped by
+// sampling or rate limiting. Dropped events are passed to the drop callback by the caller once
+// the lock is released.
+func (e *ThrottledEmitter) admit(event *Event, now time.Time) (admitted bool, summary *Event, dropped bool) {
+	policy, ok := e.config.Policies[event.Type]
+	if !ok {
+		policy = e.config.DefaultPolicy
+	}
+	critical := slices.Contains(e.config.Critical, event.Type)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if policy.DedupeWindow > 0 && event.IsError {
+		key := dedupeKey{eventType: event.Type, source: event.Source, message: event.Message}
+		if window, ok := e.windows[key]; ok {
+			if now.Before(window.until) {
+				window.last = event
+				window.repetitions++
+				return false, nil, false
+			}
+			if window.repetitions > 0 {
+				summary = newRepetitionSummary(window)
+			}
+		}
+		e.windows[key] = &dedupeWindow{until: now.Add(policy.DedupeWindow)}
+	}
+
+	if critical {
+		return true, summary, false
+	}
+
+	if policy.SampleRate > 0 && policy.SampleRate < 1 && rand.Float64() >= policy.SampleRate {
+		return false, summary, true
+	}
+
+	if policy.RateLimit > 0 && !e.take(event.Type, policy, now) {
+		return false, summary, true
+	}
+
+	return true, summary, false
+}
+
+// take removes a token from the bucket of the event type and reports whether one was available.
+func (e *ThrottledEmitter) take(eventType EventType, policy ThrottlePolicy, now time.Time) bool {
+	burst := float64(policy.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(policy.RateLimit)
+	}
+
+	bucket, ok := e.buckets[eventType]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		e.buckets[eventType] = bucket
+	}
+
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*policy.RateLimit)
+	bucket.last = now
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+func (e *ThrottledEmitter) drop(event *Event) {
+	countDropped("throttle", event)
+	if e.config.DropCallback != nil {
+		e.config.DropCallback(event)
+	}
+}
+
+// flushWindows pushes a summary event for every expired deduplication window, or for all
+// windows if force is set.
+func (e *ThrottledEmitter) flushWindows(now time.Time, force bool) {
+	e.mu.Lock()
+	var summaries []*Event
+	for key, window := range e.windows {
+		if !force && now.Before(window.until) {
+			continue
+		}
+		delete(e.windows, key)
+
+		if window.repetitions > 0 {
+			summaries = append(summaries, newRepetitionSummary(window))
+		}
+	}
+	e.mu.Unlock()
+
+	for _, summary := range summaries {
+		e.next.Push(summary)
+	}
+}
+
+func newRepetitionSummary(window *dedupeWindow) *Event {
+	summary := *window.last
+	summary.Id = uuid.New().String()
+	summary.Data = make(map[string]interface{}, len(window.last.Data)+1)
+	for k, v := range window.last.Data {
+		summary.Data[k] = v
+	}
+	summary.Data[RepetitionsDataKey] = window.repetitions
+	return &summary
+}
+
+// PollEvents pushes the summaries of expired deduplication windows and polls the wrapped
+// emitter.
+func (e *ThrottledEmitter) PollEvents() []*Event {
+	e.flushWindows(time.Now(), false)
+	return e.next.PollEvents()
+}
+
+// Close pushes the summaries of all open deduplication windows and closes the wrapped emitter.
+func (e *ThrottledEmitter) Close(ctx context.Context) error {
+	e.flushWindows(time.Now(), true)
+	return e.next.Close(ctx)
+}
+
+func (e *ackThrottledEmitter) Ack(events []*Event) error {
+	return e.next.Ack(events)
+}
+
+func (e *ackThrottledEmitter) Nack(events []*Event) {
+	e.next.Nack(events)
+}
@@ -0,0 +1,149 @@
+package event_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottledEmitter(t *testing.T) {
+	t.Run("rate limits per type", func(t *testing.T) {
+		// given
+		var dropped int
+		emitter := event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+			Policies: map[event.EventType]event.ThrottlePolicy{
+				"update_check_failed": {RateLimit: 1, Burst: 2},
+			},
+			DropCallback: func(*event.Event) { dropped++ },
+		})
+		defer emitter.Close(context.Background())
+
+		// when
+		for i := 0; i < 5; i++ {
+			emitter.Push(&event.Event{Type: "update_check_failed"})
+			emitter.Push(&event.Event{Type: "config_refreshed"})
+		}
+
+		// then
+		var limited, other int
+		for _, e := range emitter.PollEvents() {
+			if e.Type == "update_check_failed" {
+				limited++
+			} else {
+				other++
+			}
+		}
+		assert.Equal(t, 2, limited)
+		assert.Equal(t, 5, other)
+		assert.Equal(t, 3, dropped)
+	})
+
+	t.Run("samples events", func(t *testing.T) {
+		// given
+		emitter := event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+			DefaultPolicy: event.ThrottlePolicy{SampleRate: 0.5},
+		})
+		defer emitter.Close(context.Background())
+
+		// when
+		for i := 0; i < 1000; i++ {
+			emitter.Push(&event.Event{Type: "heartbeat"})
+		}
+
+		// then
+		kept := len(emitter.PollEvents())
+		assert.Greater(t, kept, 350)
+		assert.Less(t, kept, 650)
+	})
+
+	t.Run("never suppresses critical types", func(t *testing.T) {
+		// given
+		emitter := event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+			DefaultPolicy: event.ThrottlePolicy{SampleRate: 0.01, RateLimit: 1},
+			Critical:      []event.EventType{"update_failed"},
+		})
+		defer emitter.Close(context.Background())
+
+		// when
+		for i := 0; i < 100; i++ {
+			emitter.Push(&event.Event{Type: "update_failed", IsError: true})
+		}
+
+		// then
+		assert.Len(t, emitter.PollEvents(), 100)
+	})
+
+	t.Run("collapses duplicate errors", func(t *testing.T) {
+		// given
+		emitter := event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+			DefaultPolicy: event.ThrottlePolicy{DedupeWindow: 50 * time.Millisecond},
+		})
+		defer emitter.Close(context.Background())
+
+		// when
+		for i := 0; i < 4; i++ {
+			emitter.Push(&event.Event{Id: "failure", Type: "refresh_failed", Message: "timeout", IsError: true})
+		}
+		emitter.Push(&event.Event{Type: "refresh_failed", Message: "refused", IsError: true})
+		emitter.Push(&event.Event{Type: "refresh_failed", Message: "timeout"})
+
+		// then
+		require.Len(t, emitter.PollEvents(), 3, "expected duplicates to be suppressed within the window")
+
+		var events []*event.Event
+		require.Eventually(t, func() bool {
+			events = append(events, emitter.PollEvents()...)
+			return len(events) > 0
+		}, time.Second, 5*time.Millisecond)
+		require.Len(t, events, 1)
+		assert.Equal(t, "timeout", events[0].Message)
+		assert.NotEqual(t, "failure", events[0].Id)
+		assert.Equal(t, 3, events[0].Data[event.RepetitionsDataKey])
+	})
+
+	t.Run("drop callback may push", func(t *testing.T) {
+		// given
+		var emitter event.Emitter
+		emitter = event.NewThrottledEmitter(event.NewBufferedEmitter(event.BufferedEmitterConfig{}), event.ThrottledEmitterConfig{
+			Policies: map[event.EventType]event.ThrottlePolicy{
+				"heartbeat": {RateLimit: 1, Burst: 1},
+			},
+			DropCallback: func(*event.Event) { emitter.Push(&event.Event{Type: "heartbeat_dropped"}) },
+		})
+		defer emitter.Close(context.Background())
+
+		// when
+		emitter.Push(&event.Event{Type: "heartbeat"})
+		emitter.Push(&event.Event{Type: "heartbeat"})
+
+		// then
+		events := emitter.PollEvents()
+		require.Len(t, events, 2)
+		assert.Equal(t, event.EventType("heartbeat_dropped"), events[1].Type)
+	})
+
+	t.Run("supports acknowledgements", func(t *testing.T) {
+		// given
+		disk, err := event.NewDiskEmitter(event.DiskEmitterConfig{Dir: t.TempDir()})
+		require.NoError(t, err)
+		emitter := event.NewThrottledEmitter(disk, event.ThrottledEmitterConfig{})
+		defer emitter.Close(context.Background())
+
+		ackProducer, ok := emitter.(event.AckProducer)
+		require.True(t, ok)
+		emitter.Push(&event.Event{Id: "event-0"})
+
+		// when
+		require.NoError(t, ackProducer.Ack(emitter.PollEvents()))
+
+		// then
+		assert.Empty(t, emitter.PollEvents())
+		_, ok = event.NewThrottledEmitter(event.NoopEmitter{}, event.ThrottledEmitterConfig{}).(event.AckProducer)
+		assert.False(t, ok)
+	})
+}
@@ -30,9 +30,31 @@ func main() {
 		logger.Fatalf("failed to create config repository: %v", err)
 	}
 
+	var authConfig internal.AuthConfig
+	if err := envconfig.Process("", &authConfig); err != nil {
+		logger.Fatalf("failed to process auth config: %v", err)
+	}
+
+	var enrollmentConfig internal.EnrollmentConfig
+	if err := envconfig.Process("", &enrollmentConfig); err != nil {
+		logger.Fatalf("failed to process enrollment config: %v", err)
+	}
+
+	deviceRepository, err := database.NewDeviceRepository(ctx, databaseClient.Database())
+	if err != nil {
+		logger.Fatalf("failed to create device repository: %v", err)
+	}
+
+	authenticator := internal.NewDeviceAuthenticator(&authConfig)
+	enrollmentService, err := internal.NewEnrollmentService(ctx, &enrollmentConfig, authenticator, deviceRepository)
+	if err != nil {
+		logger.Fatalf("failed to create enrollment service: %v", err)
+	}
+
 	configService := internal.NewConfigService(configRepository)
+	eventService := internal.NewEventService(0)
 
-	if err := http.StartServer(configService); err != nil {
+	if err := http.StartServer(configService, eventService, enrollmentService, authenticator, &authConfig); err != nil {
 		logger.Fatalf("failed to start HTTP server: %v", err)
 	}
 }
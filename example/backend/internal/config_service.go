@@ -2,6 +2,10 @@ package internal
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
@@ -14,14 +18,18 @@ type (
 
 	ConfigRepository interface {
 		Create(ctx context.Context, config *Config) error
+		GetById(ctx context.Context, id string) (*Config, error)
 		GetByVersion(ctx context.Context, version string) (*Config, error)
 		GetLatest(ctx context.Context) (*Config, error)
+		List(ctx context.Context) ([]*Config, error)
 	}
 
 	Config struct {
 		Id         string                 `json:"id"`
 		Version    string                 `json:"version"`
 		Properties map[string]interface{} `json:"properties"`
+		Targets    []Target               `json:"targets,omitempty"`
+		Priority   int                    `json:"priority,omitempty"`
 
 		CreatedAt time.Time `json:"createdAt"`
 		UpdatedAt time.Time `json:"updatedAt"`
@@ -34,22 +42,45 @@ func NewConfigService(repository ConfigRepository) *ConfigService {
 	}
 }
 
+// CreateConfig stores a new config. Targeted configs may share a version, so configs are
+// identified by their id, which is generated if not set.
 func (s *ConfigService) CreateConfig(ctx context.Context, config *Config) error {
 	if config.Version == "" {
 		return errors.New("config version cannot be empty")
 	}
 
-	existingConfig, err := s.repository.GetByVersion(ctx, config.Version)
-	if err != nil {
+	if config.Id == "" {
+		id, err := newConfigId()
+		if err != nil {
+			return fmt.Errorf("failed to generate config id: %w", err)
+		}
+		config.Id = id
+	}
+
+	existingConfig, err := s.repository.GetById(ctx, config.Id)
+	if err != nil && !IsNotFoundError(err) {
 		return fmt.Errorf("failed to check existing config: %w", err)
 	}
 	if existingConfig != nil {
-		return fmt.Errorf("config with version '%s' already exists", config.Version)
+		return NewConflictError(fmt.Errorf("config with id '%s' already exists", config.Id))
 	}
 
 	return s.repository.Create(ctx, config)
 }
 
+func (s *ConfigService) GetConfigById(ctx context.Context, id string) (*Config, error) {
+	if id == "" {
+		return nil, errors.New("id cannot be empty")
+	}
+
+	config, err := s.repository.GetById(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	return config, nil
+}
+
 func (s *ConfigService) GetConfigByVersion(ctx context.Context, version string) (*Config, error) {
 	if version == "" {
 		return nil, errors.New("version cannot be empty")
@@ -71,3 +102,89 @@ func (s *ConfigService) GetLatestConfig(ctx context.Context) (*Config, error) {
 
 	return config, nil
 }
+
+// GetConfigForDevice returns the config that should be served to the described device. Among
+// all matching configs the one with the highest priority wins, then the most specific target.
+func (s *ConfigService) GetConfigForDevice(ctx context.Context, descriptor *DeviceDescriptor) (*Config, error) {
+	configs, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configs: %w", err)
+	}
+
+	var selected *Config
+	for _, config := range configs {
+		if !config.Matches(descriptor) {
+			continue
+		}
+
+		if selected == nil || isPreferred(config, selected, descriptor) {
+			selected = config
+		}
+	}
+
+	if selected == nil {
+		return nil, NewNotFoundError(fmt.Errorf("no config matches device %s", descriptor.DeviceId))
+	}
+
+	return selected, nil
+}
+
+// FindConfig returns the config of the version whose properties have the given hash, i.e. the
+// config a device reports as its current one. The hash is optional if only one config has the
+// version.
+func (s *ConfigService) FindConfig(ctx context.Context, version, hash string) (*Config, error) {
+	configs, err := s.repository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configs: %w", err)
+	}
+
+	var found []*Config
+	for _, config := range configs {
+		if config.Version != version {
+			continue
+		}
+		if hash != "" {
+			if configHash, err := config.Hash(); err != nil || configHash != hash {
+				continue
+			}
+		}
+		found = append(found, config)
+	}
+
+	if len(found) != 1 {
+		return nil, NewNotFoundError(fmt.Errorf("no unique config of version %s found", version))
+	}
+	return found[0], nil
+}
+
+// Hash returns the manifest hash of the properties as served to devices.
+func (c *Config) Hash() (string, error) {
+	properties, err := json.Marshal(c.Properties)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(properties)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func newConfigId() (string, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+func isPreferred(candidate, selected *Config, descriptor *DeviceDescriptor) bool {
+	if candidate.Priority != selected.Priority {
+		return candidate.Priority > selected.Priority
+	}
+
+	candidateSpecificity, selectedSpecificity := candidate.specificity(descriptor), selected.specificity(descriptor)
+	if candidateSpecificity != selectedSpecificity {
+		return candidateSpecificity > selectedSpecificity
+	}
+
+	return compareVersions(candidate.Version, selected.Version) > 0
+}
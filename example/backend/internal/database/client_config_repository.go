@@ -19,7 +19,8 @@ type ConfigRepository struct {
 }
 
 func NewConfigRepository(ctx context.Context, database *mongo.Database) (*ConfigRepository, error) {
-	if err := createIndex(ctx, database.Collection(configCollection), bson.D{{Key: "version", Value: 1}}, options.Index().SetUnique(true)); err != nil {
+	// Targeted configs may share a version, so only the id is unique.
+	if err := createIndex(ctx, database.Collection(configCollection), bson.D{{Key: "id", Value: 1}}, options.Index().SetUnique(true)); err != nil {
 		return nil, fmt.Errorf("failed to create index: %w", err)
 	}
 
@@ -36,13 +37,17 @@ func (r *ConfigRepository) Create(ctx context.Context, config *internal.Config)
 	_, err := r.collection.InsertOne(ctx, config)
 	if err != nil {
 		if mongo.IsDuplicateKeyError(err) {
-			return internal.NewConflictError(fmt.Errorf("config with version %s already exists", config.Version))
+			return internal.NewConflictError(fmt.Errorf("config with id %s already exists", config.Id))
 		}
 		return err
 	}
 	return nil
 }
 
+func (r *ConfigRepository) GetById(ctx context.Context, id string) (*internal.Config, error) {
+	return r.findOne(ctx, bson.M{"id": id})
+}
+
 func (r *ConfigRepository) GetByVersion(ctx context.Context, version string) (*internal.Config, error) {
 	filter := bson.M{"version": version}
 	return r.findOne(ctx, filter)
@@ -53,6 +58,20 @@ func (r *ConfigRepository) GetLatest(ctx context.Context) (*internal.Config, err
 	return r.findOne(ctx, bson.M{}, opts)
 }
 
+func (r *ConfigRepository) List(ctx context.Context) ([]*internal.Config, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var configs []*internal.Config
+	if err := cursor.All(ctx, &configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
+}
+
 func (r *ConfigRepository) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*internal.Config, error) {
 	var config internal.Config
 	err := r.collection.FindOne(ctx, filter, opts...).Decode(&config)
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const deviceCollection = "devices"
+
+type DeviceRepository struct {
+	collection *mongo.Collection
+}
+
+var _ internal.DeviceRepository = &DeviceRepository{}
+
+func NewDeviceRepository(ctx context.Context, database *mongo.Database) (*DeviceRepository, error) {
+	if err := createIndex(ctx, database.Collection(deviceCollection), bson.D{{Key: "id", Value: 1}}, options.Index().SetUnique(true)); err != nil {
+		return nil, fmt.Errorf("failed to create index: %w", err)
+	}
+
+	return &DeviceRepository{
+		collection: database.Collection(deviceCollection),
+	}, nil
+}
+
+// Save stores the device, replacing the previous credentials of a known device.
+func (r *DeviceRepository) Save(ctx context.Context, device *internal.Device) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"id": device.Id}, device, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (r *DeviceRepository) List(ctx context.Context) ([]*internal.Device, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var devices []*internal.Device
+	if err := cursor.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
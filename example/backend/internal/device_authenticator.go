@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	AuthConfig struct {
+		// DeviceSecrets maps device ids to their HMAC secrets, e.g. "device-1:secret,device-2:secret".
+		DeviceSecrets map[string]string `envconfig:"DEVICE_SECRETS"`
+		// RequireSignature requires signed requests even if no device secrets are configured,
+		// e.g. because all devices obtain their secret through enrollment.
+		RequireSignature bool          `envconfig:"AUTH_REQUIRE_SIGNATURE"`
+		MaxClockSkew     time.Duration `envconfig:"AUTH_MAX_CLOCK_SKEW" default:"5m"`
+		TLSAddr          string        `envconfig:"TLS_ADDR" default:":8443"`
+		TLSCertFile      string        `envconfig:"TLS_CERT_FILE"`
+		TLSKeyFile       string        `envconfig:"TLS_KEY_FILE"`
+		// ClientCAFile enables mutual TLS. Client certificates must be issued by one of its CAs
+		// and carry the device id as common name.
+		ClientCAFile string `envconfig:"TLS_CLIENT_CA_FILE"`
+	}
+
+	// DeviceAuthenticator verifies that requests were sent by a known device. Requests are
+	// authenticated by their HMAC signature, by a client certificate or both.
+	DeviceAuthenticator struct {
+		requireSignature bool
+		maxSkew          time.Duration
+		now              func() time.Time
+
+		secretsMu sync.RWMutex
+		secrets   map[string]deviceSecret
+
+		mu        sync.Mutex
+		nonces    map[string]time.Time
+		lastPrune time.Time
+	}
+
+	deviceSecret struct {
+		secret []byte
+		// expiresAt is zero for configured secrets, which do not expire.
+		expiresAt time.Time
+	}
+)
+
+const (
+	DeviceIdHeader    = "x-device-id"
+	TimestampHeader   = "x-auth-timestamp"
+	NonceHeader       = "x-auth-nonce"
+	ContentHashHeader = "x-content-sha256"
+	SignatureHeader   = "x-auth-signature"
+)
+
+func NewDeviceAuthenticator(config *AuthConfig) *DeviceAuthenticator {
+	secrets := make(map[string]deviceSecret, len(config.DeviceSecrets))
+	for deviceId, secret := range config.DeviceSecrets {
+		secrets[deviceId] = deviceSecret{secret: []byte(secret)}
+	}
+
+	maxSkew := config.MaxClockSkew
+	if maxSkew <= 0 {
+		maxSkew = 5 * time.Minute
+	}
+
+	return &DeviceAuthenticator{
+		requireSignature: config.RequireSignature || len(secrets) > 0,
+		secrets:          secrets,
+		maxSkew:          maxSkew,
+		now:              time.Now,
+		nonces:           make(map[string]time.Time),
+	}
+}
+
+// RequiresSignature reports whether requests must be signed with HMAC.
+func (a *DeviceAuthenticator) RequiresSignature() bool {
+	return a.requireSignature
+}
+
+// RegisterDevice sets the secret of the device, replacing a previous one. Requests signed with
+// the secret are rejected once it expired, a zero expiresAt never expires.
+func (a *DeviceAuthenticator) RegisterDevice(deviceId string, secret []byte, expiresAt time.Time) {
+	a.secretsMu.Lock()
+	defer a.secretsMu.Unlock()
+	a.secrets[deviceId] = deviceSecret{secret: secret, expiresAt: expiresAt}
+}
+
+// Secret returns the secret of the device, if it is known. Expired secrets are returned as
+// well, so that devices that were offline past the expiry can still renew their credentials.
+func (a *DeviceAuthenticator) Secret(deviceId string) ([]byte, bool) {
+	a.secretsMu.RLock()
+	defer a.secretsMu.RUnlock()
+
+	secret, ok := a.secrets[deviceId]
+	return secret.secret, ok
+}
+
+// Verify authenticates the request and returns the id of the device that sent it. The client
+// certificates are those verified by the TLS handshake, if any.
+func (a *DeviceAuthenticator) Verify(r *http.Request, body []byte, certificates []*x509.Certificate) (string, error) {
+	deviceId := r.Header.Get(DeviceIdHeader)
+
+	if len(certificates) > 0 {
+		certificateDevice := certificates[0].Subject.CommonName
+		if deviceId != "" && deviceId != certificateDevice {
+			return "", NewUnauthorizedError(fmt.Errorf("device %s does not match client certificate", deviceId))
+		}
+		deviceId = certificateDevice
+	}
+
+	if a.RequiresSignature() {
+		if err := a.verifySignature(r, deviceId, body); err != nil {
+			return "", NewUnauthorizedError(err)
+		}
+	}
+
+	if deviceId == "" {
+		return "", NewUnauthorizedError(errors.New("device id is missing"))
+	}
+	return deviceId, nil
+}
+
+func (a *DeviceAuthenticator) verifySignature(r *http.Request, deviceId string, body []byte) error {
+	a.secretsMu.RLock()
+	secret, ok := a.secrets[deviceId]
+	a.secretsMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown device %q", deviceId)
+	}
+
+	now := a.now()
+	if !secret.expiresAt.IsZero() && !now.Before(secret.expiresAt) {
+		return fmt.Errorf("credentials of device %q expired at %s", deviceId, secret.expiresAt)
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(timestamp, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return errors.New("signature timestamp is outside of the allowed clock skew")
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if !hmac.Equal([]byte(r.Header.Get(ContentHashHeader)), []byte(hex.EncodeToString(bodyHash[:]))) {
+		return errors.New("content hash does not match body")
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		deviceId,
+		r.Header.Get(TimestampHeader),
+		r.Header.Get(NonceHeader),
+		r.Header.Get(ContentHashHeader),
+	}, "\n")
+	mac := hmac.New(sha256.New, secret.secret)
+	mac.Write([]byte(canonical))
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+
+	// The nonce is only remembered for valid signatures, so that unauthenticated requests
+	// cannot fill the cache.
+	return a.useNonce(deviceId, r.Header.Get(NonceHeader), now)
+}
+
+// useNonce rejects nonces seen before. Nonces are remembered as long as their timestamps are
+// accepted, older requests are rejected by the clock skew check.
+func (a *DeviceAuthenticator) useNonce(deviceId, nonce string, now time.Time) error {
+	if nonce == "" {
+		return errors.New("nonce is missing")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.lastPrune) > a.maxSkew {
+		for key, expiry := range a.nonces {
+			if now.After(expiry) {
+				delete(a.nonces, key)
+			}
+		}
+		a.lastPrune = now
+	}
+
+	key := deviceId + "/" + nonce
+	if expiry, ok := a.nonces[key]; ok && now.Before(expiry) {
+		return errors.New("request has been replayed")
+	}
+	a.nonces[key] = now.Add(2 * a.maxSkew)
+	return nil
+}
@@ -0,0 +1,155 @@
+package internal_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+)
+
+// signedRequest creates a request signed like the client HMACTransport does.
+func signedRequest(deviceId string, secret []byte, timestamp time.Time, nonce string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/events", nil)
+	bodyHash := sha256.Sum256(nil)
+
+	r.Header.Set(internal.DeviceIdHeader, deviceId)
+	r.Header.Set(internal.TimestampHeader, strconv.FormatInt(timestamp.Unix(), 10))
+	r.Header.Set(internal.NonceHeader, nonce)
+	r.Header.Set(internal.ContentHashHeader, hex.EncodeToString(bodyHash[:]))
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.RequestURI(),
+		deviceId,
+		r.Header.Get(internal.TimestampHeader),
+		nonce,
+		r.Header.Get(internal.ContentHashHeader),
+	}, "\n")
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(canonical))
+	r.Header.Set(internal.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestDeviceAuthenticator_Verify(t *testing.T) {
+	secret := []byte("secret")
+
+	t.Run("accepts signed request", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{DeviceSecrets: map[string]string{"device-1": string(secret)}})
+
+		// when
+		deviceId, err := authenticator.Verify(signedRequest("device-1", secret, time.Now(), "nonce-1"), nil, nil)
+
+		// then
+		if err != nil {
+			t.Fatalf("expected request to be accepted, got %v", err)
+		}
+		if deviceId != "device-1" {
+			t.Errorf("expected device-1, got %s", deviceId)
+		}
+	})
+
+	t.Run("rejects replayed request", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{DeviceSecrets: map[string]string{"device-1": string(secret)}})
+		timestamp := time.Now()
+		if _, err := authenticator.Verify(signedRequest("device-1", secret, timestamp, "nonce-1"), nil, nil); err != nil {
+			t.Fatalf("expected first request to be accepted, got %v", err)
+		}
+
+		// when
+		_, err := authenticator.Verify(signedRequest("device-1", secret, timestamp, "nonce-1"), nil, nil)
+
+		// then
+		if !internal.IsUnauthorizedError(err) || !strings.Contains(err.Error(), "replayed") {
+			t.Errorf("expected replayed request to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("rejects timestamp outside of clock skew", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{
+			DeviceSecrets: map[string]string{"device-1": string(secret)},
+			MaxClockSkew:  time.Minute,
+		})
+
+		// when
+		_, pastErr := authenticator.Verify(signedRequest("device-1", secret, time.Now().Add(-2*time.Minute), "nonce-1"), nil, nil)
+		_, futureErr := authenticator.Verify(signedRequest("device-1", secret, time.Now().Add(2*time.Minute), "nonce-2"), nil, nil)
+
+		// then
+		for _, err := range []error{pastErr, futureErr} {
+			if !internal.IsUnauthorizedError(err) || !strings.Contains(err.Error(), "clock skew") {
+				t.Errorf("expected request to be rejected for its timestamp, got %v", err)
+			}
+		}
+	})
+
+	t.Run("rejects unknown device", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{DeviceSecrets: map[string]string{"device-1": string(secret)}})
+
+		// when
+		_, err := authenticator.Verify(signedRequest("device-2", secret, time.Now(), "nonce-1"), nil, nil)
+
+		// then
+		if !internal.IsUnauthorizedError(err) || !strings.Contains(err.Error(), "unknown device") {
+			t.Errorf("expected unknown device to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("rejects expired credentials", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{RequireSignature: true})
+		authenticator.RegisterDevice("device-1", secret, time.Now().Add(-time.Second))
+
+		// when
+		_, err := authenticator.Verify(signedRequest("device-1", secret, time.Now(), "nonce-1"), nil, nil)
+
+		// then
+		if !internal.IsUnauthorizedError(err) || !strings.Contains(err.Error(), "expired") {
+			t.Errorf("expected expired credentials to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("rejects device id not matching the client certificate", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{})
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/configs/manifest", nil)
+		r.Header.Set(internal.DeviceIdHeader, "device-2")
+		certificates := []*x509.Certificate{{Subject: pkix.Name{CommonName: "device-1"}}}
+
+		// when
+		_, err := authenticator.Verify(r, nil, certificates)
+
+		// then
+		if !internal.IsUnauthorizedError(err) || !strings.Contains(err.Error(), "does not match client certificate") {
+			t.Errorf("expected mismatching device id to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("takes device id from the client certificate", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{})
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/configs/manifest", nil)
+		certificates := []*x509.Certificate{{Subject: pkix.Name{CommonName: "device-1"}}}
+
+		// when
+		deviceId, err := authenticator.Verify(r, nil, certificates)
+
+		// then
+		if err != nil || deviceId != "device-1" {
+			t.Errorf("expected device-1 from the certificate, got %q and %v", deviceId, err)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+type (
+	EnrollmentConfig struct {
+		// CACertFile and CAKeyFile enable issuing client certificates. Without them devices only
+		// receive a token.
+		CACertFile    string        `envconfig:"ENROLLMENT_CA_CERT_FILE"`
+		CAKeyFile     string        `envconfig:"ENROLLMENT_CA_KEY_FILE"`
+		CredentialTTL time.Duration `envconfig:"ENROLLMENT_CREDENTIAL_TTL" default:"720h"`
+	}
+
+	// EnrollmentService issues credentials to devices. New devices prove possession of the key
+	// their id is derived from, known devices authenticate with their current token.
+	EnrollmentService struct {
+		authenticator *DeviceAuthenticator
+		repository    DeviceRepository
+		ca            *x509.Certificate
+		caKey         crypto.Signer
+		ttl           time.Duration
+	}
+
+	// DeviceRepository persists the tokens issued to devices. Devices rotate their key with
+	// every renewal, so a device unknown after a restart could not prove its id anymore.
+	DeviceRepository interface {
+		Save(ctx context.Context, device *Device) error
+		List(ctx context.Context) ([]*Device, error)
+	}
+
+	Device struct {
+		Id        string    `json:"id"`
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	EnrollmentRequest struct {
+		DeviceId string `json:"deviceId"`
+		CSR      string `json:"csr"`
+	}
+
+	Credentials struct {
+		Certificate string    `json:"certificate,omitempty"`
+		Token       string    `json:"token,omitempty"`
+		ExpiresAt   time.Time `json:"expiresAt"`
+	}
+)
+
+// NewEnrollmentService registers the devices of the repository with the authenticator and
+// returns a service issuing credentials to new and known devices.
+func NewEnrollmentService(ctx context.Context, config *EnrollmentConfig, authenticator *DeviceAuthenticator, repository DeviceRepository) (*EnrollmentService, error) {
+	service := &EnrollmentService{authenticator: authenticator, repository: repository, ttl: config.CredentialTTL}
+	if service.ttl <= 0 {
+		service.ttl = 30 * 24 * time.Hour
+	}
+
+	devices, err := repository.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrolled devices: %w", err)
+	}
+	for _, device := range devices {
+		authenticator.RegisterDevice(device.Id, []byte(device.Token), device.ExpiresAt)
+	}
+
+	if config.CACertFile == "" {
+		return service, nil
+	}
+
+	keyPair, err := tls.LoadX509KeyPair(config.CACertFile, config.CAKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load enrollment CA: %w", err)
+	}
+	signer, ok := keyPair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("enrollment CA key cannot sign certificates")
+	}
+
+	service.ca = keyPair.Leaf
+	service.caKey = signer
+	return service, nil
+}
+
+// Enroll issues new credentials for the device of the request. authorization is the value of
+// the Authorization header, which must carry the current token of known devices.
+func (s *EnrollmentService) Enroll(ctx context.Context, req *EnrollmentRequest, authorization string) (*Credentials, error) {
+	csr, err := parseCSR(req.CSR)
+	if err != nil {
+		return nil, NewInvalidRequestError(err)
+	}
+	if req.DeviceId == "" || csr.Subject.CommonName != req.DeviceId {
+		return nil, NewInvalidRequestError(errors.New("common name of the CSR must be the device id"))
+	}
+
+	if secret, known := s.authenticator.Secret(req.DeviceId); known {
+		token, _ := strings.CutPrefix(authorization, "Bearer ")
+		if !hmac.Equal([]byte(token), secret) {
+			return nil, NewUnauthorizedError(fmt.Errorf("device %s must authenticate with its current token", req.DeviceId))
+		}
+	} else if expected, err := deviceIdFromPublicKey(csr.PublicKey); err != nil || expected != req.DeviceId {
+		return nil, NewUnauthorizedError(fmt.Errorf("device id %s is not derived from the public key", req.DeviceId))
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("failed to create token: %w", err)
+	}
+
+	credentials := &Credentials{Token: hex.EncodeToString(tokenBytes), ExpiresAt: time.Now().Add(s.ttl).Truncate(time.Second)}
+	if s.ca != nil {
+		if credentials.Certificate, err = s.issueCertificate(csr, credentials.ExpiresAt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.repository.Save(ctx, &Device{Id: req.DeviceId, Token: credentials.Token, ExpiresAt: credentials.ExpiresAt}); err != nil {
+		return nil, fmt.Errorf("failed to store device: %w", err)
+	}
+	s.authenticator.RegisterDevice(req.DeviceId, []byte(credentials.Token), credentials.ExpiresAt)
+	return credentials, nil
+}
+
+func (s *EnrollmentService) issueCertificate(csr *x509.CertificateRequest, expiresAt time.Time) (string, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", fmt.Errorf("failed to create serial number: %w", err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     expiresAt,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to issue certificate: %w", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), nil
+}
+
+func parseCSR(data string) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("csr is not PEM encoded")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid csr signature: %w", err)
+	}
+	return csr, nil
+}
+
+// deviceIdFromPublicKey mirrors the derivation of the client identity package.
+func deviceIdFromPublicKey(publicKey any) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:16]), nil
+}
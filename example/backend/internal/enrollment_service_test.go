@@ -0,0 +1,104 @@
+package internal_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+)
+
+// memoryDeviceRepository stands in for the database, which outlives backend restarts.
+type memoryDeviceRepository struct {
+	mu      sync.Mutex
+	devices map[string]internal.Device
+}
+
+func (r *memoryDeviceRepository) Save(ctx context.Context, device *internal.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.devices[device.Id] = *device
+	return nil
+}
+
+func (r *memoryDeviceRepository) List(ctx context.Context) ([]*internal.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var devices []*internal.Device
+	for _, device := range r.devices {
+		devices = append(devices, &device)
+	}
+	return devices, nil
+}
+
+// enrollmentRequest creates the request of a device with a fresh key, like the client does on
+// every renewal. The device id is derived from the key unless given.
+func enrollmentRequest(t *testing.T, deviceId string) *internal.EnrollmentRequest {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deviceId == "" {
+		der, err := x509.MarshalPKIXPublicKey(key.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(der)
+		deviceId = hex.EncodeToString(sum[:16])
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: deviceId}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &internal.EnrollmentRequest{DeviceId: deviceId, CSR: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))}
+}
+
+func TestEnrollmentService_KeepsDevicesAcrossRestarts(t *testing.T) {
+	// given
+	ctx := context.Background()
+	repository := &memoryDeviceRepository{devices: make(map[string]internal.Device)}
+	service, err := internal.NewEnrollmentService(ctx, &internal.EnrollmentConfig{}, internal.NewDeviceAuthenticator(&internal.AuthConfig{RequireSignature: true}), repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := enrollmentRequest(t, "")
+	credentials, err := service.Enroll(ctx, first, "")
+	if err != nil {
+		t.Fatalf("expected new device to be enrolled, got %v", err)
+	}
+
+	// when
+	authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{RequireSignature: true})
+	restarted, err := internal.NewEnrollmentService(ctx, &internal.EnrollmentConfig{}, authenticator, repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// then
+	if _, err := authenticator.Verify(signedRequest(first.DeviceId, []byte(credentials.Token), time.Now(), "nonce-1"), nil, nil); err != nil {
+		t.Errorf("expected signed request to be accepted after the restart, got %v", err)
+	}
+	if _, err := restarted.Enroll(ctx, enrollmentRequest(t, first.DeviceId), ""); !internal.IsUnauthorizedError(err) {
+		t.Errorf("expected renewal without token to be rejected, got %v", err)
+	}
+	renewed, err := restarted.Enroll(ctx, enrollmentRequest(t, first.DeviceId), "Bearer "+credentials.Token)
+	if err != nil {
+		t.Fatalf("expected renewal with a new key to be accepted after the restart, got %v", err)
+	}
+	if renewed.Token == credentials.Token {
+		t.Error("expected a new token")
+	}
+}
@@ -14,6 +14,14 @@ type (
 	ConflictError struct {
 		err error
 	}
+
+	UnauthorizedError struct {
+		err error
+	}
+
+	PayloadTooLargeError struct {
+		err error
+	}
 )
 
 func NewNotFoundError(err error) *NotFoundError {
@@ -54,3 +62,29 @@ func IsConflictError(err error) bool {
 	var conflictError *ConflictError
 	return errors.As(err, &conflictError)
 }
+
+func NewUnauthorizedError(err error) *UnauthorizedError {
+	return &UnauthorizedError{err: err}
+}
+
+func (e *UnauthorizedError) Error() string {
+	return e.err.Error()
+}
+
+func IsUnauthorizedError(err error) bool {
+	var unauthorizedError *UnauthorizedError
+	return errors.As(err, &unauthorizedError)
+}
+
+func NewPayloadTooLargeError(err error) *PayloadTooLargeError {
+	return &PayloadTooLargeError{err: err}
+}
+
+func (e *PayloadTooLargeError) Error() string {
+	return e.err.Error()
+}
+
+func IsPayloadTooLargeError(err error) bool {
+	var payloadTooLargeError *PayloadTooLargeError
+	return errors.As(err, &payloadTooLargeError)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+type (
+	// EventService accepts event batches from clients. Clients deliver events at least once, so
+	// batches are deduplicated by event id within a bounded window.
+	EventService struct {
+		mu       sync.Mutex
+		capacity int
+		seen     map[string]*list.Element
+		order    *list.List
+		events   []*Event
+	}
+
+	Event struct {
+		Id            string                 `json:"id"`
+		DeviceId      string                 `json:"deviceId"`
+		ClientVersion string                 `json:"clientVersion"`
+		Timestamp     time.Time              `json:"timestamp"`
+		Source        string                 `json:"source"`
+		Type          string                 `json:"type"`
+		Message       string                 `json:"message"`
+		Data          map[string]interface{} `json:"data,omitempty"`
+		IsError       bool                   `json:"isError"`
+		// SchemaVersion is the version of the payload schema the client validated Data against.
+		SchemaVersion int `json:"schemaVersion,omitempty"`
+	}
+
+	IngestResult struct {
+		Accepted   int `json:"accepted"`
+		Duplicates int `json:"duplicates"`
+	}
+)
+
+// NewEventService creates an EventService that remembers the ids of the last capacity events.
+func NewEventService(capacity int) *EventService {
+	if capacity <= 0 {
+		capacity = 100000
+	}
+
+	return &EventService{
+		capacity: capacity,
+		seen:     make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *EventService) Ingest(events []*Event) (*IngestResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &IngestResult{}
+	for _, event := range events {
+		if event == nil || event.Id == "" {
+			return nil, NewInvalidRequestError(errors.New("event id cannot be empty"))
+		}
+	}
+
+	for _, event := range events {
+		if _, ok := s.seen[event.Id]; ok {
+			result.Duplicates++
+			continue
+		}
+
+		s.seen[event.Id] = s.order.PushBack(event.Id)
+		if s.order.Len() > s.capacity {
+			oldest := s.order.Front()
+			s.order.Remove(oldest)
+			delete(s.seen, oldest.Value.(string))
+		}
+
+		s.events = append(s.events, event)
+		if len(s.events) > s.capacity {
+			s.events = s.events[1:]
+		}
+		result.Accepted++
+	}
+
+	return result, nil
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"bytes"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DeviceIdContextKey holds the id of the authenticated device in the gin context.
+	DeviceIdContextKey = "deviceId"
+	// maxAuthenticatedBodyBytes limits the body read to verify its hash.
+	maxAuthenticatedBodyBytes = 32 * 1024 * 1024
+)
+
+// AuthMiddleware rejects requests that were not sent by a known device.
+func AuthMiddleware(authenticator *internal.DeviceAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := internal.NewLogger(c)
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxAuthenticatedBodyBytes))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.AbortWithStatusJSON(NewProblemFromError(internal.NewPayloadTooLargeError(fmt.Errorf("body exceeds %d bytes", maxBytesErr.Limit))))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(NewProblemFromError(internal.NewInvalidRequestError(fmt.Errorf("failed to read body: %w", err))))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var certificates []*x509.Certificate
+		if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			certificates = c.Request.TLS.VerifiedChains[0]
+		}
+
+		deviceId, err := authenticator.Verify(c.Request, body, certificates)
+		if err != nil {
+			logger.Warnf("rejected unauthenticated request to %s: %v", c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(NewProblemFromError(err))
+			return
+		}
+
+		c.Set(DeviceIdContextKey, deviceId)
+		c.Next()
+	}
+}
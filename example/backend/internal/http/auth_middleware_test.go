@@ -0,0 +1,55 @@
+package http_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	backendHttp "github.com/dtomschitz/headless-go-client/example/backend/internal/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("rejects unsigned request", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{DeviceSecrets: map[string]string{"device-1": "secret"}})
+		router := gin.New()
+		router.POST("/api/v1/events", backendHttp.AuthMiddleware(authenticator), func(c *gin.Context) {
+			c.Status(http.StatusAccepted)
+		})
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events", bytes.NewBufferString("[]"))
+		req.Header.Set(internal.DeviceIdHeader, "device-1")
+
+		// when
+		router.ServeHTTP(recorder, req)
+
+		// then
+		if recorder.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("rejects body over the limit with 413", func(t *testing.T) {
+		// given
+		authenticator := internal.NewDeviceAuthenticator(&internal.AuthConfig{DeviceSecrets: map[string]string{"device-1": "secret"}})
+		router := gin.New()
+		router.POST("/api/v1/events", backendHttp.AuthMiddleware(authenticator), func(c *gin.Context) {
+			c.Status(http.StatusAccepted)
+		})
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events", bytes.NewReader(make([]byte, 32*1024*1024+1)))
+
+		// when
+		router.ServeHTTP(recorder, req)
+
+		// then
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status 413, got %d", recorder.Code)
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package http
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/dtomschitz/headless-go-client/example/backend/internal"
 	"github.com/gin-gonic/gin"
@@ -11,6 +14,8 @@ import (
 	_ "embed"
 )
 
+const mergePatchContentType = "application/merge-patch+json"
+
 //go:embed dummy_data/config_manifest.json
 var dummyConfigManifest []byte
 
@@ -36,7 +41,7 @@ func (h *ConfigHandler) CreateConfig(c *gin.Context) {
 
 	err := h.configService.CreateConfig(c.Request.Context(), &config)
 	if err != nil {
-		if err.Error() == fmt.Sprintf("config with version '%s' already exists", config.Version) { // Example for specific error string check
+		if internal.IsConflictError(err) {
 			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 			return
 		}
@@ -47,6 +52,8 @@ func (h *ConfigHandler) CreateConfig(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": "Configuration created successfully"})
 }
 
+// GetConfigByVersion returns the properties of a config. Targeted configs may share a version,
+// so manifests of targeted configs select the config through the id query parameter.
 func (h *ConfigHandler) GetConfigByVersion(c *gin.Context) {
 	logger := internal.NewLogger(c)
 
@@ -56,29 +63,160 @@ func (h *ConfigHandler) GetConfigByVersion(c *gin.Context) {
 		return
 	}
 
-	/*config, err := h.configService.GetConfigByVersion(c.Request.Context(), version)
+	config, err := h.getConfig(c, version, c.Query("id"))
+	if internal.IsNotFoundError(err) && c.Query("id") == "" {
+		logger.With("config", string(dummyConfig)).Info("fetch config")
+		c.Data(http.StatusOK, "application/json", dummyConfig)
+		return
+	}
+	if err != nil {
+		logger.With(err).Errorf("failed to retrieve config %s", version)
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	properties, err := json.Marshal(config.Properties)
+	if err != nil {
+		c.JSON(NewProblemFromError(fmt.Errorf("failed to encode config %s", version)))
+		return
+	}
+
+	logger.With("version", version, "id", config.Id).Info("fetch config")
+
+	c.Data(http.StatusOK, "application/json", properties)
+}
+
+// getConfig returns the config with the id, or the config of the version if no id is given.
+func (h *ConfigHandler) getConfig(c *gin.Context, version, id string) (*internal.Config, error) {
+	if id == "" {
+		return h.configService.GetConfigByVersion(c.Request.Context(), version)
+	}
+
+	config, err := h.configService.GetConfigById(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+	if config.Version != version {
+		return nil, internal.NewNotFoundError(fmt.Errorf("config %s has no version %s", id, version))
+	}
+	return config, nil
+}
+
+// GetManifestForDevice returns the manifest of the config targeted at the requesting device.
+// The device descriptor is read from the JSON body of POST requests or from the query. The
+// default manifest is served if no config matches the device.
+func (h *ConfigHandler) GetManifestForDevice(c *gin.Context) {
+	logger := internal.NewLogger(c)
+
+	descriptor, err := bindDeviceDescriptor(c)
+	if err != nil {
+		c.JSON(NewProblemFromError(internal.NewInvalidRequestError(err)))
+		return
+	}
+
+	config, err := h.configService.GetConfigForDevice(c.Request.Context(), descriptor)
+	if internal.IsNotFoundError(err) {
+		logger.With("deviceId", descriptor.DeviceId).Info("no config targets device, serving default manifest")
+		c.Data(http.StatusOK, "application/json", dummyConfigManifest)
+		return
+	}
+	if err != nil {
+		logger.With(err).Errorf("failed to retrieve config for device %s", descriptor.DeviceId)
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	hash, err := config.Hash()
 	if err != nil {
-		logger.With(err).Error("failed to retrieve config %s", version)
-		c.JSON(NewProblemFromError(fmt.Errorf("failed to retrieve config %s", version)))
+		c.JSON(NewProblemFromError(fmt.Errorf("failed to encode config %s", config.Version)))
 		return
-	}*/
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	// The id selects the served config, as targeted configs may share a version.
+	baseURL := fmt.Sprintf("%s://%s/api/v1/configs/%s", scheme, c.Request.Host, url.PathEscape(config.Version))
+
+	manifest := gin.H{
+		"version": config.Version,
+		"hash":    hash,
+		"url":     baseURL + "/properties?" + url.Values{"id": {config.Id}}.Encode(),
+	}
+
+	// Devices on a known older version only need the changes since their version.
+	if descriptor.CurrentVersion != "" && descriptor.CurrentVersion != config.Version {
+		if base, err := h.configService.FindConfig(c.Request.Context(), descriptor.CurrentVersion, descriptor.CurrentHash); err == nil {
+			manifest["patch"] = gin.H{
+				"baseVersion": descriptor.CurrentVersion,
+				"type":        mergePatchContentType,
+				"url":         baseURL + "/patch?" + url.Values{"id": {config.Id}, "from": {descriptor.CurrentVersion}, "fromId": {base.Id}}.Encode(),
+			}
+		}
+	}
 
-	logger.With("config", string(dummyConfig)).Info("fetch config")
+	logger.With("deviceId", descriptor.DeviceId, "version", config.Version, "currentVersion", descriptor.CurrentVersion).Info("fetch manifest for device")
 
-	c.Data(http.StatusOK, "application/json", dummyConfig)
+	c.JSON(http.StatusOK, manifest)
 }
 
-func (h *ConfigHandler) GetLatestManifest(c *gin.Context) {
+// GetConfigPatch returns the JSON merge patch from the version given by the from query
+// parameter to the requested version.
+func (h *ConfigHandler) GetConfigPatch(c *gin.Context) {
 	logger := internal.NewLogger(c)
 
-	/*config, err := h.configService.GetLatestConfig(c.Request.Context())
+	version, from := c.Param("version"), c.Query("from")
+	if version == "" || from == "" {
+		c.JSON(NewProblemFromError(internal.NewInvalidRequestError(errors.New("version and from parameters are required"))))
+		return
+	}
+
+	target, err := h.getConfig(c, version, c.Query("id"))
+	if err != nil {
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	base, err := h.getConfig(c, from, c.Query("fromId"))
+	if err != nil {
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	patch, err := json.Marshal(internal.CreateMergePatch(base.Properties, target.Properties))
 	if err != nil {
-		logger.With(err).Error("failed to retrieve latest config")
-		c.JSON(NewProblemFromError(errors.New("failed to retrieve latest config")))
+		c.JSON(NewProblemFromError(fmt.Errorf("failed to encode patch from %s to %s", from, version)))
 		return
-	}*/
+	}
+
+	logger.With("version", version, "from", from).Info("fetch config patch")
+
+	c.Data(http.StatusOK, mergePatchContentType, patch)
+}
+
+func bindDeviceDescriptor(c *gin.Context) (*internal.DeviceDescriptor, error) {
+	var descriptor internal.DeviceDescriptor
+
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&descriptor); err != nil {
+			return nil, fmt.Errorf("invalid device descriptor: %w", err)
+		}
+		return &descriptor, nil
+	}
 
-	logger.With("manifest", string(dummyConfigManifest)).Info("fetch latest manifest")
+	if err := c.ShouldBindQuery(&descriptor); err != nil {
+		return nil, fmt.Errorf("invalid device descriptor: %w", err)
+	}
+	for key, values := range c.Request.URL.Query() {
+		if label, ok := strings.CutPrefix(key, "label."); ok && len(values) > 0 {
+			if descriptor.Labels == nil {
+				descriptor.Labels = make(map[string]string)
+			}
+			descriptor.Labels[label] = values[0]
+		}
+	}
 
-	c.Data(http.StatusOK, "application/json", dummyConfigManifest)
+	return &descriptor, nil
 }
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	"github.com/gin-gonic/gin"
+)
+
+type EnrollmentHandler struct {
+	enrollmentService *internal.EnrollmentService
+}
+
+func NewEnrollmentHandler(svc *internal.EnrollmentService) *EnrollmentHandler {
+	return &EnrollmentHandler{
+		enrollmentService: svc,
+	}
+}
+
+func (h *EnrollmentHandler) Enroll(c *gin.Context) {
+	logger := internal.NewLogger(c)
+
+	var req internal.EnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(NewProblemFromError(internal.NewInvalidRequestError(err)))
+		return
+	}
+
+	credentials, err := h.enrollmentService.Enroll(c.Request.Context(), &req, c.GetHeader("Authorization"))
+	if err != nil {
+		logger.Warnf("rejected enrollment of device %s: %v", req.DeviceId, err)
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	logger.Infof("enrolled device %s until %s", req.DeviceId, credentials.ExpiresAt)
+	c.JSON(http.StatusOK, credentials)
+}
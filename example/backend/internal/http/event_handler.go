@@ -0,0 +1,113 @@
+package http
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// maxEventPayloadBytes limits the decompressed size of a single upload.
+	maxEventPayloadBytes = 16 * 1024 * 1024
+)
+
+type EventHandler struct {
+	eventService *internal.EventService
+}
+
+func NewEventHandler(svc *internal.EventService) *EventHandler {
+	return &EventHandler{
+		eventService: svc,
+	}
+}
+
+func (h *EventHandler) IngestEvents(c *gin.Context) {
+	logger := internal.NewLogger(c)
+
+	events, err := decodeEvents(c.Request)
+	if err != nil {
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	result, err := h.eventService.Ingest(events)
+	if err != nil {
+		c.JSON(NewProblemFromError(err))
+		return
+	}
+
+	logger.Infof("ingested %d events, %d duplicates", result.Accepted, result.Duplicates)
+	c.JSON(http.StatusAccepted, result)
+}
+
+// decodeEvents reads a JSON array or NDJSON upload, optionally compressed with gzip or zstd.
+// Uploads exceeding maxEventPayloadBytes once decompressed are rejected as too large instead of
+// being truncated into an invalid request.
+func decodeEvents(r *http.Request) ([]*internal.Event, error) {
+	events, limited, err := readEvents(r)
+	if limited != nil && limited.N == 0 {
+		return nil, internal.NewPayloadTooLargeError(fmt.Errorf("decompressed body exceeds %d bytes", maxEventPayloadBytes))
+	}
+	if err != nil {
+		return nil, internal.NewInvalidRequestError(err)
+	}
+	return events, nil
+}
+
+// readEvents decodes the upload through a reader limited to one byte more than
+// maxEventPayloadBytes, which is exhausted only if the upload is too large.
+func readEvents(r *http.Request) ([]*internal.Event, *io.LimitedReader, error) {
+	var body io.Reader = r.Body
+	switch encoding := r.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid gzip payload: %w", err)
+		}
+		defer reader.Close()
+		body = reader
+	case "zstd":
+		decoder, err := zstd.NewReader(r.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid zstd payload: %w", err)
+		}
+		defer decoder.Close()
+		body = decoder
+	default:
+		return nil, nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	limited := &io.LimitedReader{R: body, N: maxEventPayloadBytes + 1}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var events []*internal.Event
+	decoder := json.NewDecoder(limited)
+	if mediaType != ndjsonContentType {
+		if err := decoder.Decode(&events); err != nil {
+			return nil, limited, fmt.Errorf("invalid event payload: %w", err)
+		}
+		return events, limited, nil
+	}
+
+	for {
+		var event internal.Event
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			return events, limited, nil
+		}
+		if err != nil {
+			return nil, limited, fmt.Errorf("invalid event payload: %w", err)
+		}
+		events = append(events, &event)
+	}
+}
@@ -0,0 +1,63 @@
+package http_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/example/backend/internal"
+	backendHttp "github.com/dtomschitz/headless-go-client/example/backend/internal/http"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEventHandler_IngestEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("accepts compressed upload", func(t *testing.T) {
+		// given
+		router := gin.New()
+		router.POST("/api/v1/events", backendHttp.NewEventHandler(internal.NewEventService(0)).IngestEvents)
+		var body bytes.Buffer
+		writer := gzip.NewWriter(&body)
+		writer.Write([]byte(`{"id":"1","type":"heartbeat"}` + "\n" + `{"id":"2","type":"heartbeat"}` + "\n"))
+		writer.Close()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events", &body)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Content-Encoding", "gzip")
+
+		// when
+		router.ServeHTTP(recorder, req)
+
+		// then
+		if recorder.Code != http.StatusAccepted {
+			t.Errorf("expected status 202, got %d", recorder.Code)
+		}
+	})
+
+	t.Run("rejects decompressed body over the limit with 413", func(t *testing.T) {
+		// given
+		router := gin.New()
+		router.POST("/api/v1/events", backendHttp.NewEventHandler(internal.NewEventService(0)).IngestEvents)
+		var body bytes.Buffer
+		writer := gzip.NewWriter(&body)
+		writer.Write([]byte("["))
+		writer.Write(bytes.Repeat([]byte(" "), 16*1024*1024))
+		writer.Write([]byte("]"))
+		writer.Close()
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/events", &body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+
+		// when
+		router.ServeHTTP(recorder, req)
+
+		// then
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status 413, got %d", recorder.Code)
+		}
+	})
+}
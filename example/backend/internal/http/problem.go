@@ -60,8 +60,14 @@ func NewProblemFromError(err error, opts ...ProblemOption) (int, *Problem) {
 
 	if internal.IsNotFoundError(err) {
 		problem = NewProblem(http.StatusNotFound, "Not Found", WithError(err))
+	} else if internal.IsInvalidRequestError(err) {
+		problem = NewProblem(http.StatusBadRequest, "Bad Request", WithError(err))
 	} else if internal.IsConflictError(err) {
 		problem = NewProblem(http.StatusConflict, "Conflict", WithError(err))
+	} else if internal.IsUnauthorizedError(err) {
+		problem = NewProblem(http.StatusUnauthorized, "Unauthorized", WithError(err))
+	} else if internal.IsPayloadTooLargeError(err) {
+		problem = NewProblem(http.StatusRequestEntityTooLarge, "Payload Too Large", WithError(err))
 	} else {
 		problem = NewProblem(http.StatusInternalServerError, "Internal Server Error", WithError(err))
 	}
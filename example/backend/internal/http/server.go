@@ -1,24 +1,41 @@
 package http
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
 	"github.com/dtomschitz/headless-go-client/example/backend/internal"
 	"github.com/gin-gonic/gin"
 )
 
-func StartServer(configService *internal.ConfigService) error {
+func StartServer(configService *internal.ConfigService, eventService *internal.EventService, enrollmentService *internal.EnrollmentService, authenticator *internal.DeviceAuthenticator, authConfig *internal.AuthConfig) error {
 	router := gin.Default()
 
 	configHandler := NewConfigHandler(configService)
 	clientUpdateHandler := NewClientUpdateHandler()
+	eventHandler := NewEventHandler(eventService)
+	enrollmentHandler := NewEnrollmentHandler(enrollmentService)
+
+	// Devices enroll before they have credentials, so enrollment authenticates on its own.
+	router.POST("/api/v1/devices/enroll", enrollmentHandler.Enroll)
 
 	// API Group
 	api := router.Group("/api/v1")
+	if authenticator.RequiresSignature() || authConfig.ClientCAFile != "" {
+		api.Use(AuthMiddleware(authenticator))
+	}
 	{
 		configs := api.Group("/configs")
 		{
 			configs.POST("", configHandler.CreateConfig)
 			configs.GET("/:version/properties", configHandler.GetConfigByVersion)
-			configs.GET("/manifest", configHandler.GetLatestManifest)
+			configs.GET("/:version/patch", configHandler.GetConfigPatch)
+			configs.GET("/manifest", configHandler.GetManifestForDevice)
+			configs.GET("/manifest/device", configHandler.GetManifestForDevice)
+			configs.POST("/manifest", configHandler.GetManifestForDevice)
 		}
 
 		clientUpdate := api.Group("/client")
@@ -26,7 +43,41 @@ func StartServer(configService *internal.ConfigService) error {
 			clientUpdate.GET("/:version/binary", clientUpdateHandler.GetBinaryByVersion)
 			clientUpdate.GET("/manifest", clientUpdateHandler.GetLatestManifest)
 		}
+
+		api.POST("/events", eventHandler.IngestEvents)
+	}
+
+	if authConfig.TLSCertFile == "" {
+		return router.Run()
+	}
+
+	tlsConfig, err := newTLSConfig(authConfig)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Addr: authConfig.TLSAddr, Handler: router.Handler(), TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS(authConfig.TLSCertFile, authConfig.TLSKeyFile)
+}
+
+// newTLSConfig requires client certificates issued by the configured CAs, if any.
+func newTLSConfig(authConfig *internal.AuthConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if authConfig.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(authConfig.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA file %s contains no certificates", authConfig.ClientCAFile)
 	}
 
-	return router.Run()
+	tlsConfig.ClientCAs = clientCAs
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
 }
@@ -0,0 +1,32 @@
+package internal
+
+import "reflect"
+
+// CreateMergePatch returns the RFC 7396 merge patch that transforms from into to.
+func CreateMergePatch(from, to map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			patch[key] = nil
+		}
+	}
+
+	for key, value := range to {
+		previous, ok := from[key]
+		if ok && reflect.DeepEqual(previous, value) {
+			continue
+		}
+
+		previousObject, previousIsObject := previous.(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if ok && previousIsObject && isObject {
+			patch[key] = CreateMergePatch(previousObject, object)
+			continue
+		}
+
+		patch[key] = value
+	}
+
+	return patch
+}
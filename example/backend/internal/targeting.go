@@ -0,0 +1,111 @@
+package internal
+
+import (
+	"strconv"
+	"strings"
+)
+
+type (
+	// DeviceDescriptor is sent by clients using the targeted manifest requester.
+	DeviceDescriptor struct {
+		DeviceId       string            `json:"deviceId" form:"deviceId"`
+		ClientVersion  string            `json:"clientVersion" form:"clientVersion"`
+		Platform       string            `json:"platform" form:"platform"`
+		Labels         map[string]string `json:"labels"`
+		CurrentVersion string            `json:"currentVersion" form:"currentVersion"`
+		CurrentHash    string            `json:"currentHash" form:"currentHash"`
+	}
+
+	// Target selects the devices a config is served to. All non-empty fields must match.
+	// A config without targets is served to every device.
+	Target struct {
+		DeviceIds        []string          `json:"deviceIds,omitempty"`
+		Platforms        []string          `json:"platforms,omitempty"`
+		Labels           map[string]string `json:"labels,omitempty"`
+		MinClientVersion string            `json:"minClientVersion,omitempty"`
+	}
+)
+
+// Matches reports whether the config may be served to the device described by the descriptor.
+func (c *Config) Matches(descriptor *DeviceDescriptor) bool {
+	if len(c.Targets) == 0 {
+		return true
+	}
+
+	for _, target := range c.Targets {
+		if target.Matches(descriptor) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches reports whether the device described by the descriptor is part of the target.
+func (t *Target) Matches(descriptor *DeviceDescriptor) bool {
+	if len(t.DeviceIds) > 0 && !contains(t.DeviceIds, descriptor.DeviceId) {
+		return false
+	}
+	if len(t.Platforms) > 0 && !contains(t.Platforms, descriptor.Platform) {
+		return false
+	}
+	for key, value := range t.Labels {
+		if descriptor.Labels[key] != value {
+			return false
+		}
+	}
+	if t.MinClientVersion != "" && compareVersions(descriptor.ClientVersion, t.MinClientVersion) < 0 {
+		return false
+	}
+
+	return true
+}
+
+// specificity ranks targeted configs above untargeted ones and device targets above groups.
+func (c *Config) specificity(descriptor *DeviceDescriptor) int {
+	specificity := 0
+	for _, target := range c.Targets {
+		if !target.Matches(descriptor) {
+			continue
+		}
+
+		score := 1
+		if len(target.DeviceIds) > 0 {
+			score = 2
+		}
+		if score > specificity {
+			specificity = score
+		}
+	}
+	return specificity
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func compareVersions(a, b string) int {
+	as := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bs := strings.Split(strings.TrimPrefix(b, "v"), ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
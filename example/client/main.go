@@ -8,8 +8,10 @@ import (
 	"time"
 
 	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
 	"github.com/dtomschitz/headless-go-client/config"
 	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/identity"
 	"github.com/dtomschitz/headless-go-client/lifecycle"
 	"github.com/dtomschitz/headless-go-client/logger"
 	"github.com/dtomschitz/headless-go-client/manifest"
@@ -21,11 +23,12 @@ type Config struct {
 	SelfUpdateManifestURL string `envconfig:"SELF_UPDATE_MANIFEST_URL" required:"true"`
 	ConfigManifestURL     string `envconfig:"CONFIG_MANIFEST_URL" required:"true"`
 	ConfigStorageURL      string `envconfig:"CONFIG_STORAGE_URL" required:"true" default:"./config.json"`
+	IdentityEnrollURL     string `envconfig:"IDENTITY_ENROLL_URL" default:"http://localhost:8080/api/v1/devices/enroll"`
+	IdentityDir           string `envconfig:"IDENTITY_DIR" default:"./identity"`
 }
 
 func main() {
 	ctx := context.Background()
-	ctx = context.WithValue(ctx, commonCtx.DeviceIdKey, "12345")
 	ctx = context.WithValue(ctx, commonCtx.ClientVersionKey, "dev")
 
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
@@ -49,22 +52,39 @@ func main() {
 	}
 	defer closer.CloseAll(ctx)
 
+	identityService, err := identity.NewService(ctx, clientConfig.IdentityEnrollURL, clientConfig.IdentityDir, identity.WithLogger(logger.SlogFactory))
+	if err != nil {
+		log.Error("failed to create identity service", err)
+		return
+	}
+	closer.Register(identityService)
+	ctx = identityService.Context(ctx)
+
+	// The kind of credentials issued decides how requests are authenticated.
+	select {
+	case <-identityService.Enrolled():
+	case <-ctx.Done():
+		return
+	}
+	httpClient := commonHttp.NewClient(identityService.HTTPOptions()...)
+
 	configStorage := config.NewFileStorage(clientConfig.ConfigStorageURL)
-	configService, err := config.NewService(ctx, clientConfig.ConfigManifestURL, config.WithLogger(logger.SlogFactory), config.WithStorage(configStorage))
+	configService, err := config.NewService(ctx, clientConfig.ConfigManifestURL, config.WithLogger(logger.SlogFactory), config.WithStorage(configStorage), config.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Error("failed to create config service", err)
 		return
 	}
 	closer.Register(configService)
 
-	eventService, err := event.NewService(ctx, "http://localhost:8080/events", event.WithLogger(logger.SlogFactory))
+	eventService, err := event.NewService(ctx, "http://localhost:8080/events", event.WithLogger(logger.SlogFactory), event.WithCircuitBreakerEvents(nil), event.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Error("failed to create event service", err)
 		return
 	}
 	closer.Register(eventService)
+	eventService.RegisterProducer(identityService)
 
-	selfUpdater, err := updater.NewService(ctx, clientConfig.SelfUpdateManifestURL, "dev", updater.WithLogger(logger.SlogFactory), updater.WithInitialPollDelay(time.Second))
+	selfUpdater, err := updater.NewService(ctx, clientConfig.SelfUpdateManifestURL, "dev", updater.WithLogger(logger.SlogFactory), updater.WithInitialPollDelay(time.Second), updater.WithHTTPClient(httpClient))
 	if err != nil {
 		log.Error("failed to create update service", err)
 		return
@@ -0,0 +1,230 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/config"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type (
+	// ConfigSource provides the config the flag definitions are read from. It is implemented by
+	// config.ConfigService.
+	ConfigSource interface {
+		Current() *config.Config
+	}
+
+	Evaluator struct {
+		source      ConfigSource
+		propertyKey string
+
+		logger logger.Logger
+		events event.Emitter
+	}
+
+	// Evaluation describes the outcome of evaluating a single flag.
+	Evaluation struct {
+		Key       string      `json:"key"`
+		Value     interface{} `json:"value"`
+		Variation string      `json:"variation,omitempty"`
+		Reason    Reason      `json:"reason"`
+		// RuleIndex is the index of the matching rule, it is only set for ReasonRuleMatch.
+		RuleIndex *int `json:"ruleIndex,omitempty"`
+	}
+
+	// Attributes are the values flag rules are matched against.
+	Attributes map[string]string
+
+	Reason string
+
+	attributesKey struct{}
+)
+
+const (
+	DeviceIdAttribute      = "deviceId"
+	ClientVersionAttribute = "clientVersion"
+
+	DefaultPropertyKey = "flags"
+
+	FlagEvaluatedEvent event.EventType = "flag_evaluated"
+
+	ReasonFlagNotFound Reason = "flag_not_found"
+	ReasonError        Reason = "error"
+	ReasonOff          Reason = "off"
+	ReasonRuleMatch    Reason = "rule_match"
+	ReasonFallthrough  Reason = "fallthrough"
+)
+
+func init() {
+	event.MustRegisterPayload(FlagEvaluatedEvent, 1, Evaluation{})
+}
+
+// WithAttributes returns a copy of ctx carrying custom attributes that are used during flag
+// evaluation. Attributes already present in ctx are merged, with the given ones taking precedence.
+func WithAttributes(ctx context.Context, attrs Attributes) context.Context {
+	merged := make(Attributes)
+	if existing, ok := ctx.Value(attributesKey{}).(Attributes); ok {
+		for k, v := range existing {
+			merged[k] = v
+		}
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, attributesKey{}, merged)
+}
+
+// AttributesFromContext collects the evaluation attributes from the context. The device id and
+// client version are taken from the common context keys.
+func AttributesFromContext(ctx context.Context) Attributes {
+	attrs := make(Attributes)
+	if custom, ok := ctx.Value(attributesKey{}).(Attributes); ok {
+		for k, v := range custom {
+			attrs[k] = v
+		}
+	}
+	if deviceId := commonCtx.GetStringValue(ctx, commonCtx.DeviceIdKey); deviceId != "" {
+		attrs[DeviceIdAttribute] = deviceId
+	}
+	if clientVersion := commonCtx.GetStringValue(ctx, commonCtx.ClientVersionKey); clientVersion != "" {
+		attrs[ClientVersionAttribute] = clientVersion
+	}
+
+	return attrs
+}
+
+func NewEvaluator(ctx context.Context, source ConfigSource, opts ...Option) (*Evaluator, error) {
+	if source == nil {
+		return nil, fmt.Errorf("config source cannot be nil")
+	}
+
+	evaluator := &Evaluator{
+		source:      source,
+		propertyKey: DefaultPropertyKey,
+		logger:      &logger.NoopLogger{},
+		events:      &event.NoopEmitter{},
+	}
+
+	for _, opt := range opts {
+		if err := opt(ctx, evaluator); err != nil {
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	return evaluator, nil
+}
+
+// Evaluate returns the value of the flag with the given key for the attributes in ctx. The
+// default value is returned if the flag does not exist, is invalid or does not resolve to a
+// variation.
+func (e *Evaluator) Evaluate(ctx context.Context, key string, defaultValue interface{}) interface{} {
+	return e.EvaluateDetail(ctx, key, defaultValue).Value
+}
+
+// Bool evaluates the flag and returns its value as a bool. The default value is returned if
+// the resolved value is not a bool.
+func (e *Evaluator) Bool(ctx context.Context, key string, defaultValue bool) bool {
+	if value, ok := e.Evaluate(ctx, key, defaultValue).(bool); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// String evaluates the flag and returns its value as a string. The default value is returned if
+// the resolved value is not a string.
+func (e *Evaluator) String(ctx context.Context, key string, defaultValue string) string {
+	if value, ok := e.Evaluate(ctx, key, defaultValue).(string); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// EvaluateDetail evaluates the flag like Evaluate but also reports which variation was served
+// and why. Every evaluation is emitted as FlagEvaluatedEvent.
+func (e *Evaluator) EvaluateDetail(ctx context.Context, key string, defaultValue interface{}) Evaluation {
+	evaluation := e.evaluate(ctx, key, defaultValue)
+
+	e.events.Push(event.NewEvent(ctx, FlagEvaluatedEvent, event.WithPayload(evaluation)))
+
+	return evaluation
+}
+
+func (e *Evaluator) evaluate(ctx context.Context, key string, defaultValue interface{}) Evaluation {
+	evaluation := Evaluation{Key: key, Value: defaultValue}
+
+	// The source has no config before its first successful refresh.
+	current := e.source.Current()
+	if current == nil {
+		evaluation.Reason = ReasonFlagNotFound
+		return evaluation
+	}
+
+	definitions, ok := current.Properties[e.propertyKey].(map[string]interface{})
+	if !ok {
+		evaluation.Reason = ReasonFlagNotFound
+		return evaluation
+	}
+
+	raw, ok := definitions[key]
+	if !ok {
+		evaluation.Reason = ReasonFlagNotFound
+		return evaluation
+	}
+
+	flag, err := parseFlag(raw)
+	if err != nil {
+		e.logger.Warn("invalid flag definition", "key", key, "error", err)
+		evaluation.Reason = ReasonError
+		return evaluation
+	}
+
+	if !flag.Enabled {
+		evaluation.Reason = ReasonOff
+		return resolve(evaluation, flag, flag.OffVariation)
+	}
+
+	attrs := AttributesFromContext(ctx)
+	for i, rule := range flag.Rules {
+		if rule.matches(attrs) {
+			evaluation.Reason = ReasonRuleMatch
+			evaluation.RuleIndex = &i
+			return resolve(evaluation, flag, e.variationFor(key, flag, rule.Target, attrs))
+		}
+	}
+
+	evaluation.Reason = ReasonFallthrough
+	return resolve(evaluation, flag, e.variationFor(key, flag, flag.Fallthrough, attrs))
+}
+
+func (e *Evaluator) variationFor(key string, flag *Flag, target Target, attrs Attributes) string {
+	if target.Rollout == nil {
+		return target.Variation
+	}
+
+	bucketBy := target.Rollout.BucketBy
+	if bucketBy == "" {
+		bucketBy = DeviceIdAttribute
+	}
+
+	value, ok := attrs[bucketBy]
+	if !ok {
+		e.logger.Debug("missing rollout attribute", "key", key, "attribute", bucketBy)
+		return ""
+	}
+
+	return target.Rollout.variationFor(bucket(key, flag.Salt, value))
+}
+
+func resolve(evaluation Evaluation, flag *Flag, variation string) Evaluation {
+	if variation == "" {
+		return evaluation
+	}
+
+	evaluation.Variation = variation
+	evaluation.Value = flag.Variations[variation]
+	return evaluation
+}
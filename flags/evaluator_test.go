@@ -0,0 +1,251 @@
+package flags_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/config"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/flags"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticSource struct {
+	config *config.Config
+}
+
+func (s *staticSource) Current() *config.Config {
+	return s.config
+}
+
+func newSource(t *testing.T, definitions string) *staticSource {
+	var properties config.Properties
+	require.NoError(t, json.Unmarshal([]byte(`{"flags": `+definitions+`}`), &properties))
+	return &staticSource{config: &config.Config{Properties: properties}}
+}
+
+func deviceCtx(deviceId, clientVersion string) context.Context {
+	ctx := context.WithValue(context.Background(), commonCtx.DeviceIdKey, deviceId)
+	return context.WithValue(ctx, commonCtx.ClientVersionKey, clientVersion)
+}
+
+func TestEvaluator_Evaluate(t *testing.T) {
+	source := newSource(t, `{
+		"simple": true,
+		"disabled": {
+			"enabled": false,
+			"variations": {"on": true, "off": false},
+			"offVariation": "off",
+			"fallthrough": {"variation": "on"}
+		},
+		"theme": {
+			"enabled": true,
+			"variations": {"light": "light", "dark": "dark", "beta": "beta"},
+			"rules": [
+				{"clauses": [{"attribute": "deviceId", "operator": "in", "values": ["device-1", "device-2"]}], "variation": "beta"},
+				{"clauses": [{"attribute": "clientVersion", "operator": "versionGte", "values": ["2.0.0"]}, {"attribute": "site", "operator": "startsWith", "values": ["eu-"]}], "variation": "dark"}
+			],
+			"fallthrough": {"variation": "light"}
+		},
+		"invalid": {"enabled": true, "variations": {}}
+	}`)
+
+	evaluator, err := flags.NewEvaluator(context.Background(), source)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		key          string
+		defaultValue interface{}
+		want         interface{}
+		wantReason   flags.Reason
+	}{
+		{
+			name:         "plain boolean flag",
+			ctx:          context.Background(),
+			key:          "simple",
+			defaultValue: false,
+			want:         true,
+			wantReason:   flags.ReasonFallthrough,
+		},
+		{
+			name:         "disabled flag serves off variation",
+			ctx:          context.Background(),
+			key:          "disabled",
+			defaultValue: true,
+			want:         false,
+			wantReason:   flags.ReasonOff,
+		},
+		{
+			name:         "unknown flag returns default",
+			ctx:          context.Background(),
+			key:          "unknown",
+			defaultValue: "fallback",
+			want:         "fallback",
+			wantReason:   flags.ReasonFlagNotFound,
+		},
+		{
+			name:         "invalid flag returns default",
+			ctx:          context.Background(),
+			key:          "invalid",
+			defaultValue: "fallback",
+			want:         "fallback",
+			wantReason:   flags.ReasonError,
+		},
+		{
+			name:         "device id rule",
+			ctx:          deviceCtx("device-2", "1.0.0"),
+			key:          "theme",
+			defaultValue: "none",
+			want:         "beta",
+			wantReason:   flags.ReasonRuleMatch,
+		},
+		{
+			name:         "version and custom attribute rule",
+			ctx:          flags.WithAttributes(deviceCtx("device-9", "v2.1.0"), flags.Attributes{"site": "eu-west"}),
+			key:          "theme",
+			defaultValue: "none",
+			want:         "dark",
+			wantReason:   flags.ReasonRuleMatch,
+		},
+		{
+			name:         "version rule without custom attribute falls through",
+			ctx:          deviceCtx("device-9", "2.1.0"),
+			key:          "theme",
+			defaultValue: "none",
+			want:         "light",
+			wantReason:   flags.ReasonFallthrough,
+		},
+		{
+			name:         "older version falls through",
+			ctx:          flags.WithAttributes(deviceCtx("device-9", "1.9.9"), flags.Attributes{"site": "eu-west"}),
+			key:          "theme",
+			defaultValue: "none",
+			want:         "light",
+			wantReason:   flags.ReasonFallthrough,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// when
+			evaluation := evaluator.EvaluateDetail(tt.ctx, tt.key, tt.defaultValue)
+
+			// then
+			assert.Equal(t, tt.want, evaluation.Value)
+			assert.Equal(t, tt.wantReason, evaluation.Reason)
+		})
+	}
+}
+
+func TestEvaluator_ReportsRuleIndex(t *testing.T) {
+	// given
+	source := newSource(t, `{
+		"theme": {
+			"enabled": true,
+			"variations": {"light": "light", "beta": "beta"},
+			"rules": [{"clauses": [{"attribute": "deviceId", "operator": "in", "values": ["device-1"]}], "variation": "beta"}],
+			"fallthrough": {"variation": "light"}
+		}
+	}`)
+	evaluator, err := flags.NewEvaluator(context.Background(), source)
+	require.NoError(t, err)
+
+	// when
+	matched, err := json.Marshal(evaluator.EvaluateDetail(deviceCtx("device-1", "1.0.0"), "theme", "none"))
+	require.NoError(t, err)
+	unmatched, err := json.Marshal(evaluator.EvaluateDetail(deviceCtx("device-2", "1.0.0"), "theme", "none"))
+	require.NoError(t, err)
+
+	// then
+	assert.JSONEq(t, `{"key":"theme","value":"beta","variation":"beta","reason":"rule_match","ruleIndex":0}`, string(matched))
+	assert.JSONEq(t, `{"key":"theme","value":"light","variation":"light","reason":"fallthrough"}`, string(unmatched))
+}
+
+func TestEvaluator_Rollout(t *testing.T) {
+	// given
+	source := newSource(t, `{
+		"rollout": {
+			"enabled": true,
+			"variations": {"on": true, "off": false},
+			"fallthrough": {"rollout": {"variations": [{"variation": "on", "weight": 25}, {"variation": "off", "weight": 75}]}}
+		}
+	}`)
+
+	evaluator, err := flags.NewEvaluator(context.Background(), source)
+	require.NoError(t, err)
+
+	// when
+	enabled := 0
+	for i := 0; i < 2000; i++ {
+		ctx := deviceCtx(fmt.Sprintf("device-%d", i), "1.0.0")
+		first := evaluator.Bool(ctx, "rollout", false)
+		second := evaluator.Bool(ctx, "rollout", false)
+
+		require.Equal(t, first, second, "evaluation must be deterministic")
+		if first {
+			enabled++
+		}
+	}
+
+	// then
+	assert.InDelta(t, 500, enabled, 100, "roughly a quarter of the devices should be enabled")
+
+	// when
+	withoutDevice := evaluator.EvaluateDetail(context.Background(), "rollout", "default")
+
+	// then
+	assert.Equal(t, "default", withoutDevice.Value, "missing bucket attribute should return default")
+}
+
+func TestEvaluator_EmitsEvents(t *testing.T) {
+	// given
+	emitter := event.NewBufferedEmitter(event.BufferedEmitterConfig{BufferSize: 10})
+	defer emitter.Close(context.Background())
+
+	evaluator, err := flags.NewEvaluator(context.Background(), newSource(t, `{"simple": true}`), flags.WithEventEmitter(emitter))
+	require.NoError(t, err)
+
+	// when
+	evaluator.Bool(deviceCtx("device-1", "1.0.0"), "simple", false)
+
+	// then
+	require.Eventually(t, func() bool {
+		events := emitter.PollEvents()
+		if len(events) != 1 {
+			return false
+		}
+
+		evt := events[0]
+		return evt.Type == flags.FlagEvaluatedEvent &&
+			evt.SchemaVersion == 1 &&
+			evt.DeviceId == "device-1" &&
+			evt.Data["key"] == "simple" &&
+			evt.Data["variation"] == "on" &&
+			evt.Data["value"] == true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestEvaluator_NoConfig(t *testing.T) {
+	// given
+	evaluator, err := flags.NewEvaluator(context.Background(), &staticSource{})
+	require.NoError(t, err)
+
+	// when
+	evaluation := evaluator.EvaluateDetail(context.Background(), "simple", "default")
+
+	// then
+	assert.Equal(t, "default", evaluation.Value)
+	assert.Equal(t, flags.ReasonFlagNotFound, evaluation.Reason)
+}
+
+func TestNewEvaluator_NilSource(t *testing.T) {
+	_, err := flags.NewEvaluator(context.Background(), nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package flags
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type (
+	// Flag is the definition of a single feature flag as it is served inside the config properties.
+	Flag struct {
+		Enabled      bool                   `json:"enabled"`
+		Variations   map[string]interface{} `json:"variations"`
+		OffVariation string                 `json:"offVariation,omitempty"`
+		Salt         string                 `json:"salt,omitempty"`
+		Rules        []Rule                 `json:"rules,omitempty"`
+		Fallthrough  Target                 `json:"fallthrough"`
+	}
+
+	// Rule serves its Target when all of its clauses match the evaluation attributes.
+	Rule struct {
+		Clauses []Clause `json:"clauses"`
+		Target
+	}
+
+	// Clause compares a single attribute against a list of values using the given operator.
+	Clause struct {
+		Attribute string   `json:"attribute"`
+		Operator  Operator `json:"operator"`
+		Values    []string `json:"values"`
+		Negate    bool     `json:"negate,omitempty"`
+	}
+
+	// Target either serves a fixed variation or splits the audience with a percentage rollout.
+	Target struct {
+		Variation string   `json:"variation,omitempty"`
+		Rollout   *Rollout `json:"rollout,omitempty"`
+	}
+
+	// Rollout distributes the audience across variations. The weights are given in percent and
+	// the bucket is derived from the value of BucketBy, which defaults to the device id.
+	Rollout struct {
+		BucketBy   string              `json:"bucketBy,omitempty"`
+		Variations []WeightedVariation `json:"variations"`
+	}
+
+	WeightedVariation struct {
+		Variation string  `json:"variation"`
+		Weight    float64 `json:"weight"`
+	}
+)
+
+// parseFlag converts a raw config property into a Flag. A plain boolean is treated as a
+// simple on/off flag so that existing boolean properties keep working.
+func parseFlag(raw interface{}) (*Flag, error) {
+	if value, ok := raw.(bool); ok {
+		variation := "off"
+		if value {
+			variation = "on"
+		}
+
+		return &Flag{
+			Enabled:     true,
+			Variations:  map[string]interface{}{"on": true, "off": false},
+			Fallthrough: Target{Variation: variation},
+		}, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal flag definition: %w", err)
+	}
+
+	var flag Flag
+	if err := json.Unmarshal(data, &flag); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal flag definition: %w", err)
+	}
+
+	if err := flag.validate(); err != nil {
+		return nil, err
+	}
+
+	return &flag, nil
+}
+
+func (f *Flag) validate() error {
+	if len(f.Variations) == 0 {
+		return fmt.Errorf("flag has no variations")
+	}
+	if f.OffVariation != "" {
+		if _, ok := f.Variations[f.OffVariation]; !ok {
+			return fmt.Errorf("unknown off variation %q", f.OffVariation)
+		}
+	}
+
+	targets := []Target{f.Fallthrough}
+	for _, rule := range f.Rules {
+		targets = append(targets, rule.Target)
+	}
+
+	for _, target := range targets {
+		if err := target.validate(f.Variations); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t Target) validate(variations map[string]interface{}) error {
+	if t.Rollout == nil {
+		if t.Variation == "" {
+			return nil
+		}
+		if _, ok := variations[t.Variation]; !ok {
+			return fmt.Errorf("unknown variation %q", t.Variation)
+		}
+		return nil
+	}
+
+	var total float64
+	for _, wv := range t.Rollout.Variations {
+		if _, ok := variations[wv.Variation]; !ok {
+			return fmt.Errorf("unknown rollout variation %q", wv.Variation)
+		}
+		if wv.Weight < 0 {
+			return fmt.Errorf("rollout weight of variation %q cannot be negative", wv.Variation)
+		}
+		total += wv.Weight
+	}
+	if total > 100 {
+		return fmt.Errorf("rollout weights must not exceed 100, got %v", total)
+	}
+
+	return nil
+}
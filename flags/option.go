@@ -0,0 +1,42 @@
+package flags
+
+import (
+	"context"
+	"errors"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type Option func(context.Context, *Evaluator) error
+
+// WithPropertyKey sets the config property the flag definitions are read from.
+func WithPropertyKey(key string) Option {
+	return func(ctx context.Context, evaluator *Evaluator) error {
+		if key == "" {
+			return errors.New("property key cannot be empty")
+		}
+		evaluator.propertyKey = key
+		return nil
+	}
+}
+
+func WithEventEmitter(emitter event.Emitter) Option {
+	return func(ctx context.Context, evaluator *Evaluator) error {
+		if emitter == nil {
+			return errors.New("event emitter is not provided")
+		}
+		evaluator.events = emitter
+		return nil
+	}
+}
+
+func WithLogger(factory logger.Factory) Option {
+	return func(ctx context.Context, evaluator *Evaluator) error {
+		if factory == nil {
+			return errors.New("logger is not provided")
+		}
+		evaluator.logger = factory(ctx)
+		return nil
+	}
+}
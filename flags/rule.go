@@ -0,0 +1,92 @@
+package flags
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"strings"
+
+	"github.com/dtomschitz/headless-go-client/common/version"
+)
+
+type Operator string
+
+const (
+	OperatorIn         Operator = "in"
+	OperatorContains   Operator = "contains"
+	OperatorStartsWith Operator = "startsWith"
+	OperatorEndsWith   Operator = "endsWith"
+	OperatorVersionGte Operator = "versionGte"
+	OperatorVersionLt  Operator = "versionLt"
+)
+
+// bucketScale is the resolution of a rollout bucket. A scale of 10000 allows weights with
+// two decimal places, e.g. 0.25%.
+const bucketScale = 10000
+
+// matches reports whether every clause of the rule matches the given attributes.
+func (r Rule) matches(attrs Attributes) bool {
+	for _, clause := range r.Clauses {
+		if !clause.matches(attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Clause) matches(attrs Attributes) bool {
+	value, ok := attrs[c.Attribute]
+	if !ok {
+		return false
+	}
+
+	matched := false
+	for _, candidate := range c.Values {
+		if matchOperator(c.Operator, value, candidate) {
+			matched = true
+			break
+		}
+	}
+
+	if c.Negate {
+		return !matched
+	}
+	return matched
+}
+
+func matchOperator(op Operator, value, candidate string) bool {
+	switch op {
+	case OperatorIn:
+		return value == candidate
+	case OperatorContains:
+		return strings.Contains(value, candidate)
+	case OperatorStartsWith:
+		return strings.HasPrefix(value, candidate)
+	case OperatorEndsWith:
+		return strings.HasSuffix(value, candidate)
+	case OperatorVersionGte:
+		return version.Compare(value, candidate) >= 0
+	case OperatorVersionLt:
+		return version.Compare(value, candidate) < 0
+	default:
+		return false
+	}
+}
+
+// bucket deterministically maps the given value to a bucket in [0, bucketScale).
+func bucket(flagKey, salt, value string) int {
+	sum := sha1.Sum([]byte(flagKey + "." + salt + "." + value))
+	return int(binary.BigEndian.Uint32(sum[:4]) % bucketScale)
+}
+
+// variationFor returns the variation of the rollout the given bucket falls into. An empty
+// string is returned if the weights do not cover the bucket.
+func (r *Rollout) variationFor(b int) string {
+	var upper float64
+	for _, wv := range r.Variations {
+		upper += wv.Weight * bucketScale / 100
+		if float64(b) < upper {
+			return wv.Variation
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package identity
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+type (
+	// Credentials are issued by the backend on enrollment. Depending on the backend they
+	// contain a client certificate, a token used as HMAC secret, or both.
+	Credentials struct {
+		// Certificate is the PEM encoded client certificate for the device key.
+		Certificate string `json:"certificate,omitempty"`
+		// Token is the secret the device signs its requests with.
+		Token     string    `json:"token,omitempty"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+
+	// EnrollmentRequest is sent to the enrollment endpoint on first boot and whenever the
+	// credentials are rotated. Rotations authenticate with the current token.
+	EnrollmentRequest struct {
+		DeviceId string `json:"deviceId"`
+		// CSR is the PEM encoded certificate signing request for the device key with the device
+		// id as common name. Its signature proves possession of the key.
+		CSR string `json:"csr"`
+	}
+)
+
+// DeviceIdFromPublicKey derives the device id from the SHA-256 hash of the PKIX encoding of the
+// public key. The id stays stable when the key is rotated later on, as it is persisted.
+func DeviceIdFromPublicKey(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// Valid reports whether the credentials can be used at the given time.
+func (c *Credentials) Valid(now time.Time) bool {
+	return c != nil && (c.Certificate != "" || c.Token != "") && now.Before(c.ExpiresAt)
+}
+
+func generateKey() (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device key: %w", err)
+	}
+	return key, nil
+}
+
+func newCSR(deviceId string, key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: deviceId},
+	}, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to create certificate signing request: %w", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})), nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode device key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func decodeKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("device key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device key: %w", err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("device key must be an ECDSA key but is %T", key)
+	}
+	return ecKey, nil
+}
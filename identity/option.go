@@ -0,0 +1,67 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type Option func(context.Context, *Service) error
+
+// WithHTTPClient sets the client used to enroll the device.
+func WithHTTPClient(client *http.Client) Option {
+	return func(ctx context.Context, service *Service) error {
+		if client == nil {
+			return errors.New("http client is not provided")
+		}
+		service.client = client
+		return nil
+	}
+}
+
+// WithRenewBefore rotates the credentials the given duration before they expire. By default
+// they are rotated after two thirds of their lifetime.
+func WithRenewBefore(renewBefore time.Duration) Option {
+	return func(ctx context.Context, service *Service) error {
+		if renewBefore <= 0 {
+			return errors.New("renew before must be greater than 0")
+		}
+		service.renewBefore = renewBefore
+		return nil
+	}
+}
+
+// WithRetryInterval sets the interval in which failed enrollments are retried.
+func WithRetryInterval(retryInterval time.Duration) Option {
+	return func(ctx context.Context, service *Service) error {
+		if retryInterval <= 0 {
+			return errors.New("retry interval must be greater than 0")
+		}
+		service.retryInterval = retryInterval
+		return nil
+	}
+}
+
+func WithEventEmitter(emitter event.Emitter) Option {
+	return func(ctx context.Context, service *Service) error {
+		if emitter == nil {
+			return errors.New("event emitter is not provided")
+		}
+		service.events = emitter
+		return nil
+	}
+}
+
+func WithLogger(factory logger.Factory) Option {
+	return func(ctx context.Context, service *Service) error {
+		if factory == nil {
+			return errors.New("logger is not provided")
+		}
+		service.logger = factory(ctx)
+		return nil
+	}
+}
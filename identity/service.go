@@ -0,0 +1,376 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type (
+	// Service provides the identity of the device. On first boot it generates a key pair,
+	// derives the device id from it and enrolls against the backend. The credentials are
+	// persisted and rotated together with the key before they expire.
+	Service struct {
+		enrollURL     string
+		renewBefore   time.Duration
+		retryInterval time.Duration
+
+		store  *fileStore
+		client *http.Client
+		logger logger.Logger
+		events event.Emitter
+
+		// renewMu serializes enrollments.
+		renewMu  sync.Mutex
+		mu       sync.RWMutex
+		deviceId string
+		key      *ecdsa.PrivateKey
+		stored   *storedIdentity
+
+		renew chan struct{}
+		// enrolled is closed once the device holds valid credentials.
+		enrolled       chan struct{}
+		enrolledOnce   sync.Once
+		internalCtx    context.Context
+		internalCancel context.CancelFunc
+		wg             sync.WaitGroup
+		shutdownOnce   sync.Once
+	}
+
+	// EnrollmentPayload is the payload of DeviceEnrolledEvent and CredentialsRotatedEvent.
+	EnrollmentPayload struct {
+		DeviceId  string    `json:"deviceId"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+)
+
+const (
+	ServiceName = "IdentityService"
+
+	DeviceEnrolledEvent     event.EventType = "device_enrolled"
+	CredentialsRotatedEvent event.EventType = "credentials_rotated"
+)
+
+func init() {
+	event.MustRegisterPayload(DeviceEnrolledEvent, 1, EnrollmentPayload{})
+	event.MustRegisterPayload(CredentialsRotatedEvent, 1, EnrollmentPayload{})
+	event.RegisterPriority(DeviceEnrolledEvent, event.PriorityLifecycle)
+	event.RegisterPriority(CredentialsRotatedEvent, event.PriorityLifecycle)
+}
+
+// NewService loads the identity persisted in dir or creates a new one. Devices without valid
+// credentials are enrolled in the background, as the device id is available without the
+// backend. Enrollment is retried until it succeeds, Enrolled reports when it did.
+func NewService(ctx context.Context, enrollURL string, dir string, opts ...Option) (*Service, error) {
+	internalCtx, internalCancel := context.WithCancel(ctx)
+	internalCtx = context.WithValue(internalCtx, commonCtx.ServiceKey, ServiceName)
+
+	if enrollURL == "" {
+		internalCancel()
+		return nil, errors.New("enrollment url cannot be empty")
+	}
+
+	store, err := newFileStore(dir)
+	if err != nil {
+		internalCancel()
+		return nil, err
+	}
+
+	service := &Service{
+		enrollURL:      enrollURL,
+		retryInterval:  time.Minute,
+		store:          store,
+		client:         commonHttp.NewClient(),
+		logger:         &logger.NoopLogger{},
+		events:         &event.NoopEmitter{},
+		renew:          make(chan struct{}, 1),
+		enrolled:       make(chan struct{}),
+		internalCtx:    internalCtx,
+		internalCancel: internalCancel,
+	}
+
+	for _, opt := range opts {
+		if err := opt(internalCtx, service); err != nil {
+			internalCancel()
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	if err := service.loadOrCreate(); err != nil {
+		internalCancel()
+		return nil, err
+	}
+
+	if service.stored.Credentials.Valid(time.Now()) {
+		service.markEnrolled()
+	}
+
+	service.start(internalCtx)
+	service.logger.Info("started service successfully", "deviceId", service.deviceId)
+
+	return service, nil
+}
+
+// loadOrCreate loads the persisted identity or generates the key pair and device id of a new
+// device.
+func (s *Service) loadOrCreate() error {
+	stored, key, err := s.store.load()
+	if err != nil {
+		return err
+	}
+
+	if key == nil {
+		if key, err = generateKey(); err != nil {
+			return err
+		}
+	}
+
+	if stored == nil || stored.DeviceId == "" {
+		deviceId, err := DeviceIdFromPublicKey(key.Public())
+		if err != nil {
+			return err
+		}
+
+		stored = &storedIdentity{DeviceId: deviceId}
+		if err := s.store.save(stored, key); err != nil {
+			return err
+		}
+		s.logger.Info("created device identity", "deviceId", deviceId)
+	}
+
+	s.deviceId, s.key, s.stored = stored.DeviceId, key, stored
+	return nil
+}
+
+func (s *Service) start(ctx context.Context) {
+	s.wg.Add(1)
+	go func() {
+		defer recovery.Recover(ServiceName)
+		defer s.wg.Done()
+
+		select {
+		case <-s.enrolled:
+		default:
+			if err := s.Renew(ctx); err != nil {
+				s.logger.Warn("failed to enroll device, retrying in background", "error", err)
+			}
+		}
+
+		for {
+			timer := time.NewTimer(s.nextRenewal(time.Now()))
+
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				s.logger.Warn("stopped service because context was cancelled")
+				return
+			case <-s.renew:
+				timer.Stop()
+			case <-timer.C:
+				if err := s.Renew(ctx); err != nil {
+					s.logger.Error("failed to rotate credentials", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// nextRenewal returns the time until the credentials have to be rotated. Unless configured
+// otherwise, credentials are rotated after two thirds of their lifetime.
+func (s *Service) nextRenewal(now time.Time) time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	credentials := s.stored.Credentials
+	if !credentials.Valid(now) {
+		return s.retryInterval
+	}
+
+	renewBefore := s.renewBefore
+	if renewBefore <= 0 {
+		renewBefore = credentials.ExpiresAt.Sub(s.stored.IssuedAt) / 3
+	}
+
+	wait := credentials.ExpiresAt.Add(-renewBefore).Sub(now)
+	if wait <= 0 {
+		// The last rotation failed, the current credentials are still valid.
+		return s.retryInterval
+	}
+	return wait
+}
+
+// Renew enrolls the device with a new key pair and replaces the credentials on success. The
+// previous key and credentials are kept if the enrollment fails.
+func (s *Service) Renew(ctx context.Context) error {
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+
+	s.mu.RLock()
+	deviceId, current := s.deviceId, s.stored.Credentials
+	s.mu.RUnlock()
+
+	eventType := CredentialsRotatedEvent
+	if current == nil {
+		eventType = DeviceEnrolledEvent
+	}
+
+	key := s.key
+	if current != nil {
+		var err error
+		if key, err = generateKey(); err != nil {
+			return err
+		}
+	}
+
+	credentials, err := s.enroll(ctx, deviceId, key, current)
+	if err != nil {
+		s.events.Push(event.NewEventFromError(s.Context(ctx), eventType, err))
+		return err
+	}
+
+	stored := &storedIdentity{DeviceId: deviceId, Credentials: credentials, IssuedAt: time.Now()}
+	if err := s.store.save(stored, key); err != nil {
+		s.events.Push(event.NewEventFromError(s.Context(ctx), eventType, err))
+		return err
+	}
+
+	s.mu.Lock()
+	s.key, s.stored = key, stored
+	s.mu.Unlock()
+	s.markEnrolled()
+
+	select {
+	case s.renew <- struct{}{}:
+	default:
+	}
+
+	s.events.Push(event.NewEvent(s.Context(ctx), eventType,
+		event.WithPayload(EnrollmentPayload{DeviceId: deviceId, ExpiresAt: credentials.ExpiresAt})))
+	s.logger.Info("received device credentials", "deviceId", deviceId, "expiresAt", credentials.ExpiresAt)
+	return nil
+}
+
+func (s *Service) enroll(ctx context.Context, deviceId string, key *ecdsa.PrivateKey, current *Credentials) (*Credentials, error) {
+	csr, err := newCSR(deviceId, key)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(EnrollmentRequest{DeviceId: deviceId, CSR: csr})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode enrollment request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.enrollURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if current != nil && current.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+current.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll device: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("enrollment failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+
+	var credentials Credentials
+	if err := json.NewDecoder(resp.Body).Decode(&credentials); err != nil {
+		return nil, fmt.Errorf("failed to decode credentials: %w", err)
+	}
+	if !credentials.Valid(time.Now()) {
+		return nil, errors.New("backend issued no valid credentials")
+	}
+
+	return &credentials, nil
+}
+
+func (s *Service) markEnrolled() {
+	s.enrolledOnce.Do(func() { close(s.enrolled) })
+}
+
+// Enrolled returns a channel that is closed once the device holds valid credentials.
+func (s *Service) Enrolled() <-chan struct{} {
+	return s.enrolled
+}
+
+// DeviceId returns the stable id of the device.
+func (s *Service) DeviceId() string {
+	return s.deviceId
+}
+
+// Credentials returns the current credentials, if the device has been enrolled.
+func (s *Service) Credentials() (Credentials, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.stored.Credentials == nil {
+		return Credentials{}, false
+	}
+	return *s.stored.Credentials, true
+}
+
+// Context returns a context carrying the device id, which is sent by the ContextHeaderTransport
+// and attached to events by event.NewEvent.
+func (s *Service) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commonCtx.DeviceIdKey, s.deviceId)
+}
+
+// HTTPOptions returns the options of commonHttp.NewClient that authenticate requests with the
+// credentials of the device. Rotated credentials are used without recreating the client. The
+// options depend on the kind of credentials issued, so they should be requested once Enrolled
+// is closed.
+func (s *Service) HTTPOptions() []commonHttp.Option {
+	credentials, enrolled := s.Credentials()
+
+	var opts []commonHttp.Option
+	if !enrolled || credentials.Token != "" {
+		opts = append(opts, commonHttp.WithHMACFunc(func() commonHttp.HMACCredentials {
+			credentials, _ := s.Credentials()
+			return commonHttp.HMACCredentials{DeviceId: s.deviceId, Secret: []byte(credentials.Token)}
+		}))
+	}
+	if credentials.Certificate != "" {
+		opts = append(opts, commonHttp.WithClientCertificate(s.store.certificatePath(), s.store.keyPath()))
+	}
+	return opts
+}
+
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+func (s *Service) PollEvents() []*event.Event {
+	return s.events.PollEvents()
+}
+
+func (s *Service) Close(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		if s.internalCancel != nil {
+			s.internalCancel()
+		}
+	})
+
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,255 @@
+package identity_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/identity"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type (
+	// enrollmentServer issues certificates signed by its own CA and tokens with the configured
+	// lifetime. It answers with 503 as long as failures is greater than zero.
+	enrollmentServer struct {
+		*httptest.Server
+		lifetime time.Duration
+
+		mu       sync.Mutex
+		ca       *x509.Certificate
+		caKey    *ecdsa.PrivateKey
+		failures int
+		requests []enrollment
+	}
+
+	enrollment struct {
+		DeviceId      string
+		Authorization string
+		PublicKey     any
+	}
+)
+
+func (s *enrollmentServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req identity.EnrollmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		http.Error(w, "csr is not PEM encoded", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil || csr.Subject.CommonName != req.DeviceId {
+		http.Error(w, "invalid csr", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.ca == nil {
+		if s.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "test ca"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, s.caKey.Public(), s.caKey)
+		if err == nil {
+			s.ca, err = x509.ParseCertificate(der)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.requests = append(s.requests, enrollment{DeviceId: req.DeviceId, Authorization: r.Header.Get("Authorization"), PublicKey: csr.PublicKey})
+
+	expiresAt := time.Now().Add(s.lifetime)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.requests) + 1)),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     expiresAt,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, s.ca, csr.PublicKey, s.caKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(identity.Credentials{
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		Token:       "token-" + string(rune('0'+len(s.requests))),
+		ExpiresAt:   expiresAt,
+	})
+}
+
+func (s *enrollmentServer) enrollments() []enrollment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]enrollment(nil), s.requests...)
+}
+
+func TestService_EnrollsOnFirstBoot(t *testing.T) {
+	// given
+	server := &enrollmentServer{lifetime: time.Hour}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	dir := filepath.Join(t.TempDir(), "identity")
+
+	// when
+	service, err := identity.NewService(context.Background(), server.URL, dir)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	// then
+	select {
+	case <-service.Enrolled():
+	case <-time.After(time.Second):
+		t.Fatal("expected device to be enrolled")
+	}
+
+	enrollments := server.enrollments()
+	require.Len(t, enrollments, 1)
+	assert.Empty(t, enrollments[0].Authorization)
+
+	expectedId, err := identity.DeviceIdFromPublicKey(enrollments[0].PublicKey)
+	require.NoError(t, err)
+	assert.Equal(t, expectedId, service.DeviceId())
+
+	credentials, ok := service.Credentials()
+	require.True(t, ok)
+	assert.Equal(t, "token-1", credentials.Token)
+	assert.Len(t, service.HTTPOptions(), 2)
+	assert.Equal(t, service.DeviceId(), commonCtx.GetStringValue(service.Context(context.Background()), commonCtx.DeviceIdKey))
+
+	for _, name := range []string{"key.pem", "cert.pem", "identity.json"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), name)
+	}
+}
+
+func TestService_DoesNotBlockOnUnreachableBackend(t *testing.T) {
+	// given
+	server := &enrollmentServer{lifetime: time.Hour, failures: 1}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+
+	// when
+	service, err := identity.NewService(context.Background(), server.URL, t.TempDir(), identity.WithRetryInterval(time.Hour))
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	// then
+	assert.NotEmpty(t, service.DeviceId())
+	select {
+	case <-service.Enrolled():
+		t.Fatal("expected device not to be enrolled")
+	default:
+	}
+}
+
+func TestService_LoadsPersistedIdentity(t *testing.T) {
+	// given
+	server := &enrollmentServer{lifetime: time.Hour}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+	dir := t.TempDir()
+
+	first, err := identity.NewService(context.Background(), server.URL, dir)
+	require.NoError(t, err)
+	<-first.Enrolled()
+	first.Close(context.Background())
+
+	// when
+	second, err := identity.NewService(context.Background(), server.URL, dir)
+	require.NoError(t, err)
+	defer second.Close(context.Background())
+
+	// then
+	select {
+	case <-second.Enrolled():
+	default:
+		t.Fatal("expected persisted credentials to be valid")
+	}
+	assert.Len(t, server.enrollments(), 1, "expected valid credentials not to be enrolled again")
+	assert.Equal(t, first.DeviceId(), second.DeviceId())
+}
+
+func TestService_RotatesCredentialsBeforeExpiry(t *testing.T) {
+	// given
+	server := &enrollmentServer{lifetime: time.Second}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+
+	// when
+	service, err := identity.NewService(context.Background(), server.URL, t.TempDir(), identity.WithRenewBefore(900*time.Millisecond))
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	// then
+	require.Eventually(t, func() bool { return len(server.enrollments()) >= 2 }, 2*time.Second, 10*time.Millisecond)
+
+	enrollments := server.enrollments()
+	assert.Equal(t, "Bearer token-1", enrollments[1].Authorization)
+	assert.Equal(t, service.DeviceId(), enrollments[1].DeviceId, "expected device id to survive key rotation")
+	assert.NotEqual(t, enrollments[0].PublicKey, enrollments[1].PublicKey)
+}
+
+func TestService_RetriesFailedEnrollment(t *testing.T) {
+	// given
+	server := &enrollmentServer{lifetime: time.Hour, failures: 1}
+	server.Server = httptest.NewServer(server)
+	defer server.Close()
+
+	// when
+	service, err := identity.NewService(context.Background(), server.URL, t.TempDir(), identity.WithRetryInterval(20*time.Millisecond))
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+
+	// then
+	assert.NotEmpty(t, service.DeviceId())
+	select {
+	case <-service.Enrolled():
+	case <-time.After(time.Second):
+		t.Fatal("expected enrollment to be retried")
+	}
+	_, ok := service.Credentials()
+	assert.True(t, ok)
+}
@@ -0,0 +1,138 @@
+package identity
+
+import (
+	"crypto/ecdsa"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type (
+	// fileStore persists the identity in a directory only accessible by the current user. The
+	// certificate and key are kept as PEM files, so that they can be used for mutual TLS.
+	fileStore struct {
+		dir string
+	}
+
+	storedIdentity struct {
+		DeviceId    string       `json:"deviceId"`
+		Credentials *Credentials `json:"credentials,omitempty"`
+		IssuedAt    time.Time    `json:"issuedAt,omitempty"`
+	}
+)
+
+const (
+	identityFile    = "identity.json"
+	keyFile         = "key.pem"
+	certificateFile = "cert.pem"
+)
+
+func newFileStore(dir string) (*fileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create identity directory: %w", err)
+	}
+	if err := os.Chmod(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to restrict identity directory: %w", err)
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) keyPath() string         { return filepath.Join(s.dir, keyFile) }
+func (s *fileStore) certificatePath() string { return filepath.Join(s.dir, certificateFile) }
+
+// load returns the stored identity and key. Both are nil on first boot.
+func (s *fileStore) load() (*storedIdentity, *ecdsa.PrivateKey, error) {
+	keyData, err := os.ReadFile(s.keyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read device key: %w", err)
+	}
+
+	key, err := decodeKey(keyData)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, identityFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, key, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	var stored storedIdentity
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode identity: %w", err)
+	}
+
+	// A crash during a rotation may leave a certificate of another key behind. It is dropped,
+	// so that the token, if any, can still authenticate the next rotation.
+	if c := stored.Credentials; c != nil && c.Certificate != "" {
+		if _, err := tls.X509KeyPair([]byte(c.Certificate), keyData); err != nil {
+			c.Certificate = ""
+		}
+	}
+
+	return &stored, key, nil
+}
+
+// save writes the key, the certificate and the identity. The key is written first, so that
+// the certificate on disk never belongs to a key that was not persisted.
+func (s *fileStore) save(stored *storedIdentity, key *ecdsa.PrivateKey) error {
+	keyData, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(s.keyPath(), keyData); err != nil {
+		return fmt.Errorf("failed to write device key: %w", err)
+	}
+
+	if c := stored.Credentials; c != nil && c.Certificate != "" {
+		if err := writeFile(s.certificatePath(), []byte(c.Certificate)); err != nil {
+			return fmt.Errorf("failed to write certificate: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode identity: %w", err)
+	}
+	if err := writeFile(filepath.Join(s.dir, identityFile), data); err != nil {
+		return fmt.Errorf("failed to write identity: %w", err)
+	}
+	return nil
+}
+
+// writeFile atomically replaces the file with data readable only by the current user.
+func writeFile(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if err := tmpFile.Chmod(0o600); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,85 @@
+package manifest
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+)
+
+type (
+	// DeviceDescriptor describes the device requesting a manifest so that the backend can serve
+	// device or group specific manifests.
+	DeviceDescriptor struct {
+		DeviceId       string            `json:"deviceId,omitempty"`
+		ClientVersion  string            `json:"clientVersion,omitempty"`
+		Platform       string            `json:"platform,omitempty"`
+		Labels         map[string]string `json:"labels,omitempty"`
+		CurrentVersion string            `json:"currentVersion,omitempty"`
+		CurrentHash    string            `json:"currentHash,omitempty"`
+	}
+
+	currentKey struct{}
+
+	current struct {
+		version string
+		hash    string
+	}
+)
+
+const labelQueryPrefix = "label."
+
+// WithCurrentVersion returns a copy of ctx carrying the version and hash of the artifact that
+// is currently in use, e.g. the active config. It is sent along with manifest requests.
+func WithCurrentVersion(ctx context.Context, version, hash string) context.Context {
+	return context.WithValue(ctx, currentKey{}, current{version: version, hash: hash})
+}
+
+// CurrentVersionFromContext returns the version and hash set by WithCurrentVersion.
+func CurrentVersionFromContext(ctx context.Context) (string, string) {
+	c, _ := ctx.Value(currentKey{}).(current)
+	return c.version, c.hash
+}
+
+// NewDeviceDescriptor builds a descriptor from the common context keys and the current
+// version in ctx.
+func NewDeviceDescriptor(ctx context.Context, platform string, labels map[string]string) *DeviceDescriptor {
+	version, hash := CurrentVersionFromContext(ctx)
+
+	return &DeviceDescriptor{
+		DeviceId:       commonCtx.GetStringValue(ctx, commonCtx.DeviceIdKey),
+		ClientVersion:  commonCtx.GetStringValue(ctx, commonCtx.ClientVersionKey),
+		Platform:       platform,
+		Labels:         labels,
+		CurrentVersion: version,
+		CurrentHash:    hash,
+	}
+}
+
+// Query encodes the descriptor as URL query parameters. Labels are encoded as label.<key>.
+func (d *DeviceDescriptor) Query() url.Values {
+	query := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	set("deviceId", d.DeviceId)
+	set("clientVersion", d.ClientVersion)
+	set("platform", d.Platform)
+	set("currentVersion", d.CurrentVersion)
+	set("currentHash", d.CurrentHash)
+
+	keys := make([]string, 0, len(d.Labels))
+	for k := range d.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		query.Set(labelQueryPrefix+k, d.Labels[k])
+	}
+
+	return query
+}
@@ -13,13 +13,31 @@ type (
 		Version string `json:"version"`
 		Hash    string `json:"hash"`
 		URL     string `json:"url"`
+		Patch   *Patch `json:"patch,omitempty"`
 	}
 
+	// Patch points to a patch that transforms the document of BaseVersion into the document
+	// described by the manifest. Clients on a different version ignore it and fetch URL.
+	Patch struct {
+		BaseVersion string    `json:"baseVersion"`
+		Type        PatchType `json:"type"`
+		URL         string    `json:"url"`
+	}
+
+	PatchType string
+
 	ManifestRequester interface {
 		Fetch(ctx context.Context, url string) (*Manifest, error)
 	}
 )
 
+const (
+	// MergePatch is an RFC 7396 JSON merge patch.
+	MergePatch PatchType = "application/merge-patch+json"
+	// JSONPatch is an RFC 6902 JSON patch.
+	JSONPatch PatchType = "application/json-patch+json"
+)
+
 // Verify verifies the content against the hash in the manifest.
 func (m *Manifest) Verify(content []byte) error {
 	if m.Hash == "" {
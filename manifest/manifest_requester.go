@@ -5,6 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/metrics"
 )
 
 type DefaultManifestRequester struct {
@@ -13,15 +17,17 @@ type DefaultManifestRequester struct {
 
 var _ ManifestRequester = &DefaultManifestRequester{}
 
-// NewDefaultManifestRequester returns a DefaultManifestRequester with a default HTTP client if none provided.
+// NewDefaultManifestRequester returns a DefaultManifestRequester with the common HTTP client if none provided.
 func NewDefaultManifestRequester(client *http.Client) *DefaultManifestRequester {
 	if client == nil {
-		client = http.DefaultClient
+		client = commonHttp.NewClient()
 	}
 	return &DefaultManifestRequester{client: client}
 }
 
 func (r *DefaultManifestRequester) Fetch(ctx context.Context, url string) (*Manifest, error) {
+	defer metrics.DefaultRegistry.Histogram("manifest_fetch_duration_seconds", "Duration of manifest requests in seconds.", nil, nil).ObserveDuration(time.Now())
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
 	"github.com/dtomschitz/headless-go-client/manifest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,6 +45,24 @@ func TestDefaultManifestRequester_Fetch(t *testing.T) {
 		assert.Equal(t, expectedManifest.URL, m.URL)
 	})
 
+	t.Run("file url", func(t *testing.T) {
+		// given
+		path := filepath.Join(t.TempDir(), "manifest.json")
+		require.NoError(t, os.WriteFile(path, []byte(`{"version":"1.2.3","url":"file:///media/usb/config.json"}`), 0o600))
+
+		registry := commonHttp.NewSchemeRegistry()
+		require.NoError(t, registry.Register("file", commonHttp.NewFileTransport()))
+		req := manifest.NewDefaultManifestRequester(commonHttp.NewClient(commonHttp.WithSchemeRegistry(registry)))
+
+		// when
+		m, err := req.Fetch(context.Background(), "file://"+filepath.ToSlash(path))
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, "1.2.3", m.Version)
+		assert.Equal(t, "file:///media/usb/config.json", m.URL)
+	})
+
 	t.Run("unexpected status code", func(t *testing.T) {
 		// given
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
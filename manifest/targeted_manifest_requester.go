@@ -0,0 +1,129 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"runtime"
+	"time"
+
+	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/metrics"
+)
+
+type (
+	// TargetedManifestRequester sends a DeviceDescriptor with every manifest request, either as
+	// query parameters (GET) or as JSON body (POST).
+	TargetedManifestRequester struct {
+		client   *http.Client
+		method   string
+		platform string
+		labels   map[string]string
+	}
+
+	TargetedOption func(*TargetedManifestRequester)
+)
+
+var _ ManifestRequester = &TargetedManifestRequester{}
+
+// WithMethod sets the HTTP method used to send the descriptor. Only GET and POST are supported.
+func WithMethod(method string) TargetedOption {
+	return func(r *TargetedManifestRequester) {
+		r.method = method
+	}
+}
+
+// WithPlatform overrides the reported platform which defaults to GOOS/GOARCH.
+func WithPlatform(platform string) TargetedOption {
+	return func(r *TargetedManifestRequester) {
+		r.platform = platform
+	}
+}
+
+// WithLabels sets static labels describing the device, e.g. its site or hardware revision.
+func WithLabels(labels map[string]string) TargetedOption {
+	return func(r *TargetedManifestRequester) {
+		r.labels = labels
+	}
+}
+
+// NewTargetedManifestRequester returns a TargetedManifestRequester with the common HTTP client if
+// none provided. The descriptor is sent as query parameters unless WithMethod selects POST.
+func NewTargetedManifestRequester(client *http.Client, opts ...TargetedOption) *TargetedManifestRequester {
+	if client == nil {
+		client = commonHttp.NewClient()
+	}
+
+	r := &TargetedManifestRequester{
+		client:   client,
+		method:   http.MethodGet,
+		platform: runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+func (r *TargetedManifestRequester) Fetch(ctx context.Context, rawURL string) (*Manifest, error) {
+	defer metrics.DefaultRegistry.Histogram("manifest_fetch_duration_seconds", "Duration of manifest requests in seconds.", nil, nil).ObserveDuration(time.Now())
+
+	descriptor := NewDeviceDescriptor(ctx, r.platform, r.labels)
+
+	req, err := r.newRequest(ctx, rawURL, descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("get manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	return &m, nil
+}
+
+func (r *TargetedManifestRequester) newRequest(ctx context.Context, rawURL string, descriptor *DeviceDescriptor) (*http.Request, error) {
+	switch r.method {
+	case http.MethodGet:
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+
+		query := u.Query()
+		for k, v := range descriptor.Query() {
+			query[k] = v
+		}
+		u.RawQuery = query.Encode()
+
+		return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	case http.MethodPost:
+		payload, err := json.Marshal(descriptor)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, rawURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	default:
+		return nil, fmt.Errorf("unsupported method %s", r.method)
+	}
+}
@@ -0,0 +1,125 @@
+package manifest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func deviceContext() context.Context {
+	ctx := context.WithValue(context.Background(), commonCtx.DeviceIdKey, "device-1")
+	ctx = context.WithValue(ctx, commonCtx.ClientVersionKey, "1.2.0")
+	return manifest.WithCurrentVersion(ctx, "1.0.0", "sha256:abc")
+}
+
+func TestTargetedManifestRequester_Fetch(t *testing.T) {
+	expectedManifest := manifest.Manifest{
+		Version: "1.0.1",
+		Hash:    "sha256:def",
+		URL:     "http://example.com/config.json",
+	}
+
+	t.Run("descriptor as query", func(t *testing.T) {
+		// given
+		var query map[string][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			query = r.URL.Query()
+			json.NewEncoder(w).Encode(expectedManifest)
+		}))
+		defer server.Close()
+
+		requester := manifest.NewTargetedManifestRequester(nil,
+			manifest.WithPlatform("linux/arm64"),
+			manifest.WithLabels(map[string]string{"site": "berlin"}),
+		)
+
+		// when
+		m, err := requester.Fetch(deviceContext(), server.URL+"/manifest?channel=beta")
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, expectedManifest, *m)
+		assert.Equal(t, map[string][]string{
+			"channel":        {"beta"},
+			"deviceId":       {"device-1"},
+			"clientVersion":  {"1.2.0"},
+			"platform":       {"linux/arm64"},
+			"currentVersion": {"1.0.0"},
+			"currentHash":    {"sha256:abc"},
+			"label.site":     {"berlin"},
+		}, query)
+	})
+
+	t.Run("descriptor as body", func(t *testing.T) {
+		// given
+		var descriptor manifest.DeviceDescriptor
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodPost, r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&descriptor))
+			json.NewEncoder(w).Encode(expectedManifest)
+		}))
+		defer server.Close()
+
+		requester := manifest.NewTargetedManifestRequester(nil,
+			manifest.WithMethod(http.MethodPost),
+			manifest.WithPlatform("linux/arm64"),
+			manifest.WithLabels(map[string]string{"site": "berlin"}),
+		)
+
+		// when
+		m, err := requester.Fetch(deviceContext(), server.URL)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, expectedManifest, *m)
+		assert.Equal(t, manifest.DeviceDescriptor{
+			DeviceId:       "device-1",
+			ClientVersion:  "1.2.0",
+			Platform:       "linux/arm64",
+			Labels:         map[string]string{"site": "berlin"},
+			CurrentVersion: "1.0.0",
+			CurrentHash:    "sha256:abc",
+		}, descriptor)
+	})
+
+	t.Run("records fetch duration", func(t *testing.T) {
+		// given
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(expectedManifest)
+		}))
+		defer server.Close()
+
+		histogram := metrics.DefaultRegistry.Histogram("manifest_fetch_duration_seconds", "", nil, nil)
+		before := histogram.Snapshot().Count
+		requester := manifest.NewTargetedManifestRequester(nil)
+
+		// when
+		_, err := requester.Fetch(deviceContext(), server.URL)
+
+		// then
+		require.NoError(t, err)
+		assert.Equal(t, before+1, histogram.Snapshot().Count)
+	})
+
+	t.Run("unsupported method", func(t *testing.T) {
+		// given
+		requester := manifest.NewTargetedManifestRequester(nil, manifest.WithMethod(http.MethodPut))
+
+		// when
+		_, err := requester.Fetch(context.Background(), "http://localhost")
+
+		// then
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported method")
+	})
+}
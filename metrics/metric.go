@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// Counter is a monotonically increasing value, e.g. the number of failed refreshes.
+	Counter struct {
+		bits atomic.Uint64
+	}
+
+	// Gauge is a value that can go up and down, e.g. the number of buffered events.
+	Gauge struct {
+		bits atomic.Uint64
+	}
+
+	// Histogram counts observations in cumulative buckets, e.g. request latencies.
+	Histogram struct {
+		upperBounds []float64
+
+		mu     sync.Mutex
+		counts []uint64
+		count  uint64
+		sum    float64
+	}
+
+	// HistogramSnapshot is the state of a Histogram at a point in time. Counts holds the
+	// cumulative number of observations less than or equal to the upper bound at the same index.
+	HistogramSnapshot struct {
+		UpperBounds []float64
+		Counts      []uint64
+		Count       uint64
+		Sum         float64
+	}
+)
+
+// DefaultBuckets are the histogram buckets used if none are given. They are suited for
+// latencies in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increments the counter by delta. Negative deltas are ignored.
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	addFloat(&c.bits, delta)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// Set sets the gauge to value.
+func (g *Gauge) Set(value float64) {
+	g.bits.Store(math.Float64bits(value))
+}
+
+// Add adds delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta float64) {
+	addFloat(&g.bits, delta)
+}
+
+func (g *Gauge) Inc() { g.Add(1) }
+func (g *Gauge) Dec() { g.Add(-1) }
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	upperBounds := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b, 1) {
+			upperBounds = append(upperBounds, b)
+		}
+	}
+	sort.Float64s(upperBounds)
+
+	return &Histogram{upperBounds: upperBounds, counts: make([]uint64, len(upperBounds))}
+}
+
+// Observe adds a single observation to the histogram.
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.upperBounds, value)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += value
+}
+
+// ObserveDuration observes the time elapsed since start in seconds.
+func (h *Histogram) ObserveDuration(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	snapshot := HistogramSnapshot{
+		UpperBounds: h.upperBounds,
+		Counts:      make([]uint64, len(h.counts)),
+		Count:       h.count,
+		Sum:         h.sum,
+	}
+
+	var cumulative uint64
+	for i, c := range h.counts {
+		cumulative += c
+		snapshot.Counts[i] = cumulative
+	}
+	return snapshot
+}
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		if bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
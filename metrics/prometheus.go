@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// WritePrometheus writes all series of the registry in the Prometheus text exposition format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	var last string
+	for _, sample := range r.Snapshot() {
+		if sample.Name != last {
+			last = sample.Name
+			if sample.Help != "" {
+				bw.WriteString("# HELP " + sample.Name + " " + escapeHelp(sample.Help) + "\n")
+			}
+			bw.WriteString("# TYPE " + sample.Name + " " + string(sample.Kind) + "\n")
+		}
+
+		if sample.Histogram == nil {
+			writeLine(bw, sample.Name, sample.Labels, "", "", sample.Value)
+			continue
+		}
+
+		h := sample.Histogram
+		for i, bound := range h.UpperBounds {
+			writeLine(bw, sample.Name+"_bucket", sample.Labels, "le", formatFloat(bound), float64(h.Counts[i]))
+		}
+		writeLine(bw, sample.Name+"_bucket", sample.Labels, "le", "+Inf", float64(h.Count))
+		writeLine(bw, sample.Name+"_sum", sample.Labels, "", "", h.Sum)
+		writeLine(bw, sample.Name+"_count", sample.Labels, "", "", float64(h.Count))
+	}
+
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the registry in the Prometheus text exposition
+// format. It is meant to be mounted on a local address, e.g. for debugging a device.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		r.WritePrometheus(w)
+	})
+}
+
+func writeLine(w *bufio.Writer, name string, labels Labels, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+
+	names := make([]string, 0, len(labels))
+	for l := range labels {
+		names = append(names, l)
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, l := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(l + `="` + escapeLabelValue(labels[l]) + `"`)
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				w.WriteByte(',')
+			}
+			w.WriteString(extraName + `="` + extraValue + `"`)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Registry holds metrics by name and labels. Metrics are created on first use and shared by
+	// every caller asking for the same name and labels.
+	Registry struct {
+		mu       sync.Mutex
+		families map[string]*family
+	}
+
+	// Labels distinguish the series of a metric, e.g. {"type": "update_applied"}.
+	Labels map[string]string
+
+	Kind string
+
+	// Sample is the state of a single series at the time of a snapshot. Value is set for
+	// counters and gauges, Histogram for histograms.
+	Sample struct {
+		Name      string
+		Help      string
+		Kind      Kind
+		Labels    Labels
+		Value     float64
+		Histogram *HistogramSnapshot
+	}
+
+	family struct {
+		name    string
+		help    string
+		kind    Kind
+		buckets []float64
+		series  map[string]*series
+	}
+
+	series struct {
+		labels Labels
+		metric any
+	}
+)
+
+const (
+	KindCounter   Kind = "counter"
+	KindGauge     Kind = "gauge"
+	KindHistogram Kind = "histogram"
+)
+
+// DefaultRegistry is the registry the services of this module record their metrics in.
+var DefaultRegistry = NewRegistry()
+
+var (
+	namePattern  = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter returns the counter with the given name and labels, creating it if necessary. It
+// panics if the name is invalid or already used by a metric of another kind.
+func (r *Registry) Counter(name, help string, labels Labels) *Counter {
+	return r.get(name, help, KindCounter, nil, labels, func([]float64) any { return &Counter{} }).(*Counter)
+}
+
+// Gauge returns the gauge with the given name and labels, creating it if necessary. It panics
+// if the name is invalid or already used by a metric of another kind.
+func (r *Registry) Gauge(name, help string, labels Labels) *Gauge {
+	return r.get(name, help, KindGauge, nil, labels, func([]float64) any { return &Gauge{} }).(*Gauge)
+}
+
+// Histogram returns the histogram with the given name and labels, creating it if necessary.
+// The buckets of the first call for a name are used for all of its series; nil selects
+// DefaultBuckets. It panics if the name is invalid or already used by a metric of another
+// kind.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels Labels) *Histogram {
+	return r.get(name, help, KindHistogram, buckets, labels, func(buckets []float64) any { return newHistogram(buckets) }).(*Histogram)
+}
+
+func (r *Registry) get(name, help string, kind Kind, buckets []float64, labels Labels, create func(buckets []float64) any) any {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, ok := r.families[name]
+	if !ok {
+		if !namePattern.MatchString(name) {
+			panic(fmt.Sprintf("metrics: invalid metric name %q", name))
+		}
+		f = &family{name: name, help: help, kind: kind, buckets: buckets, series: make(map[string]*series)}
+		r.families[name] = f
+	}
+	if f.kind != kind {
+		panic(fmt.Sprintf("metrics: %s is already registered as %s", name, f.kind))
+	}
+
+	key := labels.key()
+	if s, ok := f.series[key]; ok {
+		return s.metric
+	}
+
+	for l := range labels {
+		if !labelPattern.MatchString(l) || strings.HasPrefix(l, "__") || (kind == KindHistogram && l == "le") {
+			panic(fmt.Sprintf("metrics: invalid label name %q of %s", l, name))
+		}
+	}
+
+	metric := create(f.buckets)
+	f.series[key] = &series{labels: labels.clone(), metric: metric}
+	return metric
+}
+
+// Snapshot returns the state of all series ordered by name and labels.
+func (r *Registry) Snapshot() []Sample {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var samples []Sample
+	for _, f := range families {
+		r.mu.Lock()
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		series := make([]*series, len(keys))
+		for i, k := range keys {
+			series[i] = f.series[k]
+		}
+		r.mu.Unlock()
+
+		for _, s := range series {
+			sample := Sample{Name: f.name, Help: f.help, Kind: f.kind, Labels: s.labels}
+			switch m := s.metric.(type) {
+			case *Counter:
+				sample.Value = m.Value()
+			case *Gauge:
+				sample.Value = m.Value()
+			case *Histogram:
+				snapshot := m.Snapshot()
+				sample.Histogram = &snapshot
+			}
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// key returns a canonical representation of the labels.
+func (l Labels) key() string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s=%q,", name, l[name])
+	}
+	return b.String()
+}
+
+func (l Labels) clone() Labels {
+	if len(l) == 0 {
+		return nil
+	}
+	clone := make(Labels, len(l))
+	for k, v := range l {
+		clone[k] = v
+	}
+	return clone
+}
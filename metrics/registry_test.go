@@ -0,0 +1,97 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/dtomschitz/headless-go-client/metrics"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_ReturnsSameMetricForNameAndLabels(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	a := registry.Counter("requests_total", "", metrics.Labels{"host": "a", "code": "200"})
+	b := registry.Counter("requests_total", "", metrics.Labels{"code": "200", "host": "a"})
+	c := registry.Counter("requests_total", "", metrics.Labels{"host": "b", "code": "200"})
+
+	assert.Same(t, a, b)
+	assert.NotSame(t, a, c)
+	assert.Panics(t, func() { registry.Gauge("requests_total", "", nil) })
+	assert.Panics(t, func() { registry.Counter("invalid-name", "", nil) })
+	assert.Panics(t, func() { registry.Counter("other_total", "", metrics.Labels{"__name": "x"}) })
+}
+
+func TestRegistry_RecordsConcurrently(t *testing.T) {
+	// given
+	registry := metrics.NewRegistry()
+	counter := registry.Counter("ops_total", "", nil)
+	gauge := registry.Gauge("inflight", "", nil)
+
+	// when
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				counter.Inc()
+				gauge.Inc()
+				gauge.Dec()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// then
+	assert.Equal(t, float64(1000), counter.Value())
+	assert.Equal(t, float64(0), gauge.Value())
+}
+
+func TestHistogram_Snapshot(t *testing.T) {
+	// given
+	histogram := metrics.NewRegistry().Histogram("latency_seconds", "", []float64{1, 0.1, 0.5}, nil)
+
+	// when
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2} {
+		histogram.Observe(v)
+	}
+
+	// then
+	snapshot := histogram.Snapshot()
+	assert.Equal(t, []float64{0.1, 0.5, 1}, snapshot.UpperBounds)
+	assert.Equal(t, []uint64{2, 3, 4}, snapshot.Counts)
+	assert.Equal(t, uint64(5), snapshot.Count)
+	assert.InDelta(t, 3.15, snapshot.Sum, 1e-9)
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	// given
+	registry := metrics.NewRegistry()
+	registry.Counter("retries_total", "Number of retries.", metrics.Labels{"host": `a"b`}).Add(3)
+	registry.Gauge("buffered_events", "", nil).Set(1.5)
+	registry.Histogram("latency_seconds", "Request latency.", []float64{0.1, 1}, nil).Observe(0.5)
+	recorder := httptest.NewRecorder()
+
+	// when
+	registry.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	// then
+	require.Equal(t, metrics.PrometheusContentType, recorder.Header().Get("Content-Type"))
+	assert.Equal(t, `# TYPE buffered_events gauge
+buffered_events 1.5
+# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 0
+latency_seconds_bucket{le="1"} 1
+latency_seconds_bucket{le="+Inf"} 1
+latency_seconds_sum 0.5
+latency_seconds_count 1
+# HELP retries_total Number of retries.
+# TYPE retries_total counter
+retries_total{host="a\"b"} 3
+`, recorder.Body.String())
+}
@@ -0,0 +1,161 @@
+package peer
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/common/hash"
+)
+
+// cache stores verified artifacts below dir, addressed by the algorithm and digest of their
+// hash, e.g. "sha256/<hex>".
+type cache struct {
+	dir     string
+	maxSize int64
+	mu      sync.Mutex
+}
+
+var errUnsupportedHash = errors.New("hash is not supported for peer distribution")
+
+// hashLengths lists the algorithms accepted for sharing with their digest length in bytes.
+// Weak algorithms are rejected, as peers could otherwise serve colliding content.
+var hashLengths = map[string]int{
+	"sha256": 32,
+	"sha512": 64,
+}
+
+func newCache(dir string, maxSize int64) (*cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &cache{dir: dir, maxSize: maxSize}, nil
+}
+
+// parseHash splits a manifest hash like "sha256:<hex>" and validates it.
+func parseHash(hashString string) (string, string, error) {
+	algo, digest, ok := strings.Cut(hashString, ":")
+	length, supported := hashLengths[strings.ToLower(algo)]
+	if !ok || !supported {
+		return "", "", errUnsupportedHash
+	}
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != length {
+		return "", "", fmt.Errorf("invalid %s digest", algo)
+	}
+	return strings.ToLower(algo), hex.EncodeToString(decoded), nil
+}
+
+func (c *cache) path(hashString string) (string, error) {
+	algo, digest, err := parseHash(hashString)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(c.dir, algo, digest), nil
+}
+
+// open returns the artifact with the hash, or os.ErrNotExist if it is not cached.
+func (c *cache) open(hashString string) (*os.File, error) {
+	path, err := c.path(hashString)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	// Touching the file keeps recently used artifacts from being evicted.
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return file, nil
+}
+
+// put stores the content if it matches the hash. Nothing is stored otherwise.
+func (c *cache) put(hashString string, r io.Reader) error {
+	path, err := c.path(hashString)
+	if err != nil {
+		return err
+	}
+	verifier, _, err := hash.NewVerifierFromHashString(hashString)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	if err := verifier.Verify(io.TeeReader(r, tmpFile)); err != nil {
+		return fmt.Errorf("failed to verify artifact: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("failed to store artifact: %w", err)
+	}
+	return c.evict(path)
+}
+
+// evict removes the least recently used artifacts until the cache fits maxSize. The artifact
+// at keep is never removed.
+func (c *cache) evict(keep string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	type artifact struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var artifacts []artifact
+	var total int64
+	for algo := range hashLengths {
+		entries, err := os.ReadDir(filepath.Join(c.dir, algo))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(entry.Name(), "tmp-") {
+				continue
+			}
+			artifacts = append(artifacts, artifact{filepath.Join(c.dir, algo, entry.Name()), info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+
+	sort.Slice(artifacts, func(i, j int) bool { return artifacts[i].modTime.Before(artifacts[j].modTime) })
+	for _, a := range artifacts {
+		if total <= c.maxSize {
+			break
+		}
+		if a.path == keep {
+			continue
+		}
+		if err := os.Remove(a.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= a.size
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package peer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// message is a datagram of the discovery protocol. A node looking for an artifact broadcasts
+	// a query, nodes having it answer the sender with the port of their artifact server.
+	message struct {
+		Version int         `json:"v"`
+		Type    messageType `json:"type"`
+		Node    string      `json:"node"`
+		Id      string      `json:"id"`
+		Hash    string      `json:"hash"`
+		Port    int         `json:"port,omitempty"`
+	}
+
+	messageType string
+)
+
+const (
+	protocolVersion = 1
+
+	queryMessage messageType = "query"
+	haveMessage  messageType = "have"
+
+	maxMessageSize = 1024
+)
+
+// listen answers queries for cached artifacts until the connection is closed.
+func (s *Service) listen(conn *net.UDPConn) {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			s.logger.Warn("failed to read discovery message", "error", err)
+			continue
+		}
+
+		var query message
+		if err := json.Unmarshal(buf[:n], &query); err != nil || query.Version != protocolVersion ||
+			query.Type != queryMessage || query.Node == s.id {
+			continue
+		}
+		if !s.Has(query.Hash) {
+			continue
+		}
+
+		reply, err := json.Marshal(message{Version: protocolVersion, Type: haveMessage, Node: s.id, Id: query.Id, Hash: query.Hash, Port: s.port})
+		if err != nil {
+			continue
+		}
+		if _, err := conn.WriteToUDP(reply, src); err != nil {
+			s.logger.Warn("failed to answer discovery query", "peer", src.String(), "error", err)
+		}
+	}
+}
+
+// Lookup broadcasts a query for the artifact with the hash and returns the URLs of the peers
+// answering within the lookup timeout, in the order of their answers.
+func (s *Service) Lookup(ctx context.Context, hashString string) ([]string, error) {
+	algo, digest, err := parseHash(hashString)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open discovery socket: %w", err)
+	}
+	defer conn.Close()
+
+	query := message{Version: protocolVersion, Type: queryMessage, Node: s.id, Id: uuid.New().String(), Hash: hashString}
+	data, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := false
+	for _, addr := range s.broadcastAddrs {
+		if _, err := conn.WriteToUDP(data, addr); err != nil {
+			s.logger.Warn("failed to send discovery query", "addr", addr.String(), "error", err)
+			continue
+		}
+		sent = true
+	}
+	if !sent {
+		return nil, errors.New("failed to send discovery query")
+	}
+
+	deadline := time.Now().Add(s.lookupTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	// Closing the socket interrupts the read if the context is cancelled before the deadline.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var urls []string
+	seen := map[string]bool{}
+	buf := make([]byte, maxMessageSize)
+	for len(urls) < s.maxPeers {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			// The deadline ends the lookup, answers received so far are used.
+			break
+		}
+
+		var reply message
+		if err := json.Unmarshal(buf[:n], &reply); err != nil || reply.Version != protocolVersion || reply.Type != haveMessage ||
+			reply.Id != query.Id || reply.Hash != hashString || reply.Node == s.id || reply.Port <= 0 || reply.Port > 65535 {
+			continue
+		}
+
+		host := src.IP.String()
+		if src.Zone != "" {
+			host += "%25" + src.Zone
+		}
+		url := "http://" + net.JoinHostPort(host, strconv.Itoa(reply.Port)) + artifactPath(algo, digest)
+		if !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+
+	return urls, ctx.Err()
+}
+
+func artifactPath(algo, digest string) string {
+	return "/artifacts/" + algo + "/" + digest
+}
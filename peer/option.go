@@ -0,0 +1,123 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+)
+
+type Option func(context.Context, *Service) error
+
+// WithListenAddr sets the address the artifact server listens on. Defaults to
+// DefaultListenAddr.
+func WithListenAddr(addr string) Option {
+	return func(ctx context.Context, service *Service) error {
+		if addr == "" {
+			return errors.New("listen address cannot be empty")
+		}
+		service.listenAddr = addr
+		return nil
+	}
+}
+
+// WithDiscoveryAddr sets the UDP address discovery queries are received on. Defaults to
+// DefaultDiscoveryAddr.
+func WithDiscoveryAddr(addr string) Option {
+	return func(ctx context.Context, service *Service) error {
+		if addr == "" {
+			return errors.New("discovery address cannot be empty")
+		}
+		service.discoveryAddr = addr
+		return nil
+	}
+}
+
+// WithBroadcastAddrs sets the UDP addresses queries are sent to, e.g. the broadcast address of
+// a subnet or the discovery addresses of known peers. Defaults to DefaultBroadcastAddr.
+func WithBroadcastAddrs(addrs ...string) Option {
+	return func(ctx context.Context, service *Service) error {
+		if len(addrs) == 0 {
+			return errors.New("broadcast addresses cannot be empty")
+		}
+		for _, addr := range addrs {
+			resolved, err := net.ResolveUDPAddr("udp", addr)
+			if err != nil {
+				return fmt.Errorf("invalid broadcast address %s: %w", addr, err)
+			}
+			service.broadcastAddrs = append(service.broadcastAddrs, resolved)
+		}
+		return nil
+	}
+}
+
+// WithLookupTimeout sets how long a lookup waits for answers of peers.
+func WithLookupTimeout(timeout time.Duration) Option {
+	return func(ctx context.Context, service *Service) error {
+		if timeout <= 0 {
+			return errors.New("lookup timeout must be greater than 0")
+		}
+		service.lookupTimeout = timeout
+		return nil
+	}
+}
+
+// WithMaxPeers limits the number of peers a lookup collects.
+func WithMaxPeers(maxPeers int) Option {
+	return func(ctx context.Context, service *Service) error {
+		if maxPeers <= 0 {
+			return errors.New("max peers must be greater than 0")
+		}
+		service.maxPeers = maxPeers
+		return nil
+	}
+}
+
+// WithMaxCacheSize limits the size of the cache in bytes. The least recently used artifacts
+// are evicted first. Artifacts served by peers are read up to this size only, larger ones are
+// fetched from the origin. Defaults to 1GiB, 0 disables the limit.
+func WithMaxCacheSize(size int64) Option {
+	return func(ctx context.Context, service *Service) error {
+		if size < 0 {
+			return errors.New("max cache size cannot be negative")
+		}
+		service.maxCacheSize = size
+		return nil
+	}
+}
+
+// WithHTTPClient sets the client used to download artifacts from peers.
+func WithHTTPClient(client *http.Client) Option {
+	return func(ctx context.Context, service *Service) error {
+		if client == nil {
+			return errors.New("http client is not provided")
+		}
+		service.client = client
+		return nil
+	}
+}
+
+func WithEventEmitter(emitter event.Emitter) Option {
+	return func(ctx context.Context, service *Service) error {
+		if emitter == nil {
+			return errors.New("event emitter is not provided")
+		}
+		service.events = emitter
+		return nil
+	}
+}
+
+func WithLogger(factory logger.Factory) Option {
+	return func(ctx context.Context, service *Service) error {
+		if factory == nil {
+			return errors.New("logger is not provided")
+		}
+		service.logger = factory(ctx)
+		return nil
+	}
+}
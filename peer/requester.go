@@ -0,0 +1,117 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/metrics"
+)
+
+type (
+	// Fetcher fetches the artifact described by a manifest, e.g. updater.UpdateRequester.
+	Fetcher interface {
+		Fetch(ctx context.Context, manifest *manifest.Manifest) (io.ReadCloser, error)
+	}
+
+	// Requester fetches artifacts from the cache or from peers and falls back to Origin. Artifacts
+	// fetched from Origin are verified and cached, so that they are served to peers afterwards.
+	Requester struct {
+		Service *Service
+		Origin  Fetcher
+	}
+)
+
+// Requester returns a Requester falling back to origin.
+func (s *Service) Requester(origin Fetcher) *Requester {
+	return &Requester{Service: s, Origin: origin}
+}
+
+// Fetch returns the artifact described by the manifest. Manifests without a SHA-256 or SHA-512
+// hash are fetched from Origin only, as their content cannot be verified reliably.
+func (r *Requester) Fetch(ctx context.Context, m *manifest.Manifest) (io.ReadCloser, error) {
+	if r.Origin == nil {
+		return nil, errors.New("origin requester can not be nil")
+	}
+	s := r.Service
+	if _, _, err := parseHash(m.Hash); err != nil {
+		s.logger.Debug("fetching artifact from origin only", "version", m.Version, "reason", err)
+		return r.Origin.Fetch(ctx, m)
+	}
+
+	if file, err := s.cache.open(m.Hash); err == nil {
+		s.recordFetch(ctx, FetchPayload{Hash: m.Hash, Source: "cache"})
+		return file, nil
+	}
+
+	peers, err := s.Lookup(ctx, m.Hash)
+	if err != nil {
+		s.logger.Warn("failed to look up artifact on peers", "hash", m.Hash, "error", err)
+	}
+	for _, url := range peers {
+		if err := s.fetchFromPeer(ctx, url, m.Hash); err != nil {
+			s.logger.Warn("failed to fetch artifact from peer", "url", url, "error", err)
+			continue
+		}
+		if file, err := s.cache.open(m.Hash); err == nil {
+			s.logger.Info("fetched artifact from peer", "version", m.Version, "url", url)
+			s.recordFetch(ctx, FetchPayload{Hash: m.Hash, Source: "peer", Peer: url})
+			return file, nil
+		}
+	}
+
+	body, err := r.Origin.Fetch(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	if err := s.cache.put(m.Hash, body); err != nil {
+		return nil, fmt.Errorf("failed to cache artifact %s: %w", m.Version, err)
+	}
+	file, err := s.cache.open(m.Hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cached artifact %s: %w", m.Version, err)
+	}
+	s.recordFetch(ctx, FetchPayload{Hash: m.Hash, Source: "origin"})
+	return file, nil
+}
+
+func (s *Service) fetchFromPeer(ctx context.Context, url, hashString string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// The content is only verified once it has been read, so a peer must not be able to make
+	// the device store more than fits into the cache.
+	var body io.Reader = resp.Body
+	if s.maxCacheSize > 0 {
+		if resp.ContentLength > s.maxCacheSize {
+			return fmt.Errorf("artifact of %d bytes exceeds the cache size", resp.ContentLength)
+		}
+		body = io.LimitReader(resp.Body, s.maxCacheSize)
+	}
+
+	return s.cache.put(hashString, body)
+}
+
+func (s *Service) recordFetch(ctx context.Context, payload FetchPayload) {
+	metrics.DefaultRegistry.Counter("peer_artifact_fetches_total", "Number of artifacts fetched by source.",
+		metrics.Labels{"source": payload.Source}).Inc()
+	s.events.Push(event.NewEvent(ctx, ArtifactFetchedEvent, event.WithPayload(payload)))
+}
@@ -0,0 +1,249 @@
+// Package peer distributes update artifacts between devices on the same local network. A
+// device that has downloaded and verified an artifact serves it over HTTP. Other devices find
+// it by broadcasting the hash of the manifest over UDP and download it from a peer before
+// falling back to the origin server. Downloads from peers are verified against the manifest
+// hash, so peers cannot introduce content that the origin did not publish.
+package peer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/event"
+	"github.com/dtomschitz/headless-go-client/logger"
+	"github.com/dtomschitz/headless-go-client/metrics"
+
+	"github.com/google/uuid"
+)
+
+type (
+	// Service serves cached artifacts to peers and looks up artifacts on peers.
+	Service struct {
+		id             string
+		listenAddr     string
+		discoveryAddr  string
+		broadcastAddrs []*net.UDPAddr
+		lookupTimeout  time.Duration
+		maxPeers       int
+		maxCacheSize   int64
+
+		cache  *cache
+		client *http.Client
+		logger logger.Logger
+		events event.Emitter
+
+		port      int
+		listener  net.Listener
+		discovery *net.UDPConn
+		server    *http.Server
+
+		internalCtx    context.Context
+		internalCancel context.CancelFunc
+		wg             sync.WaitGroup
+		shutdownOnce   sync.Once
+	}
+
+	// FetchPayload is the payload of ArtifactFetchedEvent. Source is one of "cache", "peer" and
+	// "origin", Peer is set for artifacts downloaded from a peer.
+	FetchPayload struct {
+		Hash   string `json:"hash"`
+		Source string `json:"source"`
+		Peer   string `json:"peer,omitempty"`
+	}
+)
+
+const (
+	ServiceName = "PeerService"
+
+	ArtifactFetchedEvent event.EventType = "peer_artifact_fetched"
+
+	DefaultListenAddr    = ":7947"
+	DefaultDiscoveryAddr = ":7946"
+	DefaultBroadcastAddr = "255.255.255.255:7946"
+)
+
+func init() {
+	event.MustRegisterPayload(ArtifactFetchedEvent, 1, FetchPayload{})
+}
+
+// NewService creates a Service caching artifacts in dir. It serves them on the listen address
+// and answers discovery queries on the discovery address.
+func NewService(ctx context.Context, dir string, opts ...Option) (*Service, error) {
+	internalCtx, internalCancel := context.WithCancel(ctx)
+	internalCtx = context.WithValue(internalCtx, commonCtx.ServiceKey, ServiceName)
+
+	if dir == "" {
+		internalCancel()
+		return nil, errors.New("cache directory cannot be empty")
+	}
+
+	// Peers are reached directly, so the transport ignores proxies configured for the origin.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.ResponseHeaderTimeout = 5 * time.Second
+
+	service := &Service{
+		id:             uuid.New().String(),
+		listenAddr:     DefaultListenAddr,
+		discoveryAddr:  DefaultDiscoveryAddr,
+		lookupTimeout:  500 * time.Millisecond,
+		maxPeers:       3,
+		maxCacheSize:   1 << 30,
+		client:         &http.Client{Transport: transport},
+		logger:         &logger.NoopLogger{},
+		events:         &event.NoopEmitter{},
+		internalCtx:    internalCtx,
+		internalCancel: internalCancel,
+	}
+
+	for _, opt := range opts {
+		if err := opt(internalCtx, service); err != nil {
+			internalCancel()
+			return nil, fmt.Errorf("failed to apply option: %w", err)
+		}
+	}
+
+	if err := service.init(dir); err != nil {
+		service.closeListeners()
+		internalCancel()
+		return nil, err
+	}
+
+	service.start()
+	service.logger.Info("started service successfully", "addr", service.listener.Addr().String(), "discoveryAddr", service.discovery.LocalAddr().String())
+
+	return service, nil
+}
+
+func (s *Service) init(dir string) error {
+	var err error
+	if s.cache, err = newCache(dir, s.maxCacheSize); err != nil {
+		return err
+	}
+
+	if len(s.broadcastAddrs) == 0 {
+		addr, err := net.ResolveUDPAddr("udp", DefaultBroadcastAddr)
+		if err != nil {
+			return err
+		}
+		s.broadcastAddrs = []*net.UDPAddr{addr}
+	}
+
+	if s.listener, err = net.Listen("tcp", s.listenAddr); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.listenAddr, err)
+	}
+	s.port = s.listener.Addr().(*net.TCPAddr).Port
+
+	discoveryAddr, err := net.ResolveUDPAddr("udp", s.discoveryAddr)
+	if err != nil {
+		return fmt.Errorf("invalid discovery address %s: %w", s.discoveryAddr, err)
+	}
+	if s.discovery, err = net.ListenUDP("udp", discoveryAddr); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.discoveryAddr, err)
+	}
+	return nil
+}
+
+func (s *Service) start() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /artifacts/{algo}/{digest}", s.serveArtifact)
+	s.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return s.internalCtx },
+	}
+
+	s.wg.Add(2)
+	go func() {
+		defer recovery.Recover(ServiceName)
+		defer s.wg.Done()
+
+		if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("artifact server stopped", "error", err)
+		}
+	}()
+	go func() {
+		defer recovery.Recover(ServiceName)
+		defer s.wg.Done()
+
+		s.listen(s.discovery)
+	}()
+}
+
+// serveArtifact serves a cached artifact. Only artifacts that were verified against their
+// manifest hash are in the cache.
+func (s *Service) serveArtifact(w http.ResponseWriter, r *http.Request) {
+	file, err := s.cache.open(r.PathValue("algo") + ":" + r.PathValue("digest"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, "failed to read artifact", http.StatusInternalServerError)
+		return
+	}
+
+	metrics.DefaultRegistry.Counter("peer_artifacts_served_total", "Number of artifact requests served to peers.", nil).Inc()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+func (s *Service) Name() string {
+	return ServiceName
+}
+
+func (s *Service) Close(ctx context.Context) error {
+	var err error
+	s.shutdownOnce.Do(func() {
+		s.internalCancel()
+		err = s.server.Shutdown(ctx)
+		s.discovery.Close()
+	})
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Service) closeListeners() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.discovery != nil {
+		s.discovery.Close()
+	}
+}
+
+func (s *Service) PollEvents() []*event.Event {
+	return s.events.PollEvents()
+}
+
+// Addr returns the address of the artifact server.
+func (s *Service) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// DiscoveryAddr returns the address discovery queries are answered on.
+func (s *Service) DiscoveryAddr() net.Addr {
+	return s.discovery.LocalAddr()
+}
+
+// Has reports whether the artifact with the hash is cached and served to peers.
+func (s *Service) Has(hashString string) bool {
+	path, err := s.cache.path(hashString)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
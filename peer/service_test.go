@@ -0,0 +1,289 @@
+package peer_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/peer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type originFetcher struct {
+	content []byte
+	calls   atomic.Int32
+}
+
+func (o *originFetcher) Fetch(ctx context.Context, m *manifest.Manifest) (io.ReadCloser, error) {
+	o.calls.Add(1)
+	return io.NopCloser(strings.NewReader(string(o.content))), nil
+}
+
+func newManifest(content []byte) *manifest.Manifest {
+	sum := sha256.Sum256(content)
+	return &manifest.Manifest{Version: "1.2.0", Hash: "sha256:" + hex.EncodeToString(sum[:]), URL: "https://updates.example.com/client-1.2.0"}
+}
+
+// fakePeer claims to have every artifact and serves them from its HTTP server.
+type fakePeer struct {
+	conn *net.UDPConn
+	port int
+}
+
+// announce answers the discovery queries received on conn until it is closed.
+func (p *fakePeer) announce() {
+	buf := make([]byte, 1024)
+	for {
+		n, src, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var query map[string]any
+		if json.Unmarshal(buf[:n], &query) != nil {
+			continue
+		}
+		reply, _ := json.Marshal(map[string]any{"v": 1, "type": "have", "node": "fake", "id": query["id"], "hash": query["hash"], "port": p.port})
+		p.conn.WriteToUDP(reply, src)
+	}
+}
+
+func TestRequester_FetchesFromPeer(t *testing.T) {
+	// given
+	content := []byte("binary")
+	m := newManifest(content)
+
+	seeder, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs("127.0.0.1:9"),
+	)
+	require.NoError(t, err)
+	defer seeder.Close(context.Background())
+	seederOrigin := &originFetcher{content: content}
+	reader, err := seeder.Requester(seederOrigin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	seeded, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	require.Equal(t, content, seeded)
+
+	leecher, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs(seeder.DiscoveryAddr().String()),
+	)
+	require.NoError(t, err)
+	defer leecher.Close(context.Background())
+	leecherOrigin := &originFetcher{content: content}
+
+	// when
+	reader, err = leecher.Requester(leecherOrigin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	fetched, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, content, fetched)
+	assert.Equal(t, int32(1), seederOrigin.calls.Load())
+	assert.Equal(t, int32(0), leecherOrigin.calls.Load())
+	assert.True(t, seeder.Has(m.Hash))
+	assert.True(t, leecher.Has(m.Hash))
+}
+
+func TestRequester_FallsBackToOrigin(t *testing.T) {
+	// given
+	content := []byte("binary")
+	m := newManifest(content)
+
+	empty, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs("127.0.0.1:9"),
+	)
+	require.NoError(t, err)
+	defer empty.Close(context.Background())
+	service, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs(empty.DiscoveryAddr().String()),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	origin := &originFetcher{content: content}
+
+	// when
+	reader, err := service.Requester(origin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	first, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+	reader, err = service.Requester(origin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	second, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, content, first)
+	assert.Equal(t, content, second)
+	assert.Equal(t, int32(1), origin.calls.Load(), "second fetch should be served from the cache")
+}
+
+func TestRequester_RejectsTamperedPeerContent(t *testing.T) {
+	// given
+	content := []byte("binary")
+	m := newManifest(content)
+
+	// A malicious peer claims to have every artifact and serves different content.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("malware"))
+	}))
+	defer server.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	malicious := &fakePeer{conn: conn, port: server.Listener.Addr().(*net.TCPAddr).Port}
+	go malicious.announce()
+
+	service, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs(conn.LocalAddr().String()),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	origin := &originFetcher{content: content}
+
+	// when
+	reader, err := service.Requester(origin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	fetched, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, content, fetched)
+	assert.Equal(t, int32(1), origin.calls.Load())
+}
+
+func TestRequester_SkipsWeakHashes(t *testing.T) {
+	// given
+	content := []byte("binary")
+	sum := md5.Sum(content)
+	m := &manifest.Manifest{Version: "1.2.0", Hash: "md5:" + hex.EncodeToString(sum[:])}
+
+	service, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs("127.0.0.1:9"),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	origin := &originFetcher{content: content}
+
+	// when
+	reader, err := service.Requester(origin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	fetched, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, content, fetched)
+	assert.Equal(t, int32(1), origin.calls.Load())
+	assert.False(t, service.Has(m.Hash))
+}
+
+func TestService_ServesOnlyCachedArtifacts(t *testing.T) {
+	// given
+	service, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs("127.0.0.1:9"),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	base := "http://" + service.Addr().String() + "/artifacts/sha256/"
+
+	// when
+	missing, err := http.Get(base + strings.Repeat("0", 64))
+	require.NoError(t, err)
+	missing.Body.Close()
+	escaped, err := http.Get(base + "..%2F..%2Fetc%2Fpasswd")
+	require.NoError(t, err)
+	escaped.Body.Close()
+
+	// then
+	assert.Equal(t, http.StatusNotFound, missing.StatusCode)
+	assert.Equal(t, http.StatusNotFound, escaped.StatusCode)
+}
+
+func TestRequester_LimitsPeerContentToCacheSize(t *testing.T) {
+	// given
+	content := []byte("binary")
+	m := newManifest(content)
+
+	// A malicious peer serves an artifact far larger than the cache.
+	const served = 64 << 20
+	var written atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 32<<10)
+		for written.Load() < served {
+			n, err := w.Write(chunk)
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	defer conn.Close()
+	malicious := &fakePeer{conn: conn, port: server.Listener.Addr().(*net.TCPAddr).Port}
+	go malicious.announce()
+
+	service, err := peer.NewService(context.Background(), t.TempDir(),
+		peer.WithListenAddr("127.0.0.1:0"),
+		peer.WithDiscoveryAddr("127.0.0.1:0"),
+		peer.WithLookupTimeout(200*time.Millisecond),
+		peer.WithBroadcastAddrs(conn.LocalAddr().String()),
+		peer.WithMaxCacheSize(1<<20),
+	)
+	require.NoError(t, err)
+	defer service.Close(context.Background())
+	origin := &originFetcher{content: content}
+
+	// when
+	reader, err := service.Requester(origin).Fetch(context.Background(), m)
+	require.NoError(t, err)
+	fetched, err := io.ReadAll(reader)
+	reader.Close()
+	require.NoError(t, err)
+
+	// then
+	assert.Equal(t, content, fetched)
+	assert.Equal(t, int32(1), origin.calls.Load())
+	assert.Less(t, written.Load(), int64(served), "expected the download to stop at the cache size")
+}
@@ -2,13 +2,16 @@ package updater
 
 import (
 	"context"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/dtomschitz/headless-go-client/event"
 	"github.com/dtomschitz/headless-go-client/logger"
 	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/peer"
 )
 
 type Option func(context.Context, *Updater) error
@@ -23,6 +26,18 @@ func WithUpdateRequester(requester UpdateRequester) Option {
 	}
 }
 
+// WithHTTPClient sets the client of the default update and manifest requesters, e.g. a client
+// authenticating the device.
+func WithHTTPClient(client *http.Client) Option {
+	return func(ctx context.Context, updater *Updater) error {
+		if client == nil {
+			return errors.New("http client is not provided")
+		}
+		updater.client = client
+		return nil
+	}
+}
+
 func WithManifestRequester(requester manifest.ManifestRequester) Option {
 	return func(ctx context.Context, updater *Updater) error {
 		if requester == nil {
@@ -75,3 +90,52 @@ func WithEventEmitter(emitter event.Emitter) Option {
 		return nil
 	}
 }
+
+// WithBundleKeys sets the public keys trusted to sign offline bundles imported by ImportBundle.
+func WithBundleKeys(keys ...ed25519.PublicKey) Option {
+	return func(ctx context.Context, updater *Updater) error {
+		if len(keys) == 0 {
+			return errors.New("bundle keys are not provided")
+		}
+		for _, key := range keys {
+			if len(key) != ed25519.PublicKeySize {
+				return errors.New("invalid bundle key")
+			}
+		}
+		updater.bundleKeys = append(updater.bundleKeys, keys...)
+		return nil
+	}
+}
+
+// WithAllowDowngrade lets ImportBundle install bundles with a version older than the current
+// one, e.g. to roll back a faulty release in the field.
+func WithAllowDowngrade() Option {
+	return func(ctx context.Context, updater *Updater) error {
+		updater.allowDowngrade = true
+		return nil
+	}
+}
+
+// WithBinaryPath replaces the binary at path with applied updates instead of the running
+// executable, e.g. when the client updates a binary it supervises.
+func WithBinaryPath(path string) Option {
+	return func(ctx context.Context, updater *Updater) error {
+		if path == "" {
+			return errors.New("binary path is not provided")
+		}
+		updater.binaryPath = path
+		return nil
+	}
+}
+
+// WithPeerDistribution fetches updates from devices on the local network before falling back
+// to the update requester. Downloaded updates are served to other devices by the service.
+func WithPeerDistribution(service *peer.Service) Option {
+	return func(ctx context.Context, updater *Updater) error {
+		if service == nil {
+			return errors.New("peer service is not provided")
+		}
+		updater.peers = service
+		return nil
+	}
+}
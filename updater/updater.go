@@ -2,17 +2,25 @@ package updater
 
 import (
 	"context"
+	"crypto/ed25519"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/dtomschitz/headless-go-client/bundle"
 	commonCtx "github.com/dtomschitz/headless-go-client/common/context"
 	commonHttp "github.com/dtomschitz/headless-go-client/common/http"
+	"github.com/dtomschitz/headless-go-client/common/recovery"
+	"github.com/dtomschitz/headless-go-client/common/version"
 	"github.com/dtomschitz/headless-go-client/event"
 	"github.com/dtomschitz/headless-go-client/logger"
 	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/metrics"
+	"github.com/dtomschitz/headless-go-client/peer"
 )
 
 type (
@@ -22,10 +30,15 @@ type (
 		initialPollDelay time.Duration
 		pollInterval     time.Duration
 
+		client            *http.Client
 		logger            logger.Logger
 		events            event.Emitter
 		updateRequester   UpdateRequester
 		manifestRequester manifest.ManifestRequester
+		bundleKeys        []ed25519.PublicKey
+		allowDowngrade    bool
+		binaryPath        string
+		peers             *peer.Service
 
 		updateAvailableChan chan *manifest.Manifest
 		updateAppliedChan   chan *manifest.Manifest
@@ -37,6 +50,14 @@ type (
 	}
 
 	UpdateEventFunc func(ctx context.Context, mainfest *manifest.Manifest)
+
+	// UpdatePayload describes the update of UpdateAvailableEvent, UpdateStartedEvent and
+	// UpdateAppliedEvent.
+	UpdatePayload struct {
+		Version string `json:"version"`
+		Hash    string `json:"hash"`
+		URL     string `json:"url"`
+	}
 )
 
 const (
@@ -50,6 +71,17 @@ const (
 	UpdateAppliedEvent         event.EventType = "update_applied"
 )
 
+func init() {
+	for _, eventType := range []event.EventType{UpdateAvailableEvent, UpdateStartedEvent, UpdateAppliedEvent} {
+		event.MustRegisterPayload(eventType, 1, UpdatePayload{})
+		event.RegisterPriority(eventType, event.PriorityLifecycle)
+	}
+}
+
+func newUpdatePayload(manifest *manifest.Manifest) UpdatePayload {
+	return UpdatePayload{Version: manifest.Version, Hash: manifest.Hash, URL: manifest.URL}
+}
+
 func NewService(ctx context.Context, manifestURL string, currentClientVersion string, opts ...Option) (*Updater, error) {
 	internalCtx, internalCancel := context.WithCancel(ctx)
 	internalCtx = context.WithValue(internalCtx, commonCtx.ServiceKey, ServiceName)
@@ -62,13 +94,10 @@ func NewService(ctx context.Context, manifestURL string, currentClientVersion st
 		}
 	}
 
-	httpClient := commonHttp.NewClient()
-
 	updater := &Updater{
 		currentVersion:      currentClientVersion,
 		manifestURL:         manifestURL,
-		updateRequester:     &DefaultUpdateRequester{Client: httpClient},
-		manifestRequester:   manifest.NewDefaultManifestRequester(httpClient),
+		client:              commonHttp.NewClient(),
 		initialPollDelay:    1 * time.Minute,
 		pollInterval:        1 * time.Hour,
 		logger:              &logger.NoopLogger{},
@@ -86,6 +115,16 @@ func NewService(ctx context.Context, manifestURL string, currentClientVersion st
 		}
 	}
 
+	if updater.updateRequester == nil {
+		updater.updateRequester = &DefaultUpdateRequester{Client: updater.client}
+	}
+	if updater.peers != nil {
+		updater.updateRequester = updater.peers.Requester(updater.updateRequester)
+	}
+	if updater.manifestRequester == nil {
+		updater.manifestRequester = manifest.NewDefaultManifestRequester(updater.client)
+	}
+
 	updater.start(internalCtx)
 	updater.logger.Info("started service successfully", "pollInterval", updater.pollInterval)
 
@@ -96,6 +135,7 @@ func (updater *Updater) start(ctx context.Context) {
 	updater.wg.Add(1)
 
 	go func() {
+		defer recovery.Recover(ServiceName)
 		defer updater.wg.Done()
 
 		if updater.initialPollDelay > 0 {
@@ -169,6 +209,7 @@ func (updater *Updater) ListenForUpdateApplied(ctx context.Context, fn UpdateEve
 
 func (updater *Updater) eventListener(ctx context.Context, updateChan chan *manifest.Manifest, fn UpdateEventFunc) {
 	go func() {
+		defer recovery.Recover(ServiceName)
 		for {
 			select {
 			case <-ctx.Done():
@@ -195,17 +236,54 @@ func (updater *Updater) TriggerUpdateCheck(ctx context.Context) error {
 		return nil
 	}
 
-	updater.events.Push(event.NewEvent(ctx, UpdateAvailableEvent, event.WithDataField("manifest", manifest)))
+	updater.events.Push(event.NewEvent(ctx, UpdateAvailableEvent, event.WithPayload(newUpdatePayload(manifest))))
 	updater.updateAvailableChan <- manifest
 
 	return nil
 }
 
 func (updater *Updater) ApplyUpdate(ctx context.Context, manifest *manifest.Manifest) error {
-	eventOpts := event.WithDataField("manifest", manifest)
+	return updater.apply(ctx, manifest, updater.updateRequester)
+}
+
+// ImportBundle applies the update contained in the offline bundle at path. The bundle must be
+// signed by one of the keys configured with WithBundleKeys. The update is verified and installed
+// like one fetched from the update server. Bundles without an update or with the current
+// version are ignored. Bundles with an older version are rejected unless downgrades are
+// allowed with WithAllowDowngrade, so that an old signed bundle cannot reinstall a version with
+// known flaws.
+func (updater *Updater) ImportBundle(ctx context.Context, path string) error {
+	b, err := bundle.Open(path, updater.bundleKeys...)
+	if err != nil {
+		err = fmt.Errorf("failed to open bundle: %w", err)
+		updater.events.Push(event.NewEventFromError(ctx, UpdateAvailableEvent, err))
+		return err
+	}
+	defer b.Close()
+
+	manifest := b.UpdateManifest()
+	if manifest == nil || version.Compare(manifest.Version, updater.currentVersion) == 0 {
+		updater.events.Push(event.NewEvent(ctx, NoUpdateAvailableEvent))
+		updater.logger.Info("bundle contains no update", "path", path)
+		return nil
+	}
+	if version.Compare(manifest.Version, updater.currentVersion) < 0 && !updater.allowDowngrade {
+		err := fmt.Errorf("bundle version %s is older than the current version %s", manifest.Version, updater.currentVersion)
+		updater.events.Push(event.NewEventFromError(ctx, UpdateAvailableEvent, err))
+		return err
+	}
+
+	updater.logger.Info("importing update from bundle", "path", path, "version", manifest.Version)
+	updater.events.Push(event.NewEvent(ctx, UpdateAvailableEvent, event.WithPayload(newUpdatePayload(manifest))))
+
+	return updater.apply(ctx, manifest, b)
+}
+
+func (updater *Updater) apply(ctx context.Context, manifest *manifest.Manifest, requester UpdateRequester) error {
+	eventOpts := event.WithPayload(newUpdatePayload(manifest))
 	updater.events.Push(event.NewEvent(ctx, UpdateStartedEvent, eventOpts))
 
-	if err := updater.applyUpdate(ctx, manifest); err != nil {
+	if err := updater.applyUpdate(ctx, manifest, requester); err != nil {
 		err = fmt.Errorf("failed to apply update: %w", err)
 
 		updater.logger.Error("failed to apply update", "error", err)
@@ -219,11 +297,12 @@ func (updater *Updater) ApplyUpdate(ctx context.Context, manifest *manifest.Mani
 	return nil
 }
 
-func (updater *Updater) applyUpdate(ctx context.Context, manifest *manifest.Manifest) error {
+func (updater *Updater) applyUpdate(ctx context.Context, manifest *manifest.Manifest, requester UpdateRequester) error {
 	updater.logger.Info("going to apply update", "version", manifest.Version)
 	updater.events.Push(event.NewEvent(ctx, UpdateDownloadStartedEvent))
 
-	binaryReader, err := updater.updateRequester.Fetch(ctx, manifest)
+	start := time.Now()
+	binaryReader, err := requester.Fetch(ctx, manifest)
 	if err != nil {
 		return fmt.Errorf("failed to fetch update %s: %w", manifest.Version, err)
 	}
@@ -233,6 +312,7 @@ func (updater *Updater) applyUpdate(ctx context.Context, manifest *manifest.Mani
 	if err != nil {
 		return fmt.Errorf("failed to read binary: %w", err)
 	}
+	recordDownload(len(binary), time.Since(start))
 
 	updater.events.Push(event.NewEvent(ctx, UpdateDownloadedEvent))
 	updater.logger.Debug("update fetched successfully", "version", manifest.Version)
@@ -243,21 +323,24 @@ func (updater *Updater) applyUpdate(ctx context.Context, manifest *manifest.Mani
 
 	updater.logger.Debug("going to proceed with update because checksum matches")
 
-	execPath, err := os.Executable()
-	if err != nil {
-		return fmt.Errorf("failed to find current binary: %w", err)
+	execPath := updater.binaryPath
+	if execPath == "" {
+		if execPath, err = os.Executable(); err != nil {
+			return fmt.Errorf("failed to find current binary: %w", err)
+		}
 	}
 
 	updater.logger.Debug("resolved current binary path", "execPath", execPath)
 
-	tmpFile, err := createTempBinaryFile(binary)
+	// The temporary file is created next to the binary, so that it can be renamed in place.
+	// Once renamed, removing it is a no-op.
+	tmpPath, err := createTempBinaryFile(filepath.Dir(execPath), binary)
 	if err != nil {
 		return fmt.Errorf("failed to create temporary file: %w", err)
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
+	defer os.Remove(tmpPath)
 
-	if err := replaceBinary(execPath, tmpFile.Name()); err != nil {
+	if err := replaceBinary(execPath, tmpPath); err != nil {
 		return fmt.Errorf("failed to replace current binary: %w", err)
 	}
 
@@ -267,6 +350,8 @@ func (updater *Updater) applyUpdate(ctx context.Context, manifest *manifest.Mani
 }
 
 func (updater *Updater) checkIfUpdateIsAvailable(ctx context.Context) (*manifest.Manifest, bool, error) {
+	ctx = manifest.WithCurrentVersion(ctx, updater.currentVersion, "")
+
 	manifest, err := updater.manifestRequester.Fetch(ctx, updater.manifestURL)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to fetch manifest: %w", err)
@@ -299,19 +384,37 @@ func replaceBinary(currentPath, newBinaryPath string) error {
 	return nil
 }
 
-func createTempBinaryFile(binary []byte) (*os.File, error) {
-	tmpFile, err := os.CreateTemp("", "update-*")
+// createTempBinaryFile writes the binary to an executable temporary file in dir and returns
+// its path.
+func createTempBinaryFile(dir string, binary []byte) (string, error) {
+	tmpFile, err := os.CreateTemp(dir, "update-*")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
 	}
-	defer os.Remove(tmpFile.Name())
 
 	if _, err := tmpFile.Write(binary); err != nil {
-		return nil, fmt.Errorf("failed to write binary to temp file: %w", err)
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to write binary to temp file: %w", err)
 	}
 	if err := tmpFile.Chmod(0755); err != nil {
-		return nil, fmt.Errorf("failed to make temp file executable: %w", err)
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to make temp file executable: %w", err)
 	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", fmt.Errorf("failed to write binary to temp file: %w", err)
+	}
+
+	return tmpFile.Name(), nil
+}
 
-	return tmpFile, nil
+// recordDownload records the size and throughput of a completed update download.
+func recordDownload(size int, duration time.Duration) {
+	metrics.DefaultRegistry.Counter("update_download_bytes_total", "Number of bytes downloaded for updates.", nil).Add(float64(size))
+	if seconds := duration.Seconds(); seconds > 0 {
+		metrics.DefaultRegistry.Histogram("update_download_throughput_bytes_per_second", "Throughput of update downloads in bytes per second.",
+			[]float64{64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20}, nil).Observe(float64(size) / seconds)
+	}
 }
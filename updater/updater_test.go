@@ -0,0 +1,92 @@
+package updater_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dtomschitz/headless-go-client/bundle"
+	"github.com/dtomschitz/headless-go-client/manifest"
+	"github.com/dtomschitz/headless-go-client/updater"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdater_ImportBundle(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, untrusted, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		version        string
+		key            ed25519.PrivateKey
+		allowDowngrade bool
+		wantErr        string
+		wantBinary     string
+	}{
+		{name: "installs newer version", version: "1.3.0", key: private, wantBinary: "new"},
+		{name: "ignores current version", version: "1.2.0", key: private, wantBinary: "old"},
+		{name: "rejects older version", version: "1.1.0", key: private, wantErr: "older than the current version 1.2.0", wantBinary: "old"},
+		{name: "installs older version if allowed", version: "1.1.0", key: private, allowDowngrade: true, wantBinary: "new"},
+		{name: "rejects untrusted bundle", version: "1.3.0", key: untrusted, wantErr: bundle.ErrInvalidSignature.Error(), wantBinary: "old"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// given
+			dir := t.TempDir()
+			binaryPath := filepath.Join(dir, "client")
+			require.NoError(t, os.WriteFile(binaryPath, []byte("old"), 0755))
+			updatePath := filepath.Join(t.TempDir(), "client-"+tt.version)
+			require.NoError(t, os.WriteFile(updatePath, []byte("new"), 0644))
+
+			bundlePath := filepath.Join(t.TempDir(), "site.bundle")
+			file, err := os.Create(bundlePath)
+			require.NoError(t, err)
+			require.NoError(t, bundle.Build(file, tt.key, bundle.Contents{
+				Update: &bundle.Artifact{Manifest: manifest.Manifest{Version: tt.version}, Path: updatePath},
+			}))
+			require.NoError(t, file.Close())
+
+			opts := []updater.Option{
+				updater.WithBundleKeys(public),
+				updater.WithBinaryPath(binaryPath),
+				updater.WithInitialPollDelay(time.Hour),
+			}
+			if tt.allowDowngrade {
+				opts = append(opts, updater.WithAllowDowngrade())
+			}
+			service, err := updater.NewService(context.Background(), "http://127.0.0.1:9/manifest", "1.2.0", opts...)
+			require.NoError(t, err)
+			defer service.Close(context.Background())
+
+			// when
+			err = service.ImportBundle(context.Background(), bundlePath)
+
+			// then
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+
+			binary, err := os.ReadFile(binaryPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBinary, string(binary))
+			info, err := os.Stat(binaryPath)
+			require.NoError(t, err)
+			assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+			leftovers, err := filepath.Glob(filepath.Join(dir, "update-*"))
+			require.NoError(t, err)
+			assert.Empty(t, leftovers, "expected no temporary files next to the binary")
+		})
+	}
+}